@@ -0,0 +1,4 @@
+CREATE TABLE processed_messages (
+    message_key VARCHAR(255) PRIMARY KEY,
+    processed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,10 @@
+CREATE TABLE outbox (
+    outbox_id BIGSERIAL PRIMARY KEY,
+    topic VARCHAR(255) NOT NULL,
+    message_key VARCHAR(255) NOT NULL,
+    payload BYTEA NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP
+);
+
+CREATE INDEX outbox_pending_idx ON outbox (outbox_id) WHERE sent_at IS NULL;
@@ -0,0 +1,2 @@
+DROP INDEX inventory_below_threshold_idx;
+DROP INDEX inventory_warehouse_id_idx;
@@ -0,0 +1,2 @@
+CREATE INDEX inventory_warehouse_id_idx ON inventory (warehouse_id);
+CREATE INDEX inventory_below_threshold_idx ON inventory (product_id, warehouse_id) WHERE stock_level < alert_threshold;
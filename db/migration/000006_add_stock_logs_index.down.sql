@@ -0,0 +1 @@
+DROP INDEX stock_logs_product_warehouse_idx;
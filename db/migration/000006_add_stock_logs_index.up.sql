@@ -0,0 +1 @@
+CREATE INDEX stock_logs_product_warehouse_idx ON stock_logs (product_id, warehouse_id, log_id);
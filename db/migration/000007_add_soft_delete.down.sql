@@ -0,0 +1,2 @@
+ALTER TABLE warehouses DROP COLUMN deleted_at;
+ALTER TABLE products DROP COLUMN deleted_at;
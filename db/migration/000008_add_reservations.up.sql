@@ -0,0 +1,13 @@
+CREATE TABLE reservations (
+    reservation_id VARCHAR(64) PRIMARY KEY,
+    product_id INT NOT NULL,
+    warehouse_id INT NOT NULL,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    status VARCHAR(16) NOT NULL DEFAULT 'active',
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (product_id, warehouse_id) REFERENCES inventory (product_id, warehouse_id)
+);
+
+CREATE INDEX reservations_active_idx ON reservations (product_id, warehouse_id) WHERE status = 'active';
+CREATE INDEX reservations_expiry_idx ON reservations (expires_at) WHERE status = 'active';
@@ -0,0 +1,3 @@
+ALTER TABLE stock_logs DROP COLUMN transfer_id;
+
+DROP TABLE transfers;
@@ -0,0 +1,17 @@
+CREATE TABLE transfers (
+    transfer_id VARCHAR(64) PRIMARY KEY,
+    product_id INT NOT NULL,
+    source_warehouse_id INT NOT NULL,
+    destination_warehouse_id INT NOT NULL,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    status VARCHAR(16) NOT NULL DEFAULT 'in_transit',
+    dispatched_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    received_at TIMESTAMP,
+    CHECK (source_warehouse_id <> destination_warehouse_id),
+    FOREIGN KEY (product_id, source_warehouse_id) REFERENCES inventory (product_id, warehouse_id),
+    FOREIGN KEY (product_id, destination_warehouse_id) REFERENCES inventory (product_id, warehouse_id)
+);
+
+CREATE INDEX transfers_in_transit_idx ON transfers (product_id, destination_warehouse_id) WHERE status = 'in_transit';
+
+ALTER TABLE stock_logs ADD COLUMN transfer_id VARCHAR(64) REFERENCES transfers (transfer_id);
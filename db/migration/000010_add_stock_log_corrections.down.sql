@@ -0,0 +1 @@
+ALTER TABLE stock_logs DROP COLUMN is_correction;
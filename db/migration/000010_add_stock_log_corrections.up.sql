@@ -0,0 +1 @@
+ALTER TABLE stock_logs ADD COLUMN is_correction BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1 @@
+ALTER TABLE inventory ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
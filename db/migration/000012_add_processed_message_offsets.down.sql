@@ -0,0 +1,5 @@
+DROP INDEX processed_messages_kafka_offset_idx;
+ALTER TABLE processed_messages
+    DROP COLUMN kafka_topic,
+    DROP COLUMN kafka_partition,
+    DROP COLUMN kafka_offset;
@@ -0,0 +1,12 @@
+ALTER TABLE processed_messages
+    ADD COLUMN kafka_topic VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN kafka_partition INTEGER NOT NULL DEFAULT -1,
+    ADD COLUMN kafka_offset BIGINT NOT NULL DEFAULT -1;
+
+UPDATE processed_messages
+SET kafka_topic = split_part(message_key, ':', 2),
+    kafka_partition = split_part(message_key, ':', 3)::int,
+    kafka_offset = split_part(message_key, ':', 4)::bigint
+WHERE message_key LIKE 'offset:%';
+
+CREATE INDEX processed_messages_kafka_offset_idx ON processed_messages (kafka_topic, kafka_partition, kafka_offset);
@@ -0,0 +1 @@
+DROP TABLE reconcile_checkpoint;
@@ -0,0 +1,7 @@
+CREATE TABLE reconcile_checkpoint (
+    id BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+    last_log_id INT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO reconcile_checkpoint (last_log_id) VALUES (0);
@@ -0,0 +1,3 @@
+DROP INDEX stock_logs_timestamp_idx;
+
+ALTER TABLE reconcile_checkpoint DROP COLUMN checked_at;
@@ -0,0 +1,3 @@
+ALTER TABLE reconcile_checkpoint ADD COLUMN checked_at TIMESTAMP;
+
+CREATE INDEX stock_logs_timestamp_idx ON stock_logs (timestamp);
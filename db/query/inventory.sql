@@ -5,19 +5,103 @@ SELECT
 	stock_level,
 	p.name as product_name,
 	w.name as warehouse_name,
-	alert_threshold
+	alert_threshold,
+	version
 FROM inventory AS i
 INNER JOIN products as p on p.product_id = i.product_id
 INNER JOIN warehouses as w on w.warehouse_id = i.warehouse_id
 WHERE i.warehouse_id = $1 AND i.product_id = $2
 LIMIT 1;
 
--- name: UpdateInventory :exec
+-- name: UpdateInventory :one
+UPDATE inventory
+SET stock_level = $1, version = version + 1
+WHERE warehouse_id = $2 AND product_id = $3
+RETURNING alert_threshold, version;
+
+-- name: AdjustInventory :one
 UPDATE inventory
-SET stock_level = $1
-WHERE warehouse_id = $2 AND product_id = $3;
+SET stock_level = stock_level + @stock_delta::int, version = version + 1
+WHERE warehouse_id = @warehouse_id AND product_id = @product_id
+	AND stock_level + @stock_delta::int >= 0
+RETURNING (stock_level - @stock_delta::int)::int AS previous_stock, stock_level, alert_threshold, version;
+
+-- name: AdjustInventoryBatch :batchone
+UPDATE inventory
+SET stock_level = stock_level + @stock_delta::int, version = version + 1
+WHERE warehouse_id = @warehouse_id AND product_id = @product_id
+	AND stock_level + @stock_delta::int >= 0
+RETURNING (stock_level - @stock_delta::int)::int AS previous_stock, stock_level, alert_threshold, version;
 
 -- name: InsertStockLog :exec
-INSERT INTO stock_logs (product_id, warehouse_id, previous_stock, updated_stock)
-VALUES ($1, $2, $3, $4);
+INSERT INTO stock_logs (product_id, warehouse_id, previous_stock, updated_stock, transfer_id, is_correction)
+VALUES ($1, $2, $3, $4, $5, $6);
+
+-- name: InsertStockLogBatch :batchexec
+INSERT INTO stock_logs (product_id, warehouse_id, previous_stock, updated_stock, transfer_id, is_correction)
+VALUES ($1, $2, $3, $4, $5, $6);
+
+
+-- name: ListInventory :many
+SELECT
+	i.product_id,
+	i.warehouse_id,
+	stock_level,
+	p.name as product_name,
+	w.name as warehouse_name,
+	alert_threshold
+FROM inventory AS i
+INNER JOIN products as p on p.product_id = i.product_id
+INNER JOIN warehouses as w on w.warehouse_id = i.warehouse_id
+WHERE p.deleted_at IS NULL AND w.deleted_at IS NULL
+	AND (sqlc.narg('warehouse_id')::int IS NULL OR i.warehouse_id = sqlc.narg('warehouse_id'))
+	AND (sqlc.narg('product_id')::int IS NULL OR i.product_id = sqlc.narg('product_id'))
+	AND (NOT @below_threshold::boolean OR i.stock_level < i.alert_threshold)
+	AND (
+		NOT @has_cursor::boolean
+		OR (
+			CASE @sort_by::text
+				WHEN 'stock_level' THEN i.stock_level
+				WHEN 'warehouse_id' THEN i.warehouse_id
+				ELSE i.product_id
+			END * @direction::int,
+			i.product_id * @direction::int,
+			i.warehouse_id * @direction::int
+		) > (@cursor_sort_key::int, @cursor_product_key::int, @cursor_warehouse_key::int)
+	)
+ORDER BY
+	CASE @sort_by::text
+		WHEN 'stock_level' THEN i.stock_level
+		WHEN 'warehouse_id' THEN i.warehouse_id
+		ELSE i.product_id
+	END * @direction::int,
+	i.product_id * @direction::int,
+	i.warehouse_id * @direction::int
+LIMIT @page_size::int;
+
+-- name: CreateInventory :one
+INSERT INTO inventory (product_id, warehouse_id, stock_level, alert_threshold)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: UpdateAlertThreshold :one
+UPDATE inventory
+SET alert_threshold = $1, version = version + 1
+WHERE warehouse_id = $2 AND product_id = $3
+RETURNING stock_level, alert_threshold, version;
+
+-- name: GetInventoryForUpdate :one
+SELECT stock_level, alert_threshold, version
+FROM inventory
+WHERE warehouse_id = $1 AND product_id = $2
+FOR UPDATE;
+
+-- name: CountInventory :one
+SELECT COUNT(*) FROM inventory;
 
+-- name: ListInventoryAfter :many
+SELECT product_id, warehouse_id, stock_level, alert_threshold, version
+FROM inventory
+WHERE (product_id, warehouse_id) > (@after_product_id::int, @after_warehouse_id::int)
+ORDER BY product_id, warehouse_id
+LIMIT @page_size::int;
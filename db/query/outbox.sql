@@ -0,0 +1,24 @@
+-- name: InsertOutboxMessage :exec
+INSERT INTO outbox (topic, message_key, payload)
+VALUES ($1, $2, $3);
+
+-- name: ListPendingOutboxMessages :many
+SELECT outbox_id, topic, message_key, payload
+FROM outbox
+WHERE sent_at IS NULL
+ORDER BY outbox_id
+LIMIT $1
+FOR UPDATE SKIP LOCKED;
+
+-- name: MarkOutboxMessageSent :exec
+UPDATE outbox
+SET sent_at = CURRENT_TIMESTAMP
+WHERE outbox_id = $1;
+
+-- name: DeleteSentOutboxMessages :execrows
+DELETE FROM outbox
+WHERE outbox_id IN (
+	SELECT outbox_id FROM outbox
+	WHERE sent_at < CURRENT_TIMESTAMP - @retention_seconds::bigint * INTERVAL '1 second'
+	LIMIT @batch_size::int
+);
@@ -0,0 +1,22 @@
+-- name: InsertProcessedMessage :execrows
+INSERT INTO processed_messages (message_key, kafka_topic, kafka_partition, kafka_offset)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT DO NOTHING;
+
+-- name: InsertProcessedMessageBatch :batchone
+INSERT INTO processed_messages (message_key, kafka_topic, kafka_partition, kafka_offset)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT DO NOTHING
+RETURNING message_key;
+
+-- name: DeleteProcessedMessagesFrom :execrows
+DELETE FROM processed_messages
+WHERE kafka_topic = $1 AND kafka_partition = $2 AND kafka_offset >= $3;
+
+-- name: DeleteProcessedMessagesBefore :execrows
+DELETE FROM processed_messages
+WHERE message_key IN (
+	SELECT message_key FROM processed_messages
+	WHERE processed_at < CURRENT_TIMESTAMP - @retention_seconds::bigint * INTERVAL '1 second'
+	LIMIT @batch_size::int
+);
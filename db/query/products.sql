@@ -0,0 +1,26 @@
+-- name: CreateProduct :one
+INSERT INTO products (name, description, price)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: GetProduct :one
+SELECT * FROM products
+WHERE product_id = $1 AND deleted_at IS NULL
+LIMIT 1;
+
+-- name: ListProducts :many
+SELECT * FROM products
+WHERE deleted_at IS NULL AND product_id > @after_product_id
+ORDER BY product_id
+LIMIT @page_size;
+
+-- name: UpdateProduct :one
+UPDATE products
+SET name = $2, description = $3, price = $4
+WHERE product_id = $1 AND deleted_at IS NULL
+RETURNING *;
+
+-- name: SoftDeleteProduct :execrows
+UPDATE products
+SET deleted_at = CURRENT_TIMESTAMP
+WHERE product_id = $1 AND deleted_at IS NULL;
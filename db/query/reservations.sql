@@ -0,0 +1,46 @@
+-- name: CreateReservation :one
+INSERT INTO reservations (reservation_id, product_id, warehouse_id, quantity, expires_at)
+VALUES (
+	@reservation_id,
+	@product_id,
+	@warehouse_id,
+	@quantity,
+	CURRENT_TIMESTAMP + make_interval(secs => @ttl_seconds::int)
+)
+ON CONFLICT DO NOTHING
+RETURNING *;
+
+-- name: GetReservationForUpdate :one
+SELECT
+	reservation_id,
+	product_id,
+	warehouse_id,
+	quantity,
+	status,
+	expires_at,
+	(expires_at <= CURRENT_TIMESTAMP)::boolean AS expired
+FROM reservations
+WHERE reservation_id = $1
+FOR UPDATE;
+
+-- name: UpdateReservationStatus :exec
+UPDATE reservations
+SET status = $1
+WHERE reservation_id = $2;
+
+-- name: SumActiveReservations :one
+SELECT COALESCE(SUM(quantity), 0)::int AS reserved
+FROM reservations
+WHERE product_id = $1 AND warehouse_id = $2
+	AND status = 'active' AND expires_at > CURRENT_TIMESTAMP;
+
+-- name: SumActiveReservationsBatch :batchone
+SELECT COALESCE(SUM(quantity), 0)::int AS reserved
+FROM reservations
+WHERE product_id = $1 AND warehouse_id = $2
+	AND status = 'active' AND expires_at > CURRENT_TIMESTAMP;
+
+-- name: ExpireReservations :execrows
+UPDATE reservations
+SET status = 'expired'
+WHERE status = 'active' AND expires_at <= CURRENT_TIMESTAMP;
@@ -0,0 +1,73 @@
+-- name: ListStockLogs :many
+SELECT
+	log_id,
+	previous_stock,
+	updated_stock,
+	updated_stock - previous_stock AS stock_delta,
+	timestamp,
+	transfer_id,
+	is_correction
+FROM stock_logs
+WHERE product_id = @product_id AND warehouse_id = @warehouse_id
+	AND timestamp::timestamptz >= @from_time::timestamptz AND timestamp::timestamptz < @to_time::timestamptz
+	AND log_id > @after_log_id
+ORDER BY log_id
+LIMIT @page_size;
+
+-- name: AggregateStockLogs :many
+SELECT
+	date_trunc(@bucket::text, timestamp)::timestamp AS bucket_start,
+	SUM(updated_stock - previous_stock)::int AS net_change,
+	COUNT(*) AS movements
+FROM stock_logs
+WHERE product_id = @product_id AND warehouse_id = @warehouse_id
+	AND timestamp::timestamptz >= @from_time::timestamptz AND timestamp::timestamptz < @to_time::timestamptz
+GROUP BY bucket_start
+ORDER BY bucket_start;
+
+-- name: ListInventoryDrift :many
+SELECT
+	i.product_id,
+	i.warehouse_id,
+	i.stock_level,
+	l.derived_stock,
+	l.movements
+FROM inventory AS i
+INNER JOIN (
+	SELECT
+		product_id,
+		warehouse_id,
+		((array_agg(previous_stock ORDER BY log_id) FILTER (WHERE NOT is_correction))[1]
+			+ COALESCE(SUM(updated_stock - previous_stock) FILTER (WHERE NOT is_correction), 0))::int AS derived_stock,
+		COUNT(*) AS movements
+	FROM stock_logs
+	WHERE (product_id, warehouse_id) IN (
+		SELECT product_id, warehouse_id FROM stock_logs
+		WHERE (log_id > @after_log_id::int OR timestamp >= @since::timestamp)
+			AND log_id <= @through_log_id::int
+	)
+	GROUP BY product_id, warehouse_id
+) AS l ON l.product_id = i.product_id AND l.warehouse_id = i.warehouse_id
+WHERE i.stock_level <> l.derived_stock
+ORDER BY i.product_id, i.warehouse_id;
+
+-- name: GetLastStockLogID :one
+SELECT COALESCE(MAX(log_id), 0)::int AS last_log_id, LOCALTIMESTAMP::timestamp AS checked_at
+FROM stock_logs;
+
+-- name: GetReconcileCheckpoint :one
+SELECT last_log_id, checked_at
+FROM reconcile_checkpoint;
+
+-- name: UpdateReconcileCheckpoint :exec
+UPDATE reconcile_checkpoint
+SET last_log_id = GREATEST(last_log_id, @last_log_id::int),
+	checked_at = GREATEST(checked_at, @checked_at::timestamp),
+	updated_at = CURRENT_TIMESTAMP;
+
+-- name: GetDerivedStock :one
+SELECT
+	((array_agg(previous_stock ORDER BY log_id) FILTER (WHERE NOT is_correction))[1]
+		+ COALESCE(SUM(updated_stock - previous_stock) FILTER (WHERE NOT is_correction), 0))::int AS derived_stock
+FROM stock_logs
+WHERE product_id = $1 AND warehouse_id = $2;
@@ -0,0 +1,20 @@
+-- name: CreateTransfer :one
+INSERT INTO transfers (transfer_id, product_id, source_warehouse_id, destination_warehouse_id, quantity)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT DO NOTHING
+RETURNING *;
+
+-- name: GetTransfer :one
+SELECT * FROM transfers
+WHERE transfer_id = $1;
+
+-- name: GetTransferForUpdate :one
+SELECT * FROM transfers
+WHERE transfer_id = $1
+FOR UPDATE;
+
+-- name: MarkTransferReceived :one
+UPDATE transfers
+SET status = 'received', received_at = CURRENT_TIMESTAMP
+WHERE transfer_id = $1
+RETURNING *;
@@ -0,0 +1,26 @@
+-- name: CreateWarehouse :one
+INSERT INTO warehouses (name, location)
+VALUES ($1, $2)
+RETURNING *;
+
+-- name: GetWarehouse :one
+SELECT * FROM warehouses
+WHERE warehouse_id = $1 AND deleted_at IS NULL
+LIMIT 1;
+
+-- name: ListWarehouses :many
+SELECT * FROM warehouses
+WHERE deleted_at IS NULL AND warehouse_id > @after_warehouse_id
+ORDER BY warehouse_id
+LIMIT @page_size;
+
+-- name: UpdateWarehouse :one
+UPDATE warehouses
+SET name = $2, location = $3
+WHERE warehouse_id = $1 AND deleted_at IS NULL
+RETURNING *;
+
+-- name: SoftDeleteWarehouse :execrows
+UPDATE warehouses
+SET deleted_at = CURRENT_TIMESTAMP
+WHERE warehouse_id = $1 AND deleted_at IS NULL;
@@ -7,8 +7,85 @@ package db
 
 import (
 	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const adjustInventory = `-- name: AdjustInventory :one
+UPDATE inventory
+SET stock_level = stock_level + $1::int, version = version + 1
+WHERE warehouse_id = $2 AND product_id = $3
+	AND stock_level + $1::int >= 0
+RETURNING (stock_level - $1::int)::int AS previous_stock, stock_level, alert_threshold, version
+`
+
+type AdjustInventoryParams struct {
+	StockDelta  int32
+	WarehouseID int32
+	ProductID   int32
+}
+
+type AdjustInventoryRow struct {
+	PreviousStock  int32
+	StockLevel     int32
+	AlertThreshold int32
+	Version        int64
+}
+
+func (q *Queries) AdjustInventory(ctx context.Context, arg AdjustInventoryParams) (AdjustInventoryRow, error) {
+	row := q.db.QueryRow(ctx, adjustInventory, arg.StockDelta, arg.WarehouseID, arg.ProductID)
+	var i AdjustInventoryRow
+	err := row.Scan(
+		&i.PreviousStock,
+		&i.StockLevel,
+		&i.AlertThreshold,
+		&i.Version,
+	)
+	return i, err
+}
+
+const countInventory = `-- name: CountInventory :one
+SELECT COUNT(*) FROM inventory
+`
+
+func (q *Queries) CountInventory(ctx context.Context) (int64, error) {
+	row := q.db.QueryRow(ctx, countInventory)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createInventory = `-- name: CreateInventory :one
+INSERT INTO inventory (product_id, warehouse_id, stock_level, alert_threshold)
+VALUES ($1, $2, $3, $4)
+RETURNING product_id, warehouse_id, stock_level, alert_threshold, version
+`
+
+type CreateInventoryParams struct {
+	ProductID      int32
+	WarehouseID    int32
+	StockLevel     int32
+	AlertThreshold int32
+}
+
+func (q *Queries) CreateInventory(ctx context.Context, arg CreateInventoryParams) (Inventory, error) {
+	row := q.db.QueryRow(ctx, createInventory,
+		arg.ProductID,
+		arg.WarehouseID,
+		arg.StockLevel,
+		arg.AlertThreshold,
+	)
+	var i Inventory
+	err := row.Scan(
+		&i.ProductID,
+		&i.WarehouseID,
+		&i.StockLevel,
+		&i.AlertThreshold,
+		&i.Version,
+	)
+	return i, err
+}
+
 const getInventory = `-- name: GetInventory :one
 SELECT
 	i.product_id,
@@ -16,7 +93,8 @@ SELECT
 	stock_level,
 	p.name as product_name,
 	w.name as warehouse_name,
-	alert_threshold
+	alert_threshold,
+	version
 FROM inventory AS i
 INNER JOIN products as p on p.product_id = i.product_id
 INNER JOIN warehouses as w on w.warehouse_id = i.warehouse_id
@@ -36,6 +114,7 @@ type GetInventoryRow struct {
 	ProductName    string
 	WarehouseName  string
 	AlertThreshold int32
+	Version        int64
 }
 
 func (q *Queries) GetInventory(ctx context.Context, arg GetInventoryParams) (GetInventoryRow, error) {
@@ -48,13 +127,39 @@ func (q *Queries) GetInventory(ctx context.Context, arg GetInventoryParams) (Get
 		&i.ProductName,
 		&i.WarehouseName,
 		&i.AlertThreshold,
+		&i.Version,
 	)
 	return i, err
 }
 
+const getInventoryForUpdate = `-- name: GetInventoryForUpdate :one
+SELECT stock_level, alert_threshold, version
+FROM inventory
+WHERE warehouse_id = $1 AND product_id = $2
+FOR UPDATE
+`
+
+type GetInventoryForUpdateParams struct {
+	WarehouseID int32
+	ProductID   int32
+}
+
+type GetInventoryForUpdateRow struct {
+	StockLevel     int32
+	AlertThreshold int32
+	Version        int64
+}
+
+func (q *Queries) GetInventoryForUpdate(ctx context.Context, arg GetInventoryForUpdateParams) (GetInventoryForUpdateRow, error) {
+	row := q.db.QueryRow(ctx, getInventoryForUpdate, arg.WarehouseID, arg.ProductID)
+	var i GetInventoryForUpdateRow
+	err := row.Scan(&i.StockLevel, &i.AlertThreshold, &i.Version)
+	return i, err
+}
+
 const insertStockLog = `-- name: InsertStockLog :exec
-INSERT INTO stock_logs (product_id, warehouse_id, previous_stock, updated_stock)
-VALUES ($1, $2, $3, $4)
+INSERT INTO stock_logs (product_id, warehouse_id, previous_stock, updated_stock, transfer_id, is_correction)
+VALUES ($1, $2, $3, $4, $5, $6)
 `
 
 type InsertStockLogParams struct {
@@ -62,6 +167,8 @@ type InsertStockLogParams struct {
 	WarehouseID   int32
 	PreviousStock int32
 	UpdatedStock  int32
+	TransferID    pgtype.Text
+	IsCorrection  bool
 }
 
 func (q *Queries) InsertStockLog(ctx context.Context, arg InsertStockLogParams) error {
@@ -70,14 +177,189 @@ func (q *Queries) InsertStockLog(ctx context.Context, arg InsertStockLogParams)
 		arg.WarehouseID,
 		arg.PreviousStock,
 		arg.UpdatedStock,
+		arg.TransferID,
+		arg.IsCorrection,
 	)
 	return err
 }
 
-const updateInventory = `-- name: UpdateInventory :exec
+const listInventory = `-- name: ListInventory :many
+SELECT
+	i.product_id,
+	i.warehouse_id,
+	stock_level,
+	p.name as product_name,
+	w.name as warehouse_name,
+	alert_threshold
+FROM inventory AS i
+INNER JOIN products as p on p.product_id = i.product_id
+INNER JOIN warehouses as w on w.warehouse_id = i.warehouse_id
+WHERE p.deleted_at IS NULL AND w.deleted_at IS NULL
+	AND ($1::int IS NULL OR i.warehouse_id = $1)
+	AND ($2::int IS NULL OR i.product_id = $2)
+	AND (NOT $3::boolean OR i.stock_level < i.alert_threshold)
+	AND (
+		NOT $4::boolean
+		OR (
+			CASE $5::text
+				WHEN 'stock_level' THEN i.stock_level
+				WHEN 'warehouse_id' THEN i.warehouse_id
+				ELSE i.product_id
+			END * $6::int,
+			i.product_id * $6::int,
+			i.warehouse_id * $6::int
+		) > ($7::int, $8::int, $9::int)
+	)
+ORDER BY
+	CASE $5::text
+		WHEN 'stock_level' THEN i.stock_level
+		WHEN 'warehouse_id' THEN i.warehouse_id
+		ELSE i.product_id
+	END * $6::int,
+	i.product_id * $6::int,
+	i.warehouse_id * $6::int
+LIMIT $10::int
+`
+
+type ListInventoryParams struct {
+	WarehouseID        pgtype.Int4
+	ProductID          pgtype.Int4
+	BelowThreshold     bool
+	HasCursor          bool
+	SortBy             string
+	Direction          int32
+	CursorSortKey      int32
+	CursorProductKey   int32
+	CursorWarehouseKey int32
+	PageSize           int32
+}
+
+type ListInventoryRow struct {
+	ProductID      int32
+	WarehouseID    int32
+	StockLevel     int32
+	ProductName    string
+	WarehouseName  string
+	AlertThreshold int32
+}
+
+func (q *Queries) ListInventory(ctx context.Context, arg ListInventoryParams) ([]ListInventoryRow, error) {
+	rows, err := q.db.Query(ctx, listInventory,
+		arg.WarehouseID,
+		arg.ProductID,
+		arg.BelowThreshold,
+		arg.HasCursor,
+		arg.SortBy,
+		arg.Direction,
+		arg.CursorSortKey,
+		arg.CursorProductKey,
+		arg.CursorWarehouseKey,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListInventoryRow
+	for rows.Next() {
+		var i ListInventoryRow
+		if err := rows.Scan(
+			&i.ProductID,
+			&i.WarehouseID,
+			&i.StockLevel,
+			&i.ProductName,
+			&i.WarehouseName,
+			&i.AlertThreshold,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listInventoryAfter = `-- name: ListInventoryAfter :many
+SELECT product_id, warehouse_id, stock_level, alert_threshold, version
+FROM inventory
+WHERE (product_id, warehouse_id) > ($1::int, $2::int)
+ORDER BY product_id, warehouse_id
+LIMIT $3::int
+`
+
+type ListInventoryAfterParams struct {
+	AfterProductID   int32
+	AfterWarehouseID int32
+	PageSize         int32
+}
+
+type ListInventoryAfterRow struct {
+	ProductID      int32
+	WarehouseID    int32
+	StockLevel     int32
+	AlertThreshold int32
+	Version        int64
+}
+
+func (q *Queries) ListInventoryAfter(ctx context.Context, arg ListInventoryAfterParams) ([]ListInventoryAfterRow, error) {
+	rows, err := q.db.Query(ctx, listInventoryAfter, arg.AfterProductID, arg.AfterWarehouseID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListInventoryAfterRow
+	for rows.Next() {
+		var i ListInventoryAfterRow
+		if err := rows.Scan(
+			&i.ProductID,
+			&i.WarehouseID,
+			&i.StockLevel,
+			&i.AlertThreshold,
+			&i.Version,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateAlertThreshold = `-- name: UpdateAlertThreshold :one
+UPDATE inventory
+SET alert_threshold = $1, version = version + 1
+WHERE warehouse_id = $2 AND product_id = $3
+RETURNING stock_level, alert_threshold, version
+`
+
+type UpdateAlertThresholdParams struct {
+	AlertThreshold int32
+	WarehouseID    int32
+	ProductID      int32
+}
+
+type UpdateAlertThresholdRow struct {
+	StockLevel     int32
+	AlertThreshold int32
+	Version        int64
+}
+
+func (q *Queries) UpdateAlertThreshold(ctx context.Context, arg UpdateAlertThresholdParams) (UpdateAlertThresholdRow, error) {
+	row := q.db.QueryRow(ctx, updateAlertThreshold, arg.AlertThreshold, arg.WarehouseID, arg.ProductID)
+	var i UpdateAlertThresholdRow
+	err := row.Scan(&i.StockLevel, &i.AlertThreshold, &i.Version)
+	return i, err
+}
+
+const updateInventory = `-- name: UpdateInventory :one
 UPDATE inventory
-SET stock_level = $1
+SET stock_level = $1, version = version + 1
 WHERE warehouse_id = $2 AND product_id = $3
+RETURNING alert_threshold, version
 `
 
 type UpdateInventoryParams struct {
@@ -86,7 +368,14 @@ type UpdateInventoryParams struct {
 	ProductID   int32
 }
 
-func (q *Queries) UpdateInventory(ctx context.Context, arg UpdateInventoryParams) error {
-	_, err := q.db.Exec(ctx, updateInventory, arg.StockLevel, arg.WarehouseID, arg.ProductID)
-	return err
+type UpdateInventoryRow struct {
+	AlertThreshold int32
+	Version        int64
+}
+
+func (q *Queries) UpdateInventory(ctx context.Context, arg UpdateInventoryParams) (UpdateInventoryRow, error) {
+	row := q.db.QueryRow(ctx, updateInventory, arg.StockLevel, arg.WarehouseID, arg.ProductID)
+	var i UpdateInventoryRow
+	err := row.Scan(&i.AlertThreshold, &i.Version)
+	return i, err
 }
@@ -13,6 +13,24 @@ type Inventory struct {
 	WarehouseID    int32
 	StockLevel     int32
 	AlertThreshold int32
+	Version        int64
+}
+
+type Outbox struct {
+	OutboxID   int64
+	Topic      string
+	MessageKey string
+	Payload    []byte
+	CreatedAt  pgtype.Timestamp
+	SentAt     pgtype.Timestamp
+}
+
+type ProcessedMessage struct {
+	MessageKey     string
+	ProcessedAt    pgtype.Timestamp
+	KafkaTopic     string
+	KafkaPartition int32
+	KafkaOffset    int64
 }
 
 type Product struct {
@@ -20,6 +38,24 @@ type Product struct {
 	Name        string
 	Description pgtype.Text
 	Price       pgtype.Numeric
+	DeletedAt   pgtype.Timestamp
+}
+
+type ReconcileCheckpoint struct {
+	ID        bool
+	LastLogID int32
+	UpdatedAt pgtype.Timestamp
+	CheckedAt pgtype.Timestamp
+}
+
+type Reservation struct {
+	ReservationID string
+	ProductID     int32
+	WarehouseID   int32
+	Quantity      int32
+	Status        string
+	ExpiresAt     pgtype.Timestamp
+	CreatedAt     pgtype.Timestamp
 }
 
 type StockLog struct {
@@ -29,10 +65,24 @@ type StockLog struct {
 	PreviousStock int32
 	UpdatedStock  int32
 	Timestamp     pgtype.Timestamp
+	TransferID    pgtype.Text
+	IsCorrection  bool
+}
+
+type Transfer struct {
+	TransferID             string
+	ProductID              int32
+	SourceWarehouseID      int32
+	DestinationWarehouseID int32
+	Quantity               int32
+	Status                 string
+	DispatchedAt           pgtype.Timestamp
+	ReceivedAt             pgtype.Timestamp
 }
 
 type Warehouse struct {
 	WarehouseID int32
 	Name        string
 	Location    pgtype.Text
+	DeletedAt   pgtype.Timestamp
 }
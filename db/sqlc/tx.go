@@ -0,0 +1,50 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TxBeginner starts database transactions, it is satisfied by pgxpool.Pool
+type TxBeginner interface {
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+// TxObserver is told how long a transaction took and the error it ended with, nil if it committed
+type TxObserver func(d time.Duration, err error)
+
+// ExecTx runs fn with Queries bound to a new transaction. The transaction is committed if fn
+// succeeds and rolled back otherwise. observe is called once the transaction is over unless it is nil
+func ExecTx(ctx context.Context, conn TxBeginner, observe TxObserver, fn func(*Queries) error) (err error) {
+	if observe != nil {
+		start := time.Now()
+		defer func() {
+			observe(time.Since(start), err)
+		}()
+	}
+
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("error initiating transaction, %w", err)
+	}
+
+	if err = fn(New(tx)); err != nil {
+		if txErr := tx.Rollback(ctx); txErr != nil {
+			return fmt.Errorf(
+				"tried to roll back transaction due to error %w, error rolling back the transaction: %v",
+				err, txErr,
+			)
+		}
+
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing to DB: %w", err)
+	}
+
+	return nil
+}
@@ -3,24 +3,43 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/IBM/sarama"
 	sqlc "github.com/achere/heroku-kafka-demo-go/db/sqlc"
+	"github.com/achere/heroku-kafka-demo-go/internal/codec"
 	"github.com/achere/heroku-kafka-demo-go/internal/config"
 	"github.com/achere/heroku-kafka-demo-go/internal/inventory"
+	"github.com/achere/heroku-kafka-demo-go/internal/ledger"
+	"github.com/achere/heroku-kafka-demo-go/internal/schema"
 	"github.com/achere/heroku-kafka-demo-go/internal/transport"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-type LowStockAlert struct {
-	ProductID    int `json:"product_id"`
-	WarehouseID  int `json:"warehouse_id"`
-	CurrentStock int `json:"current_stock"`
-	Threshold    int `json:"threshold"`
+// Message types on the stock-updates topic, which are the subjects of their payload schemas as well.
+// Bare messages without a type are stock updates
+const (
+	MessageTypeStockUpdate        = "stock_update"
+	MessageTypeThresholdUpdate    = "threshold_update"
+	MessageTypeReservationCreate  = "reservation_create"
+	MessageTypeReservationConfirm = "reservation_confirm"
+	MessageTypeReservationRelease = "reservation_release"
+	MessageTypeTransfer           = "transfer"
+	MessageTypeTransferReceive    = "transfer_receive"
+)
+
+// messageHeader holds the fields bare messages without an envelope carry besides their payload
+type messageHeader struct {
+	Type      string `json:"type,omitempty"`
+	MessageID string `json:"message_id,omitempty"`
 }
 
 type StockUpdate struct {
@@ -29,13 +48,75 @@ type StockUpdate struct {
 	StockDelta  int `json:"stock_delta"`
 }
 
+type ThresholdUpdate struct {
+	ProductID      int `json:"product_id"`
+	WarehouseID    int `json:"warehouse_id"`
+	AlertThreshold int `json:"alert_threshold"`
+}
+
+// ReservationCommand creates, confirms or releases a reservation depending on the message type. Only
+// the reservation ID is used to confirm or release one
+type ReservationCommand struct {
+	ReservationID string `json:"reservation_id"`
+	ProductID     int    `json:"product_id,omitempty"`
+	WarehouseID   int    `json:"warehouse_id,omitempty"`
+	Quantity      int    `json:"quantity,omitempty"`
+	TTLSeconds    int    `json:"ttl_seconds,omitempty"`
+}
+
+// TransferCommand moves stock between warehouses, or only dispatches it when InTransit is set. Only the
+// transfer ID is used to receive an in-transit transfer
+type TransferCommand struct {
+	TransferID             string `json:"transfer_id"`
+	ProductID              int    `json:"product_id,omitempty"`
+	SourceWarehouseID      int    `json:"source_warehouse_id,omitempty"`
+	DestinationWarehouseID int    `json:"destination_warehouse_id,omitempty"`
+	Quantity               int    `json:"quantity,omitempty"`
+	InTransit              bool   `json:"in_transit,omitempty"`
+}
+
+// messageKey returns the key a message is deduplicated on: the ID of its envelope or the producer
+// supplied message ID of a bare message if there is one, otherwise the topic, partition and offset it was consumed from
+func messageKey(cm *sarama.ConsumerMessage, messageID string) string {
+	if messageID != "" {
+		return "id:" + messageID
+	}
+
+	return fmt.Sprintf("offset:%s:%d:%d", cm.Topic, cm.Partition, cm.Offset)
+}
+
+// messageApplier applies a decoded message to the database within a transaction, writing to a cache
+// that is only updated once the transaction commits
+type messageApplier func(q *sqlc.Queries, c inventory.Cache) error
+
+// decodedMessage is a message on the stock-updates topic ready to be applied
+type decodedMessage struct {
+	key   string
+	apply messageApplier
+	// stockUpdate is only set for stock updates, they are applied together when consuming in batches
+	stockUpdate *StockUpdate
+}
+
+// stockMessageHandler decodes messages on the stock-updates topic into messageAppliers
+type stockMessageHandler struct {
+	ctx       context.Context
+	appconfig *config.AppConfig
+	schemas   *schema.Validator
+	codecs    *codec.Registry
+	alerts    *inventory.AlertProducer
+}
+
 func newStockUpdateHandler(
 	ctx context.Context,
 	appconfig *config.AppConfig,
-	client *transport.KafkaClient,
 	dbpool *pgxpool.Pool,
 	cache inventory.Cache,
+	schemas *schema.Validator,
+	codecs *codec.Registry,
+	alerts *inventory.AlertProducer,
 ) transport.MessageHandlerFunc {
+	h := &stockMessageHandler{ctx: ctx, appconfig: appconfig, schemas: schemas, codecs: codecs, alerts: alerts}
+
 	return func(cm *sarama.ConsumerMessage) error {
 		slog.Info(
 			"handling msg",
@@ -44,60 +125,441 @@ func newStockUpdateHandler(
 			"value", cm.Value,
 		)
 
-		var su StockUpdate
-		err := json.Unmarshal(cm.Value, &su)
+		msg, err := h.decode(cm)
 		if err != nil {
-			return fmt.Errorf("error unmarshalling stock update: %v", err)
+			return err
+		}
+
+		return applyOnce(ctx, dbpool, cache, cm, msg.key, msg.apply)
+	}
+}
+
+// newStockUpdateBatchHandler applies a batch of messages in a single transaction. Stock updates are
+// applied with one round trip per statement for all of them, other messages one at a time in between
+func newStockUpdateBatchHandler(
+	ctx context.Context,
+	appconfig *config.AppConfig,
+	dbpool *pgxpool.Pool,
+	cache inventory.Cache,
+	schemas *schema.Validator,
+	codecs *codec.Registry,
+	alerts *inventory.AlertProducer,
+) transport.MessageBatchHandlerFunc {
+	h := &stockMessageHandler{ctx: ctx, appconfig: appconfig, schemas: schemas, codecs: codecs, alerts: alerts}
+
+	return func(cms []*sarama.ConsumerMessage) error {
+		slog.Info(
+			"handling batch",
+			"topic", cms[0].Topic,
+			"partition", cms[0].Partition,
+			"first_offset", cms[0].Offset,
+			"count", len(cms),
+		)
+
+		msgs := make([]decodedMessage, len(cms))
+		for i, cm := range cms {
+			msg, err := h.decode(cm)
+			if err != nil {
+				return fmt.Errorf("error decoding msg at offset %d: %w", cm.Offset, err)
+			}
+			msgs[i] = msg
 		}
 
-		// TODO: extract transaction handling to db package? Pass return variables in a closure
-		tx, err := dbpool.BeginTx(ctx, pgx.TxOptions{})
+		return inventory.ExecTx(ctx, dbpool, cache, func(q *sqlc.Queries, c inventory.Cache) error {
+			return h.applyBatch(q, c, cms, msgs)
+		})
+	}
+}
+
+// decode parses a message into the key it is deduplicated on and the function applying it
+func (h *stockMessageHandler) decode(cm *sarama.ConsumerMessage) (decodedMessage, error) {
+	env, err := h.unwrap(cm)
+	if err != nil {
+		return decodedMessage{}, err
+	}
+
+	msg := decodedMessage{key: messageKey(cm, env.ID)}
+
+	switch env.Type {
+	case MessageTypeStockUpdate:
+		var su StockUpdate
+		if err := json.Unmarshal(env.Payload, &su); err != nil {
+			return decodedMessage{}, fmt.Errorf("error unmarshalling stock update: %v", err)
+		}
+		msg.apply, msg.stockUpdate = h.stockUpdate(su), &su
+	case MessageTypeThresholdUpdate:
+		msg.apply, err = h.thresholdUpdate(env.Payload)
+	case MessageTypeReservationCreate, MessageTypeReservationConfirm, MessageTypeReservationRelease:
+		msg.apply, err = h.reservation(env.Type, env.Payload)
+	case MessageTypeTransfer, MessageTypeTransferReceive:
+		msg.apply, err = h.transfer(env.Type, env.Payload)
+	default:
+		err = fmt.Errorf("unknown message type %q", env.Type)
+	}
+	if err != nil {
+		return decodedMessage{}, err
+	}
+
+	return msg, nil
+}
+
+// unwrap decodes a message with the codec its content-type header or the config selects and returns
+// its envelope after validating it and its payload against their schemas. Bare messages are given a
+// version 1 envelope with the type and ID taken from their type and message_id fields, which are not
+// part of the payload
+func (h *stockMessageHandler) unwrap(cm *sarama.ConsumerMessage) (schema.Envelope, error) {
+	c, err := h.codecs.ForMessage(cm.Headers)
+	if err != nil {
+		return schema.Envelope{}, err
+	}
+
+	data, err := c.Decode(cm.Value)
+	if err != nil {
+		return schema.Envelope{}, fmt.Errorf("error decoding %s message: %w", c.Name(), err)
+	}
+
+	if schema.IsEnvelope(data) {
+		return h.schemas.Decode(h.ctx, data)
+	}
+
+	if !h.appconfig.Schema.AllowBareMessages {
+		return schema.Envelope{}, errors.New("message has no envelope")
+	}
+
+	var header messageHeader
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &header); err != nil {
+		return schema.Envelope{}, fmt.Errorf("error unmarshalling message: %v", err)
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return schema.Envelope{}, fmt.Errorf("error unmarshalling message: %v", err)
+	}
+	delete(fields, "type")
+	delete(fields, "message_id")
+
+	payload, err := json.Marshal(fields)
+	if err != nil {
+		return schema.Envelope{}, fmt.Errorf("error marshalling payload: %v", err)
+	}
+
+	env := schema.Envelope{Type: header.Type, Version: 1, ID: header.MessageID, Payload: payload}
+	if env.Type == "" {
+		env.Type = MessageTypeStockUpdate
+	}
+
+	if err := h.schemas.Validate(h.ctx, env.Type, env.Version, env.Payload); err != nil {
+		return schema.Envelope{}, err
+	}
+
+	return env, nil
+}
+
+// applyBatch records the keys of a batch of messages and applies the ones not processed before in
+// order, collecting consecutive stock updates into a single inventory.UpdateInventoryBatch
+func (h *stockMessageHandler) applyBatch(
+	q *sqlc.Queries,
+	c inventory.Cache,
+	cms []*sarama.ConsumerMessage,
+	msgs []decodedMessage,
+) error {
+	entries := make([]sqlc.InsertProcessedMessageBatchParams, len(msgs))
+	for i, msg := range msgs {
+		entries[i] = sqlc.InsertProcessedMessageBatchParams(ledger.Params(cms[i], msg.key))
+	}
+
+	duplicate := make([]bool, len(msgs))
+	var err error
+	q.InsertProcessedMessageBatch(h.ctx, entries).QueryRow(func(i int, _ string, rowErr error) {
+		switch {
+		case errors.Is(rowErr, pgx.ErrNoRows):
+			duplicate[i] = true
+		case rowErr != nil && err == nil:
+			err = fmt.Errorf("error recording processed message: %w", rowErr)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	var changes []inventory.StockChange
+	flush := func() error {
+		if len(changes) == 0 {
+			return nil
+		}
+
+		levels, err := inventory.UpdateInventoryBatch(h.ctx, q, c, changes)
+		changes = changes[:0]
 		if err != nil {
-			return fmt.Errorf("error initiating transaction, %v", err)
+			return fmt.Errorf("error updating stock: %w", err)
+		}
+
+		for _, l := range levels {
+			_, err = h.alerts.Enqueue(
+				h.ctx, q, l.ProductID, l.WarehouseID, l.Stock, l.Threshold,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i, msg := range msgs {
+		if duplicate[i] {
+			logDuplicate(cms[i], msg.key)
+			continue
+		}
+
+		if su := msg.stockUpdate; su != nil {
+			changes = append(changes, inventory.StockChange{
+				ProductID:   su.ProductID,
+				WarehouseID: su.WarehouseID,
+				Delta:       su.StockDelta,
+			})
+			continue
+		}
+
+		if err := flush(); err != nil {
+			return err
+		}
+
+		if err := msg.apply(q, c); err != nil {
+			return err
 		}
+	}
+
+	return flush()
+}
 
+func (h *stockMessageHandler) stockUpdate(su StockUpdate) messageApplier {
+	return func(q *sqlc.Queries, c inventory.Cache) error {
 		stock, threshold, err := inventory.UpdateInventory(
-			su.ProductID, su.WarehouseID, su.StockDelta, sqlc.New(tx), ctx, cache,
+			su.ProductID, su.WarehouseID, su.StockDelta, q, h.ctx, c,
 		)
 		if err != nil {
-			if txErr := tx.Rollback(ctx); txErr != nil {
-				return fmt.Errorf(
-					"tried to roll back transaction due to error updating stock %v, error rolling back the transaction: %v",
-					err, txErr,
-				)
-			}
+			return fmt.Errorf("error updating stock: %w", err)
+		}
+
+		_, err = h.alerts.Enqueue(
+			h.ctx, q, su.ProductID, su.WarehouseID, stock, threshold,
+		)
+		return err
+	}
+}
+
+func (h *stockMessageHandler) thresholdUpdate(value []byte) (messageApplier, error) {
+	var tu ThresholdUpdate
+	if err := json.Unmarshal(value, &tu); err != nil {
+		return nil, fmt.Errorf("error unmarshalling threshold update: %v", err)
+	}
+
+	// values that don't fit the int32 inventory columns are dead-lettered without applying the update
+	if tu.ProductID <= 0 || tu.WarehouseID <= 0 || tu.ProductID > math.MaxInt32 || tu.WarehouseID > math.MaxInt32 {
+		return nil, fmt.Errorf("invalid product %d or warehouse %d", tu.ProductID, tu.WarehouseID)
+	}
+
+	if tu.AlertThreshold < 0 || tu.AlertThreshold > math.MaxInt32 {
+		return nil, fmt.Errorf("invalid alert threshold %d", tu.AlertThreshold)
+	}
+
+	return func(q *sqlc.Queries, c inventory.Cache) error {
+		stock, err := inventory.UpdateThreshold(
+			h.ctx, q, c, tu.ProductID, tu.WarehouseID, tu.AlertThreshold,
+		)
+		if err != nil {
+			return fmt.Errorf("error updating alert threshold: %w", err)
+		}
+
+		_, err = h.alerts.Enqueue(
+			h.ctx, q, tu.ProductID, tu.WarehouseID, stock, tu.AlertThreshold,
+		)
+		return err
+	}, nil
+}
 
-			return fmt.Errorf("error updating stock: %v", err)
+func (h *stockMessageHandler) reservation(msgType string, value []byte) (messageApplier, error) {
+	var rc ReservationCommand
+	if err := json.Unmarshal(value, &rc); err != nil {
+		return nil, fmt.Errorf("error unmarshalling reservation: %v", err)
+	}
+
+	if rc.ReservationID == "" {
+		return nil, errors.New("reservation_id is required")
+	}
+
+	switch msgType {
+	case MessageTypeReservationCreate:
+		ttl := h.appconfig.Reservation.DefaultTTL
+		if rc.TTLSeconds != 0 {
+			ttl = time.Duration(rc.TTLSeconds) * time.Second
+		}
+
+		if rc.ProductID <= 0 || rc.WarehouseID <= 0 || rc.ProductID > math.MaxInt32 || rc.WarehouseID > math.MaxInt32 {
+			return nil, fmt.Errorf("invalid product %d or warehouse %d", rc.ProductID, rc.WarehouseID)
 		}
 
-		if err = tx.Commit(ctx); err != nil {
-			return fmt.Errorf("error committing to DB: %v", err)
+		if rc.Quantity <= 0 || rc.Quantity > math.MaxInt32 || ttl <= 0 || ttl > h.appconfig.Reservation.MaxTTL {
+			return nil, fmt.Errorf("invalid reservation quantity %d or ttl %s", rc.Quantity, ttl)
 		}
 
-		if stock < threshold {
-			alert := LowStockAlert{
-				ProductID:    su.ProductID,
-				WarehouseID:  su.WarehouseID,
-				CurrentStock: stock,
-				Threshold:    threshold,
+		return func(q *sqlc.Queries, c inventory.Cache) error {
+			_, _, err := inventory.Reserve(
+				h.ctx, q, rc.ReservationID, rc.ProductID, rc.WarehouseID, rc.Quantity, ttl,
+			)
+			if err != nil {
+				return fmt.Errorf("error creating reservation: %w", err)
 			}
-			alertMessage, err := json.Marshal(alert)
+			return nil
+		}, nil
+	case MessageTypeReservationConfirm:
+		return func(q *sqlc.Queries, c inventory.Cache) error {
+			res, stock, threshold, err := inventory.ConfirmReservation(h.ctx, q, c, rc.ReservationID)
 			if err != nil {
-				return fmt.Errorf("error marshalling low-stock alert: %v", err)
+				return fmt.Errorf("error confirming reservation: %w", err)
 			}
 
-			topic := appconfig.ProducerTopic()
-			value := sarama.ByteEncoder(alertMessage)
+			_, err = h.alerts.Enqueue(
+				h.ctx, q, int(res.ProductID), int(res.WarehouseID), stock, threshold,
+			)
+			return err
+		}, nil
+	default:
+		return func(q *sqlc.Queries, c inventory.Cache) error {
+			if _, err := inventory.ReleaseReservation(h.ctx, q, rc.ReservationID); err != nil {
+				return fmt.Errorf("error releasing reservation: %w", err)
+			}
+			return nil
+		}, nil
+	}
+}
 
-			err = client.SendMessage(topic, "", value)
+func (h *stockMessageHandler) transfer(msgType string, value []byte) (messageApplier, error) {
+	var tc TransferCommand
+	if err := json.Unmarshal(value, &tc); err != nil {
+		return nil, fmt.Errorf("error unmarshalling transfer: %v", err)
+	}
+
+	if tc.TransferID == "" {
+		return nil, errors.New("transfer_id is required")
+	}
+
+	if msgType == MessageTypeTransfer {
+		if tc.ProductID <= 0 || tc.ProductID > math.MaxInt32 ||
+			tc.SourceWarehouseID <= 0 || tc.SourceWarehouseID > math.MaxInt32 ||
+			tc.DestinationWarehouseID <= 0 || tc.DestinationWarehouseID > math.MaxInt32 {
+			return nil, fmt.Errorf("invalid product %d or warehouses %d and %d",
+				tc.ProductID, tc.SourceWarehouseID, tc.DestinationWarehouseID)
+		}
+
+		if tc.Quantity <= 0 || tc.Quantity > math.MaxInt32 {
+			return nil, fmt.Errorf("invalid transfer quantity %d", tc.Quantity)
+		}
+	}
+
+	return func(q *sqlc.Queries, c inventory.Cache) error {
+		var productID int
+		var legs []inventory.TransferLeg
+		var err error
+
+		switch {
+		case msgType == MessageTypeTransferReceive:
+			var t sqlc.Transfer
+			var leg inventory.TransferLeg
+			t, leg, err = inventory.ReceiveTransfer(h.ctx, q, c, tc.TransferID)
+			productID, legs = int(t.ProductID), []inventory.TransferLeg{leg}
+		case tc.InTransit:
+			var leg inventory.TransferLeg
+			_, leg, err = inventory.DispatchTransfer(
+				h.ctx, q, c, tc.TransferID, tc.ProductID, tc.SourceWarehouseID, tc.DestinationWarehouseID, tc.Quantity,
+			)
+			productID, legs = tc.ProductID, []inventory.TransferLeg{leg}
+		default:
+			_, legs, err = inventory.Transfer(
+				h.ctx, q, c, tc.TransferID, tc.ProductID, tc.SourceWarehouseID, tc.DestinationWarehouseID, tc.Quantity,
+			)
+			productID = tc.ProductID
+		}
+		if err != nil {
+			return fmt.Errorf("error applying transfer: %w", err)
+		}
+
+		for _, leg := range legs {
+			_, err = h.alerts.Enqueue(
+				h.ctx, q, productID, leg.WarehouseID, leg.Stock, leg.Threshold,
+			)
 			if err != nil {
-				return fmt.Errorf("error sending low-stock alert: %v", err)
-			} else {
-				slog.Info("alert sent", "topic", topic, "value", value)
+				return err
 			}
 		}
+
 		return nil
+	}, nil
+}
+
+// applyOnce runs apply in a transaction unless a message with the same key was already processed.
+// The key is recorded in the same transaction, so a redelivered message is acknowledged and skipped
+func applyOnce(
+	ctx context.Context,
+	dbpool *pgxpool.Pool,
+	cache inventory.Cache,
+	cm *sarama.ConsumerMessage,
+	key string,
+	apply messageApplier,
+) error {
+	duplicate := false
+
+	err := inventory.ExecTx(ctx, dbpool, cache, func(q *sqlc.Queries, c inventory.Cache) error {
+		var err error
+		if duplicate, err = ledger.Record(ctx, q, cm, key); err != nil || duplicate {
+			return err
+		}
+
+		return apply(q, c)
+	})
+	if err != nil {
+		return err
+	}
+
+	if duplicate {
+		logDuplicate(cm, key)
 	}
+
+	return nil
+}
+
+func logDuplicate(cm *sarama.ConsumerMessage, key string) {
+	slog.Info(
+		"duplicate msg, skipping",
+		"topic", cm.Topic,
+		"partition", cm.Partition,
+		"offset", cm.Offset,
+		"message_key", key,
+	)
+}
+
+// isTransientError reports whether handling a message failed for a reason that may go away on a
+// retry, such as a lost connection or a serialization failure, as opposed to a bad message
+func isTransientError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, schema.ErrRegistryUnavailable) ||
+		pgconn.Timeout(err) || pgconn.SafeToRetry(err) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == "40001", // serialization_failure
+			pgErr.Code == "40P01",                // deadlock_detected
+			strings.HasPrefix(pgErr.Code, "08"),  // connection_exception
+			strings.HasPrefix(pgErr.Code, "57P"): // operator_intervention, e.g. admin_shutdown
+			return true
+		default:
+			return false
+		}
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
 }
 
 type CachePlaceholder struct{}
@@ -107,8 +569,13 @@ func (cp *CachePlaceholder) Get(ctx context.Context, key string) (string, error)
 	return "", nil
 }
 
-func (cp *CachePlaceholder) Set(ctx context.Context, key, value string, expiration time.Duration) error {
-	slog.Info("set cache", "key", key, "value", value)
+func (cp *CachePlaceholder) Set(ctx context.Context, key, value string, version int64) error {
+	slog.Info("set cache", "key", key, "value", value, "version", version)
+	return nil
+}
+
+func (cp *CachePlaceholder) Delete(ctx context.Context, key string) error {
+	slog.Info("delete from cache", "key", key)
 	return nil
 }
 
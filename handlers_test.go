@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+func TestMessageKey(t *testing.T) {
+	cm := &sarama.ConsumerMessage{Topic: "stock-updates", Partition: 2, Offset: 42}
+
+	key := messageKey(cm, "abc")
+	if key != "id:abc" {
+		t.Errorf("Expected id:abc, got %s", key)
+	}
+
+	key = messageKey(cm, "")
+	if key != "offset:stock-updates:2:42" {
+		t.Errorf("Expected offset:stock-updates:2:42, got %s", key)
+	}
+
+	// a redelivery of the same offset is keyed the same, another offset is not
+	if messageKey(cm, "") != key {
+		t.Errorf("Expected a redelivered message to have the same key")
+	}
+
+	other := &sarama.ConsumerMessage{Topic: "stock-updates", Partition: 2, Offset: 43}
+	if messageKey(other, "") == key {
+		t.Errorf("Expected messages at different offsets to have different keys")
+	}
+}
+
+func TestThresholdUpdateRange(t *testing.T) {
+	h := &stockMessageHandler{}
+
+	if _, err := h.thresholdUpdate([]byte(`{"product_id":1,"warehouse_id":1,"alert_threshold":5}`)); err != nil {
+		t.Errorf("Expected a valid threshold update, got %s", err)
+	}
+
+	// rejected when decoding, so they are dead-lettered rather than applied
+	invalid := map[string]string{
+		"negative threshold":    `{"product_id":1,"warehouse_id":1,"alert_threshold":-1}`,
+		"threshold above int32": `{"product_id":1,"warehouse_id":1,"alert_threshold":2147483648}`,
+		"product above int32":   `{"product_id":4294967297,"warehouse_id":1,"alert_threshold":5}`,
+	}
+
+	for name, value := range invalid {
+		if _, err := h.thresholdUpdate([]byte(value)); err == nil {
+			t.Errorf("Expected an error for a %s", name)
+		}
+	}
+}
+
+func TestTransferRange(t *testing.T) {
+	h := &stockMessageHandler{}
+
+	valid := `{"transfer_id":"t-1","product_id":1,"source_warehouse_id":1,"destination_warehouse_id":2,"quantity":5}`
+	if _, err := h.transfer(MessageTypeTransfer, []byte(valid)); err != nil {
+		t.Errorf("Expected a valid transfer, got %s", err)
+	}
+
+	// rejected when decoding, so they are dead-lettered rather than applied
+	invalid := map[string]string{
+		"zero quantity":        `{"transfer_id":"t-1","product_id":1,"source_warehouse_id":1,"destination_warehouse_id":2,"quantity":0}`,
+		"quantity above int32": `{"transfer_id":"t-1","product_id":1,"source_warehouse_id":1,"destination_warehouse_id":2,"quantity":2147483648}`,
+		"source above int32":   `{"transfer_id":"t-1","product_id":1,"source_warehouse_id":4294967297,"destination_warehouse_id":2,"quantity":5}`,
+	}
+
+	for name, value := range invalid {
+		if _, err := h.transfer(MessageTypeTransfer, []byte(value)); err == nil {
+			t.Errorf("Expected an error for a %s", name)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+
+	sqlc "github.com/achere/heroku-kafka-demo-go/db/sqlc"
+	"github.com/achere/heroku-kafka-demo-go/internal/inventory"
+	"github.com/jackc/pgx/v5"
+)
+
+// MaxAdjustments is the maximum number of lines accepted in a single batch of stock adjustments
+const MaxAdjustments = 1000
+
+// StockAdjustment is a single line of a batch of stock adjustments
+type StockAdjustment struct {
+	ProductID   int `json:"product_id"`
+	WarehouseID int `json:"warehouse_id"`
+	StockDelta  int `json:"stock_delta"`
+}
+
+// HandlePostAdjustments applies a batch of stock adjustments in a single transaction and responds
+// with the resulting stock of every line. Nothing is applied if any line would make stock negative
+func (h *InventoryHandler) HandlePostAdjustments(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var adjustments []StockAdjustment
+	if err := json.NewDecoder(r.Body).Decode(&adjustments); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(adjustments) == 0 || len(adjustments) > MaxAdjustments {
+		http.Error(w, fmt.Sprintf("Batch must contain between 1 and %d adjustments", MaxAdjustments), http.StatusBadRequest)
+		return
+	}
+
+	// deltas are range checked here rather than by UpdateInventory so a bad batch is rejected before
+	// the transaction starts
+	for i, adj := range adjustments {
+		if !validID(adj.ProductID) || !validID(adj.WarehouseID) {
+			http.Error(w, fmt.Sprintf("Invalid product_id or warehouse_id on line %d", i), http.StatusBadRequest)
+			return
+		}
+
+		if adj.StockDelta < math.MinInt32 || adj.StockDelta > math.MaxInt32 {
+			http.Error(w, fmt.Sprintf("stock_delta out of range on line %d", i), http.StatusBadRequest)
+			return
+		}
+	}
+
+	results := make([]Inventory, len(adjustments))
+	err := inventory.ExecTx(ctx, h.db, h.cache, func(q *sqlc.Queries, c inventory.Cache) error {
+		for i, adj := range adjustments {
+			stock, threshold, err := inventory.UpdateInventory(
+				adj.ProductID, adj.WarehouseID, adj.StockDelta, q, ctx, c,
+			)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", i, err)
+			}
+
+			_, err = h.alerts.Enqueue(
+				ctx, q, adj.ProductID, adj.WarehouseID, stock, threshold,
+			)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", i, err)
+			}
+
+			results[i] = Inventory{
+				ProductID:   adj.ProductID,
+				WarehouseID: adj.WarehouseID,
+				Stock:       stock,
+			}
+		}
+
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, inventory.ErrNegativeStock), errors.Is(err, inventory.ErrInsufficientStock):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, pgx.ErrNoRows):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("Error applying stock adjustments: %v", err)
+		http.Error(w, "Error applying stock adjustments", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
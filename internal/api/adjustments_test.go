@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlePostAdjustments(t *testing.T) {
+	// requests rejected before touching the database
+	tests := map[string]string{
+		"empty batch":          `[]`,
+		"missing product":      `[{"warehouse_id":1,"stock_delta":1}]`,
+		"product out of range": `[{"product_id":2147483648,"warehouse_id":1,"stock_delta":1}]`,
+		"delta above int32":    `[{"product_id":1,"warehouse_id":1,"stock_delta":4294967295}]`,
+		"delta below int32":    `[{"product_id":1,"warehouse_id":1,"stock_delta":-2147483649}]`,
+	}
+
+	h := &InventoryHandler{}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/inventory/adjustments", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+			h.HandlePostAdjustments(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rec.Code)
+			}
+		})
+	}
+}
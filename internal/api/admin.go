@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/achere/heroku-kafka-demo-go/internal/inventory"
+	"github.com/achere/heroku-kafka-demo-go/internal/transport"
+)
+
+// cacheInvalidator deletes the cached inventory of a product, a warehouse or everything when both IDs
+// are zero
+type cacheInvalidator interface {
+	Invalidate(ctx context.Context, productID, warehouseID int) (int, error)
+}
+
+// cacheWarmer loads the whole inventory into the cache in the background
+type cacheWarmer interface {
+	Trigger() bool
+	Status() inventory.WarmupStatus
+}
+
+type AdminHandler struct {
+	buffer *transport.MessageBuffer
+	cache  cacheInvalidator
+	warmer cacheWarmer
+}
+
+func NewAdminHandler(buffer *transport.MessageBuffer, cache cacheInvalidator, warmer cacheWarmer) *AdminHandler {
+	return &AdminHandler{buffer: buffer, cache: cache, warmer: warmer}
+}
+
+// MessageList is the list of recently consumed messages, oldest first
+type MessageList struct {
+	Messages []transport.Message `json:"messages"`
+}
+
+// HandleGetMessages responds with the messages the consumer handled most recently along with their
+// processing outcome, optionally only the ones from a partition
+func (h *AdminHandler) HandleGetMessages(w http.ResponseWriter, r *http.Request) {
+	messages := h.buffer.Messages()
+
+	if p := r.URL.Query().Get("partition"); p != "" {
+		partition, err := strconv.ParseInt(p, 10, 32)
+		if err != nil || partition < 0 {
+			http.Error(w, "Invalid partition", http.StatusBadRequest)
+			return
+		}
+
+		filtered := messages[:0]
+		for _, msg := range messages {
+			if msg.Partition == int32(partition) {
+				filtered = append(filtered, msg)
+			}
+		}
+		messages = filtered
+	}
+
+	if messages == nil {
+		messages = []transport.Message{}
+	}
+
+	writeJSON(w, http.StatusOK, MessageList{Messages: messages})
+}
+
+// CacheInvalidation is the number of cache entries deleted
+type CacheInvalidation struct {
+	Deleted int `json:"deleted"`
+}
+
+// HandleDeleteCache deletes the cached inventory of a product, a warehouse, a product in a warehouse
+// or everything when neither product_id nor warehouse_id is given
+func (h *AdminHandler) HandleDeleteCache(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var ids [2]int
+	for i, name := range []string{"product_id", "warehouse_id"} {
+		if !query.Has(name) {
+			continue
+		}
+
+		id, err := strconv.Atoi(query.Get(name))
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid "+name, http.StatusBadRequest)
+			return
+		}
+		ids[i] = id
+	}
+
+	deleted, err := h.cache.Invalidate(r.Context(), ids[0], ids[1])
+	if err != nil {
+		log.Printf("Error invalidating cache: %v", err)
+		http.Error(w, "Error invalidating cache", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, CacheInvalidation{Deleted: deleted})
+}
+
+// HandlePostCacheWarmup starts loading the whole inventory into the cache and responds with the
+// status of the warm-up, with 409 if one is already running
+func (h *AdminHandler) HandlePostCacheWarmup(w http.ResponseWriter, r *http.Request) {
+	if !h.warmer.Trigger() {
+		writeJSON(w, http.StatusConflict, h.warmer.Status())
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, h.warmer.Status())
+}
+
+// HandleGetCacheWarmup responds with the progress of the current or last cache warm-up
+func (h *AdminHandler) HandleGetCacheWarmup(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.warmer.Status())
+}
+
+// RequireToken only lets requests with the bearer token through to next. Without a token every
+// request is forbidden, so the endpoints are closed until one is configured
+func RequireToken(token string, next http.HandlerFunc) http.HandlerFunc {
+	if token == "" {
+		return func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		}
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/achere/heroku-kafka-demo-go/internal/inventory"
+	"github.com/achere/heroku-kafka-demo-go/internal/transport"
+)
+
+func TestHandleGetMessages(t *testing.T) {
+	buffer := &transport.MessageBuffer{MaxSize: 10}
+	buffer.SaveMessage(transport.Message{Topic: "stock-updates", Partition: 0, Offset: 1})
+	buffer.SaveMessage(transport.Message{Topic: "stock-updates", Partition: 1, Offset: 7})
+	buffer.SetOutcome("stock-updates", 1, 7, errors.New("stock would become negative"))
+
+	h := NewAdminHandler(buffer, nil, nil)
+
+	rec := httptest.NewRecorder()
+	h.HandleGetMessages(rec, httptest.NewRequest(http.MethodGet, "/admin/messages?partition=1", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var list MessageList
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("Expected JSON body, got %s", err)
+	}
+
+	if len(list.Messages) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(list.Messages))
+	}
+
+	if list.Messages[0].Status != transport.MessageStatusError {
+		t.Errorf("Expected status %s, got %s", transport.MessageStatusError, list.Messages[0].Status)
+	}
+
+	if list.Messages[0].Error != "stock would become negative" {
+		t.Errorf("Expected error to be reported, got %q", list.Messages[0].Error)
+	}
+
+	rec = httptest.NewRecorder()
+	h.HandleGetMessages(rec, httptest.NewRequest(http.MethodGet, "/admin/messages?partition=x", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+type fakeInvalidator struct {
+	productID, warehouseID int
+}
+
+func (f *fakeInvalidator) Invalidate(ctx context.Context, productID, warehouseID int) (int, error) {
+	f.productID, f.warehouseID = productID, warehouseID
+	return 3, nil
+}
+
+func TestHandleDeleteCache(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		code        int
+		productID   int
+		warehouseID int
+	}{
+		{"everything", "", http.StatusOK, 0, 0},
+		{"product", "?product_id=2", http.StatusOK, 2, 0},
+		{"warehouse", "?warehouse_id=5", http.StatusOK, 0, 5},
+		{"product in warehouse", "?product_id=2&warehouse_id=5", http.StatusOK, 2, 5},
+		{"invalid product", "?product_id=x", http.StatusBadRequest, 0, 0},
+		{"zero warehouse", "?warehouse_id=0", http.StatusBadRequest, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := &fakeInvalidator{}
+			h := NewAdminHandler(nil, cache, nil)
+
+			rec := httptest.NewRecorder()
+			h.HandleDeleteCache(rec, httptest.NewRequest(http.MethodDelete, "/admin/cache"+tt.query, nil))
+
+			if rec.Code != tt.code {
+				t.Fatalf("Expected status code %d, got %d", tt.code, rec.Code)
+			}
+
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			if cache.productID != tt.productID || cache.warehouseID != tt.warehouseID {
+				t.Errorf(
+					"Expected product %d and warehouse %d to be invalidated, got %d and %d",
+					tt.productID, tt.warehouseID, cache.productID, cache.warehouseID,
+				)
+			}
+
+			var res CacheInvalidation
+			if err := json.NewDecoder(rec.Body).Decode(&res); err != nil || res.Deleted != 3 {
+				t.Errorf("Expected 3 deleted entries, got %+v (%v)", res, err)
+			}
+		})
+	}
+}
+
+type fakeWarmer struct {
+	state string
+}
+
+func (f *fakeWarmer) Trigger() bool {
+	if f.state == inventory.WarmupRunning {
+		return false
+	}
+	f.state = inventory.WarmupRunning
+	return true
+}
+
+func (f *fakeWarmer) Status() inventory.WarmupStatus {
+	return inventory.WarmupStatus{State: f.state}
+}
+
+func TestHandlePostCacheWarmup(t *testing.T) {
+	h := NewAdminHandler(nil, nil, &fakeWarmer{state: inventory.WarmupIdle})
+
+	for _, code := range []int{http.StatusAccepted, http.StatusConflict} {
+		rec := httptest.NewRecorder()
+		h.HandlePostCacheWarmup(rec, httptest.NewRequest(http.MethodPost, "/admin/cache/warmup", nil))
+
+		if rec.Code != code {
+			t.Errorf("Expected status code %d, got %d", code, rec.Code)
+		}
+
+		var status inventory.WarmupStatus
+		if err := json.NewDecoder(rec.Body).Decode(&status); err != nil || status.State != inventory.WarmupRunning {
+			t.Errorf("Expected running warm-up, got %+v (%v)", status, err)
+		}
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	handler := RequireToken("s3cret", ok)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/messages", nil)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	t.Run("forbids everything without a token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/admin/cache", nil)
+		req.Header.Set("Authorization", "Bearer ")
+		rec := httptest.NewRecorder()
+		RequireToken("", ok)(rec, req)
+
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("Expected status code %d, got %d", http.StatusForbidden, rec.Code)
+		}
+	})
+}
@@ -0,0 +1,393 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	sqlc "github.com/achere/heroku-kafka-demo-go/db/sqlc"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// maxNameLength is the length of the name columns of products and warehouses
+const maxNameLength = 255
+
+type CatalogHandler struct {
+	queries *sqlc.Queries
+}
+
+func NewCatalogHandler(queries *sqlc.Queries) *CatalogHandler {
+	return &CatalogHandler{queries: queries}
+}
+
+// Product is a product in the catalog
+type Product struct {
+	ProductID   int            `json:"product_id"`
+	Name        string         `json:"name"`
+	Description *string        `json:"description"`
+	Price       pgtype.Numeric `json:"price"`
+}
+
+// ProductPage is a page of products, NextCursor is empty on the last page
+type ProductPage struct {
+	Items      []Product `json:"items"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// Warehouse is a warehouse stock is kept in
+type Warehouse struct {
+	WarehouseID int     `json:"warehouse_id"`
+	Name        string  `json:"name"`
+	Location    *string `json:"location"`
+}
+
+// WarehousePage is a page of warehouses, NextCursor is empty on the last page
+type WarehousePage struct {
+	Items      []Warehouse `json:"items"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// HandlePostProduct creates a product
+func (h *CatalogHandler) HandlePostProduct(w http.ResponseWriter, r *http.Request) {
+	var req Product
+	if !decodeProduct(w, r, &req) {
+		return
+	}
+
+	product, err := h.queries.CreateProduct(r.Context(), sqlc.CreateProductParams{
+		Name:        req.Name,
+		Description: toText(req.Description),
+		Price:       req.Price,
+	})
+	if err != nil {
+		writeCatalogError(w, "creating product", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, fromProduct(product))
+}
+
+// HandlePutProduct replaces the name, description and price of a product
+func (h *CatalogHandler) HandlePutProduct(w http.ResponseWriter, r *http.Request) {
+	productID, ok := parseID(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Invalid product id", http.StatusBadRequest)
+		return
+	}
+
+	var req Product
+	if !decodeProduct(w, r, &req) {
+		return
+	}
+
+	product, err := h.queries.UpdateProduct(r.Context(), sqlc.UpdateProductParams{
+		ProductID:   int32(productID),
+		Name:        req.Name,
+		Description: toText(req.Description),
+		Price:       req.Price,
+	})
+	if err != nil {
+		writeCatalogError(w, "updating product", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, fromProduct(product))
+}
+
+// HandleGetProducts lists products that were not deleted, ordered by ID
+func (h *CatalogHandler) HandleGetProducts(w http.ResponseWriter, r *http.Request) {
+	after, pageSize, ok := parsePageParams(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := h.queries.ListProducts(r.Context(), sqlc.ListProductsParams{
+		AfterProductID: after,
+		PageSize:       int32(pageSize + 1),
+	})
+	if err != nil {
+		writeCatalogError(w, "listing products", err)
+		return
+	}
+
+	page := ProductPage{Items: make([]Product, 0, len(rows))}
+	for i, row := range rows {
+		if i == pageSize {
+			page.NextCursor = encodeCursor(int64(rows[i-1].ProductID))
+			break
+		}
+		page.Items = append(page.Items, fromProduct(row))
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// HandleDeleteProduct soft-deletes a product
+func (h *CatalogHandler) HandleDeleteProduct(w http.ResponseWriter, r *http.Request) {
+	productID, ok := parseID(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Invalid product id", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := h.queries.SoftDeleteProduct(r.Context(), int32(productID))
+	if err != nil {
+		writeCatalogError(w, "deleting product", err)
+		return
+	}
+
+	if deleted == 0 {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandlePostWarehouse creates a warehouse
+func (h *CatalogHandler) HandlePostWarehouse(w http.ResponseWriter, r *http.Request) {
+	var req Warehouse
+	if !decodeWarehouse(w, r, &req) {
+		return
+	}
+
+	warehouse, err := h.queries.CreateWarehouse(r.Context(), sqlc.CreateWarehouseParams{
+		Name:     req.Name,
+		Location: toText(req.Location),
+	})
+	if err != nil {
+		writeCatalogError(w, "creating warehouse", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, fromWarehouse(warehouse))
+}
+
+// HandlePutWarehouse replaces the name and location of a warehouse
+func (h *CatalogHandler) HandlePutWarehouse(w http.ResponseWriter, r *http.Request) {
+	warehouseID, ok := parseID(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Invalid warehouse id", http.StatusBadRequest)
+		return
+	}
+
+	var req Warehouse
+	if !decodeWarehouse(w, r, &req) {
+		return
+	}
+
+	warehouse, err := h.queries.UpdateWarehouse(r.Context(), sqlc.UpdateWarehouseParams{
+		WarehouseID: int32(warehouseID),
+		Name:        req.Name,
+		Location:    toText(req.Location),
+	})
+	if err != nil {
+		writeCatalogError(w, "updating warehouse", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, fromWarehouse(warehouse))
+}
+
+// HandleGetWarehouses lists warehouses that were not deleted, ordered by ID
+func (h *CatalogHandler) HandleGetWarehouses(w http.ResponseWriter, r *http.Request) {
+	after, pageSize, ok := parsePageParams(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := h.queries.ListWarehouses(r.Context(), sqlc.ListWarehousesParams{
+		AfterWarehouseID: after,
+		PageSize:         int32(pageSize + 1),
+	})
+	if err != nil {
+		writeCatalogError(w, "listing warehouses", err)
+		return
+	}
+
+	page := WarehousePage{Items: make([]Warehouse, 0, len(rows))}
+	for i, row := range rows {
+		if i == pageSize {
+			page.NextCursor = encodeCursor(int64(rows[i-1].WarehouseID))
+			break
+		}
+		page.Items = append(page.Items, fromWarehouse(row))
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// HandleDeleteWarehouse soft-deletes a warehouse
+func (h *CatalogHandler) HandleDeleteWarehouse(w http.ResponseWriter, r *http.Request) {
+	warehouseID, ok := parseID(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Invalid warehouse id", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := h.queries.SoftDeleteWarehouse(r.Context(), int32(warehouseID))
+	if err != nil {
+		writeCatalogError(w, "deleting warehouse", err)
+		return
+	}
+
+	if deleted == 0 {
+		http.Error(w, "Warehouse not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeProduct decodes and validates a product from the request body, writing an error response
+// and returning false if it is invalid
+func decodeProduct(w http.ResponseWriter, r *http.Request, p *Product) bool {
+	if err := json.NewDecoder(r.Body).Decode(p); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" || len(p.Name) > maxNameLength {
+		http.Error(w, "Name must be between 1 and 255 characters", http.StatusBadRequest)
+		return false
+	}
+
+	if !validPrice(p.Price) {
+		http.Error(w, "Price must be a non-negative number", http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+// decodeWarehouse decodes and validates a warehouse from the request body, writing an error
+// response and returning false if it is invalid
+func decodeWarehouse(w http.ResponseWriter, r *http.Request, wh *Warehouse) bool {
+	if err := json.NewDecoder(r.Body).Decode(wh); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+
+	wh.Name = strings.TrimSpace(wh.Name)
+	if wh.Name == "" || len(wh.Name) > maxNameLength {
+		http.Error(w, "Name must be between 1 and 255 characters", http.StatusBadRequest)
+		return false
+	}
+
+	if wh.Location != nil && len(*wh.Location) > maxNameLength {
+		http.Error(w, "Location must be at most 255 characters", http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+// validPrice reports whether price is either unset or a finite, non-negative number
+func validPrice(price pgtype.Numeric) bool {
+	if !price.Valid {
+		return true
+	}
+
+	if price.NaN || price.InfinityModifier != pgtype.Finite || price.Int == nil {
+		return false
+	}
+
+	return price.Int.Sign() >= 0
+}
+
+// parsePageParams parses the cursor and limit of an ID ordered listing, writing an error response
+// and returning false if they are invalid
+func parsePageParams(w http.ResponseWriter, r *http.Request) (int32, int, bool) {
+	query := r.URL.Query()
+
+	pageSize, ok := parseLimit(query)
+	if !ok {
+		http.Error(w, invalidLimitMessage, http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	var after int32
+	if cursor := query.Get("cursor"); cursor != "" {
+		keys, err := decodeCursor(cursor, 1)
+		if err != nil || keys[0] < 0 || keys[0] > math.MaxInt32 {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return 0, 0, false
+		}
+		after = int32(keys[0])
+	}
+
+	return after, pageSize, true
+}
+
+// parseID parses a positive ID that fits the int4 ID columns
+func parseID(s string) (int, bool) {
+	id, err := strconv.ParseInt(s, 10, 32)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+
+	return int(id), true
+}
+
+// validID reports whether id is positive and fits the int4 ID columns
+func validID(id int) bool {
+	return id > 0 && id <= math.MaxInt32
+}
+
+// writeCatalogError maps database errors to responses
+func writeCatalogError(w http.ResponseWriter, action string, err error) {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case pgErrorCode(err) == pgNumericOutOfRange:
+		http.Error(w, "Price is out of range", http.StatusBadRequest)
+	default:
+		log.Printf("Error %s: %v", action, err)
+		http.Error(w, "Error "+action, http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func toText(s *string) pgtype.Text {
+	if s == nil {
+		return pgtype.Text{}
+	}
+
+	return pgtype.Text{String: *s, Valid: true}
+}
+
+func fromText(t pgtype.Text) *string {
+	if !t.Valid {
+		return nil
+	}
+
+	return &t.String
+}
+
+func fromProduct(p sqlc.Product) Product {
+	return Product{
+		ProductID:   int(p.ProductID),
+		Name:        p.Name,
+		Description: fromText(p.Description),
+		Price:       p.Price,
+	}
+}
+
+func fromWarehouse(w sqlc.Warehouse) Warehouse {
+	return Warehouse{
+		WarehouseID: int(w.WarehouseID),
+		Name:        w.Name,
+		Location:    fromText(w.Location),
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestValidPrice(t *testing.T) {
+	tests := map[string]bool{
+		"null":  true,
+		"0":     true,
+		"4.20":  true,
+		"-0.01": false,
+		`"NaN"`: false,
+	}
+
+	for raw, expected := range tests {
+		var price pgtype.Numeric
+		if err := price.UnmarshalJSON([]byte(raw)); err != nil {
+			t.Fatalf("Expected %s to unmarshal, got %s", raw, err)
+		}
+
+		if got := validPrice(price); got != expected {
+			t.Errorf("Expected validPrice(%s) to be %t, got %t", raw, expected, got)
+		}
+	}
+}
+
+func TestParseID(t *testing.T) {
+	tests := map[string]bool{
+		"1":          true,
+		"2147483647": true,
+		"0":          false,
+		"-1":         false,
+		"2147483648": false,
+		"4294967297": false,
+		"abc":        false,
+	}
+
+	for raw, expected := range tests {
+		if _, ok := parseID(raw); ok != expected {
+			t.Errorf("Expected parseID(%s) to be %t, got %t", raw, expected, ok)
+		}
+	}
+}
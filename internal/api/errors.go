@@ -0,0 +1,23 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Postgres error codes the API maps to client errors
+const (
+	pgUniqueViolation   = "23505"
+	pgNumericOutOfRange = "22003"
+)
+
+// pgErrorCode returns the Postgres error code of err, or an empty string if it is not a Postgres error
+func pgErrorCode(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+
+	return ""
+}
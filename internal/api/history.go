@@ -0,0 +1,183 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+
+	sqlc "github.com/achere/heroku-kafka-demo-go/db/sqlc"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// historyStore is the part of the queries stock history is read with
+type historyStore interface {
+	ListStockLogs(ctx context.Context, arg sqlc.ListStockLogsParams) ([]sqlc.ListStockLogsRow, error)
+	AggregateStockLogs(ctx context.Context, arg sqlc.AggregateStockLogsParams) ([]sqlc.AggregateStockLogsRow, error)
+}
+
+// StockMovement is a single change of stock recorded in stock_logs
+type StockMovement struct {
+	LogID         int       `json:"log_id"`
+	PreviousStock int       `json:"previous_stock"`
+	UpdatedStock  int       `json:"updated_stock"`
+	StockDelta    int       `json:"stock_delta"`
+	Timestamp     time.Time `json:"timestamp"`
+	TransferID    *string   `json:"transfer_id,omitempty"`
+	Correction    bool      `json:"correction,omitempty"`
+}
+
+// StockHistoryPage is a page of stock movements, NextCursor is empty on the last page
+type StockHistoryPage struct {
+	Movements  []StockMovement `json:"movements"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// StockHistoryBucket is the net change of stock over an hour or a day
+type StockHistoryBucket struct {
+	BucketStart time.Time `json:"bucket_start"`
+	NetChange   int       `json:"net_change"`
+	Movements   int       `json:"movements"`
+}
+
+// StockHistoryAggregate is the net change of stock bucketed per hour or day
+type StockHistoryAggregate struct {
+	Bucket  string               `json:"bucket"`
+	Buckets []StockHistoryBucket `json:"buckets"`
+}
+
+// HandleGetHistory responds with the stock movements of a product in a warehouse between the optional
+// from and to RFC 3339 timestamps. With bucket=hour or bucket=day the net change per bucket is
+// returned instead
+func (h *InventoryHandler) HandleGetHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	productID, ok := parseID(query.Get("product_id"))
+	if !ok {
+		http.Error(w, "Invalid product_id", http.StatusBadRequest)
+		return
+	}
+
+	warehouseID, ok := parseID(query.Get("warehouse_id"))
+	if !ok {
+		http.Error(w, "Invalid warehouse_id", http.StatusBadRequest)
+		return
+	}
+
+	from, err := parseTimeParam(query, "from", pgtype.NegativeInfinity)
+	if err != nil {
+		http.Error(w, "Invalid from, expected an RFC 3339 timestamp", http.StatusBadRequest)
+		return
+	}
+
+	to, err := parseTimeParam(query, "to", pgtype.Infinity)
+	if err != nil {
+		http.Error(w, "Invalid to, expected an RFC 3339 timestamp", http.StatusBadRequest)
+		return
+	}
+
+	if bucket := query.Get("bucket"); bucket != "" {
+		if bucket != "hour" && bucket != "day" {
+			http.Error(w, "Invalid bucket, expected hour or day", http.StatusBadRequest)
+			return
+		}
+
+		rows, err := h.history.AggregateStockLogs(ctx, sqlc.AggregateStockLogsParams{
+			Bucket:      bucket,
+			ProductID:   int32(productID),
+			WarehouseID: int32(warehouseID),
+			FromTime:    from,
+			ToTime:      to,
+		})
+		if err != nil {
+			log.Printf("Error aggregating stock history: %v", err)
+			http.Error(w, "Error fetching stock history", http.StatusInternalServerError)
+			return
+		}
+
+		aggregate := StockHistoryAggregate{Bucket: bucket, Buckets: make([]StockHistoryBucket, len(rows))}
+		for i, row := range rows {
+			aggregate.Buckets[i] = StockHistoryBucket{
+				BucketStart: row.BucketStart.Time,
+				NetChange:   int(row.NetChange),
+				Movements:   int(row.Movements),
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(aggregate)
+		return
+	}
+
+	pageSize, ok := parseLimit(query)
+	if !ok {
+		http.Error(w, invalidLimitMessage, http.StatusBadRequest)
+		return
+	}
+
+	var afterLogID int64
+	if cursor := query.Get("cursor"); cursor != "" {
+		keys, err := decodeCursor(cursor, 1)
+		if err != nil || keys[0] < 0 || keys[0] > math.MaxInt32 {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		afterLogID = keys[0]
+	}
+
+	// Fetch one extra row to find out whether there is a next page
+	rows, err := h.history.ListStockLogs(ctx, sqlc.ListStockLogsParams{
+		ProductID:   int32(productID),
+		WarehouseID: int32(warehouseID),
+		FromTime:    from,
+		ToTime:      to,
+		AfterLogID:  int32(afterLogID),
+		PageSize:    int32(pageSize + 1),
+	})
+	if err != nil {
+		log.Printf("Error listing stock history: %v", err)
+		http.Error(w, "Error fetching stock history", http.StatusInternalServerError)
+		return
+	}
+
+	page := StockHistoryPage{Movements: make([]StockMovement, 0, len(rows))}
+	for i, row := range rows {
+		if i == pageSize {
+			page.NextCursor = encodeCursor(int64(rows[i-1].LogID))
+			break
+		}
+
+		page.Movements = append(page.Movements, StockMovement{
+			LogID:         int(row.LogID),
+			PreviousStock: int(row.PreviousStock),
+			UpdatedStock:  int(row.UpdatedStock),
+			StockDelta:    int(row.StockDelta),
+			Timestamp:     row.Timestamp.Time,
+			TransferID:    fromText(row.TransferID),
+			Correction:    row.IsCorrection,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// parseTimeParam parses an optional RFC 3339 query parameter, falling back to an infinite timestamp
+func parseTimeParam(query url.Values, name string, fallback pgtype.InfinityModifier) (pgtype.Timestamptz, error) {
+	if !query.Has(name) {
+		return pgtype.Timestamptz{InfinityModifier: fallback, Valid: true}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, query.Get(name))
+	if err != nil {
+		return pgtype.Timestamptz{}, err
+	}
+
+	// stock_logs timestamps are stored without a time zone, the queries compare them in the session
+	// time zone they were written in
+	return pgtype.Timestamptz{Time: t, Valid: true}, nil
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	sqlc "github.com/achere/heroku-kafka-demo-go/db/sqlc"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// fakeHistoryStore holds the stock logs of a single inventory and filters them like ListStockLogs
+type fakeHistoryStore struct {
+	logs []sqlc.ListStockLogsRow
+}
+
+func newFakeHistoryStore(start time.Time, n int) *fakeHistoryStore {
+	s := &fakeHistoryStore{}
+	for i := 1; i <= n; i++ {
+		s.logs = append(s.logs, sqlc.ListStockLogsRow{
+			LogID:         int32(i),
+			PreviousStock: int32(i - 1),
+			UpdatedStock:  int32(i),
+			StockDelta:    1,
+			Timestamp:     pgtype.Timestamp{Time: start.Add(time.Duration(i) * time.Hour), Valid: true},
+		})
+	}
+	return s
+}
+
+// within reports whether t is in [from, to), honouring infinite bounds
+func within(t time.Time, from, to pgtype.Timestamptz) bool {
+	if from.InfinityModifier == pgtype.Finite && t.Before(from.Time) {
+		return false
+	}
+	if to.InfinityModifier == pgtype.Finite && !t.Before(to.Time) {
+		return false
+	}
+	return true
+}
+
+func (s *fakeHistoryStore) ListStockLogs(ctx context.Context, arg sqlc.ListStockLogsParams) ([]sqlc.ListStockLogsRow, error) {
+	var rows []sqlc.ListStockLogsRow
+	for _, l := range s.logs {
+		if l.LogID > arg.AfterLogID && within(l.Timestamp.Time, arg.FromTime, arg.ToTime) && len(rows) < int(arg.PageSize) {
+			rows = append(rows, l)
+		}
+	}
+	return rows, nil
+}
+
+func (s *fakeHistoryStore) AggregateStockLogs(ctx context.Context, arg sqlc.AggregateStockLogsParams) ([]sqlc.AggregateStockLogsRow, error) {
+	return nil, nil
+}
+
+func getHistory(t *testing.T, h *InventoryHandler, query string) (int, StockHistoryPage) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.HandleGetHistory(rec, httptest.NewRequest(http.MethodGet, "/inventory/history?product_id=1&warehouse_id=1"+query, nil))
+
+	var page StockHistoryPage
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+			t.Fatalf("Expected JSON body, got %s", err)
+		}
+	}
+
+	return rec.Code, page
+}
+
+func logIDs(page StockHistoryPage) []int {
+	ids := make([]int, len(page.Movements))
+	for i, m := range page.Movements {
+		ids[i] = m.LogID
+	}
+	return ids
+}
+
+func TestHandleGetHistory(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := &InventoryHandler{history: newFakeHistoryStore(start, 5)}
+
+	t.Run("pages through the movements with the cursor", func(t *testing.T) {
+		var pages [][]int
+		cursor := ""
+		for {
+			code, page := getHistory(t, h, "&limit=2"+cursor)
+			if code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d", http.StatusOK, code)
+			}
+
+			pages = append(pages, logIDs(page))
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = "&cursor=" + page.NextCursor
+		}
+
+		expected := [][]int{{1, 2}, {3, 4}, {5}}
+		if !slices.EqualFunc(pages, expected, slices.Equal[[]int]) {
+			t.Errorf("Expected pages %v, got %v", expected, pages)
+		}
+	})
+
+	t.Run("filters by time range", func(t *testing.T) {
+		// movements are an hour apart starting at 01:00, from is inclusive and to is exclusive
+		code, page := getHistory(t, h, "&from=2024-01-01T02:00:00Z&to=2024-01-01T06:00:00%2B02:00")
+		if code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, code)
+		}
+
+		if ids := logIDs(page); !slices.Equal(ids, []int{2, 3}) {
+			t.Errorf("Expected movements 2 and 3, got %v", ids)
+		}
+	})
+
+	t.Run("rejects IDs outside the int32 range", func(t *testing.T) {
+		for _, query := range []string{
+			"?product_id=4294967297&warehouse_id=1",
+			"?product_id=1&warehouse_id=0",
+			"?product_id=-1&warehouse_id=1",
+			"?product_id=1&warehouse_id=2147483648&bucket=day",
+		} {
+			rec := httptest.NewRecorder()
+			h.HandleGetHistory(rec, httptest.NewRequest(http.MethodGet, "/inventory/history"+query, nil))
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status code %d for %s, got %d", http.StatusBadRequest, query, rec.Code)
+			}
+		}
+	})
+
+	t.Run("rejects invalid parameters", func(t *testing.T) {
+		for _, query := range []string{
+			"&cursor=garbage",
+			"&cursor=" + encodeCursor(-1),
+			"&cursor=" + encodeCursor(1<<31),
+			"&from=yesterday",
+			"&to=2024-01-01",
+			"&bucket=week",
+		} {
+			if code, _ := getHistory(t, h, query); code != http.StatusBadRequest {
+				t.Errorf("Expected status code %d for %s, got %d", http.StatusBadRequest, query, code)
+			}
+		}
+	})
+}
@@ -1,26 +1,54 @@
 package api
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
 
 	sqlc "github.com/achere/heroku-kafka-demo-go/db/sqlc"
 	"github.com/achere/heroku-kafka-demo-go/internal/inventory"
-	"github.com/redis/go-redis/v9"
+	"github.com/achere/heroku-kafka-demo-go/internal/metrics"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type InventoryHandler struct {
+	db      *pgxpool.Pool
 	queries *sqlc.Queries
-	rdb     *redis.Client
+	history historyStore
+	cache   inventory.Cache
+	alerts  *inventory.AlertProducer
 }
 
-func NewInventoryHandler(queries *sqlc.Queries, rdb *redis.Client) *InventoryHandler {
-	return &InventoryHandler{queries: queries, rdb: rdb}
+func NewInventoryHandler(dbpool *pgxpool.Pool, cache inventory.Cache, alerts *inventory.AlertProducer) *InventoryHandler {
+	queries := sqlc.New(dbpool)
+
+	return &InventoryHandler{
+		db:      dbpool,
+		queries: queries,
+		history: queries,
+		cache:   cache,
+		alerts:  alerts,
+	}
 }
 
+// HandleGetInventory responds with the stock of a single product in a warehouse, or with a page of
+// inventory items when the request asks for a listing
 func (h *InventoryHandler) HandleGetInventory(w http.ResponseWriter, r *http.Request) {
+	if isListRequest(r.URL.Query()) {
+		h.handleListInventory(w, r)
+		return
+	}
+
 	ctx := r.Context()
 
 	productID, err := strconv.Atoi(r.URL.Query().Get("product_id"))
@@ -35,7 +63,7 @@ func (h *InventoryHandler) HandleGetInventory(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	stock, err := inventory.FetchInventory(productID, warehouseID, h.queries, ctx, inventory.NewRedisCache(h.rdb))
+	stock, err := inventory.FetchInventory(productID, warehouseID, h.queries, ctx, h.cache)
 	if err != nil {
 		log.Printf("Error fetching inventory: %v", err)
 		http.Error(w, "Error fetching inventory", http.StatusInternalServerError)
@@ -50,8 +78,283 @@ func (h *InventoryHandler) HandleGetInventory(w http.ResponseWriter, r *http.Req
 	})
 }
 
+// InventoryProvision is the initial stock level and low-stock alert threshold of a product in a warehouse
+type InventoryProvision struct {
+	ProductID      int `json:"product_id"`
+	WarehouseID    int `json:"warehouse_id"`
+	StockLevel     int `json:"stock_level"`
+	AlertThreshold int `json:"alert_threshold"`
+}
+
+// HandlePostInventory provisions the inventory of a product in a warehouse
+func (h *InventoryHandler) HandlePostInventory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req InventoryProvision
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !validID(req.ProductID) || !validID(req.WarehouseID) {
+		http.Error(w, "Invalid product_id or warehouse_id", http.StatusBadRequest)
+		return
+	}
+
+	if req.StockLevel < 0 || req.AlertThreshold < 0 || req.StockLevel > math.MaxInt32 || req.AlertThreshold > math.MaxInt32 {
+		http.Error(w, "stock_level and alert_threshold must be non-negative", http.StatusBadRequest)
+		return
+	}
+
+	var inv sqlc.Inventory
+	err := sqlc.ExecTx(ctx, h.db, metrics.ObserveTx, func(q *sqlc.Queries) error {
+		var err error
+		inv, err = inventory.ProvisionInventory(
+			ctx, q, req.ProductID, req.WarehouseID, req.StockLevel, req.AlertThreshold,
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = h.alerts.Enqueue(
+			ctx, q, req.ProductID, req.WarehouseID, int(inv.StockLevel), int(inv.AlertThreshold),
+		)
+		return err
+	})
+
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case pgErrorCode(err) == pgUniqueViolation:
+		http.Error(w, "Inventory already exists", http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Error provisioning inventory: %v", err)
+		http.Error(w, "Error provisioning inventory", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, InventoryProvision{
+		ProductID:      int(inv.ProductID),
+		WarehouseID:    int(inv.WarehouseID),
+		StockLevel:     int(inv.StockLevel),
+		AlertThreshold: int(inv.AlertThreshold),
+	})
+}
+
 type Inventory struct {
 	ProductID   int `json:"product_id"`
 	WarehouseID int `json:"warehouse_id"`
 	Stock       int `json:"stock"`
 }
+
+// InventoryItem is an inventory listing entry
+type InventoryItem struct {
+	ProductID      int    `json:"product_id"`
+	ProductName    string `json:"product_name"`
+	WarehouseID    int    `json:"warehouse_id"`
+	WarehouseName  string `json:"warehouse_name"`
+	Stock          int    `json:"stock"`
+	AlertThreshold int    `json:"alert_threshold"`
+}
+
+// InventoryPage is a page of inventory items, NextCursor is empty on the last page
+type InventoryPage struct {
+	Items      []InventoryItem `json:"items"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+var invalidLimitMessage = fmt.Sprintf("Invalid limit, expected 1 to %d", maxPageSize)
+
+// isListRequest reports whether a GET /inventory request asks for a listing rather than a single
+// product and warehouse pair
+func isListRequest(query url.Values) bool {
+	for _, param := range []string{"below_threshold", "sort", "order", "limit", "cursor"} {
+		if query.Has(param) {
+			return true
+		}
+	}
+
+	return !query.Has("product_id") || !query.Has("warehouse_id")
+}
+
+// handleListInventory lists inventory for a warehouse, a product or items below their alert
+// threshold, sorted by product_id, warehouse_id or stock_level and paginated with an opaque cursor
+func (h *InventoryHandler) handleListInventory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	params := sqlc.ListInventoryParams{
+		SortBy:    "product_id",
+		Direction: 1,
+		PageSize:  defaultPageSize,
+	}
+
+	for name, dst := range map[string]*pgtype.Int4{"product_id": &params.ProductID, "warehouse_id": &params.WarehouseID} {
+		if !query.Has(name) {
+			continue
+		}
+
+		id, ok := parseID(query.Get(name))
+		if !ok {
+			http.Error(w, "Invalid "+name, http.StatusBadRequest)
+			return
+		}
+		*dst = pgtype.Int4{Int32: int32(id), Valid: true}
+	}
+
+	if query.Has("below_threshold") {
+		below, err := strconv.ParseBool(query.Get("below_threshold"))
+		if err != nil {
+			http.Error(w, "Invalid below_threshold", http.StatusBadRequest)
+			return
+		}
+		params.BelowThreshold = below
+	}
+
+	if !params.ProductID.Valid && !params.WarehouseID.Valid && !params.BelowThreshold {
+		http.Error(w, "One of product_id, warehouse_id or below_threshold is required", http.StatusBadRequest)
+		return
+	}
+
+	switch sort := query.Get("sort"); sort {
+	case "":
+	case "product_id", "warehouse_id", "stock_level":
+		params.SortBy = sort
+	default:
+		http.Error(w, "Invalid sort, expected product_id, warehouse_id or stock_level", http.StatusBadRequest)
+		return
+	}
+
+	switch order := query.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		params.Direction = -1
+	default:
+		http.Error(w, "Invalid order, expected asc or desc", http.StatusBadRequest)
+		return
+	}
+
+	limit, ok := parseLimit(query)
+	if !ok {
+		http.Error(w, invalidLimitMessage, http.StatusBadRequest)
+		return
+	}
+	params.PageSize = int32(limit)
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		keys, err := decodeCursor(cursor, 3)
+		if err != nil || slices.ContainsFunc(keys, outOfInt32Range) {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		params.HasCursor = true
+		params.CursorSortKey, params.CursorProductKey, params.CursorWarehouseKey = int32(keys[0]), int32(keys[1]), int32(keys[2])
+	}
+
+	// Fetch one extra row to find out whether there is a next page
+	pageSize := params.PageSize
+	params.PageSize++
+
+	rows, err := h.queries.ListInventory(ctx, params)
+	if err != nil {
+		log.Printf("Error listing inventory: %v", err)
+		http.Error(w, "Error listing inventory", http.StatusInternalServerError)
+		return
+	}
+
+	page := InventoryPage{Items: make([]InventoryItem, 0, len(rows))}
+	for i, row := range rows {
+		if i == int(pageSize) {
+			last := rows[i-1]
+			page.NextCursor = encodeCursor(
+				int64(inventorySortKey(params.SortBy, last)*params.Direction),
+				int64(last.ProductID*params.Direction),
+				int64(last.WarehouseID*params.Direction),
+			)
+			break
+		}
+
+		page.Items = append(page.Items, InventoryItem{
+			ProductID:      int(row.ProductID),
+			ProductName:    row.ProductName,
+			WarehouseID:    int(row.WarehouseID),
+			WarehouseName:  row.WarehouseName,
+			Stock:          int(row.StockLevel),
+			AlertThreshold: int(row.AlertThreshold),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// parseLimit parses the optional page size of a listing, reporting whether it is valid
+func parseLimit(query url.Values) (int, bool) {
+	if !query.Has("limit") {
+		return defaultPageSize, true
+	}
+
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit < 1 || limit > maxPageSize {
+		return 0, false
+	}
+
+	return limit, true
+}
+
+// inventorySortKey returns the value a listing row is sorted on, mirroring the ListInventory query
+func inventorySortKey(sortBy string, row sqlc.ListInventoryRow) int32 {
+	switch sortBy {
+	case "stock_level":
+		return row.StockLevel
+	case "warehouse_id":
+		return row.WarehouseID
+	default:
+		return row.ProductID
+	}
+}
+
+// encodeCursor encodes the sort keys of the last row of a page into an opaque cursor
+func encodeCursor(keys ...int64) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = strconv.FormatInt(k, 10)
+	}
+
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(parts, ",")))
+}
+
+// decodeCursor decodes a cursor created by encodeCursor, expecting n sort keys
+func decodeCursor(cursor string, n int) ([]int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(string(raw), ",")
+	if len(parts) != n {
+		return nil, fmt.Errorf("expected %d cursor keys, got %d", n, len(parts))
+	}
+
+	keys := make([]int64, n)
+	for i, p := range parts {
+		keys[i], err = strconv.ParseInt(p, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
+
+// outOfInt32Range reports whether a cursor key doesn't fit the int4 columns it is compared with
+func outOfInt32Range(key int64) bool {
+	return key < math.MinInt32 || key > math.MaxInt32
+}
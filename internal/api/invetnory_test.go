@@ -0,0 +1,83 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestCursor(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		cursor := encodeCursor(-12, 3, 1700000000)
+
+		keys, err := decodeCursor(cursor, 3)
+		if err != nil {
+			t.Fatalf("Expected error to be nil, got %s", err)
+		}
+
+		expected := []int64{-12, 3, 1700000000}
+		for i := range expected {
+			if keys[i] != expected[i] {
+				t.Errorf("Expected key %d to be %d, got %d", i, expected[i], keys[i])
+			}
+		}
+	})
+
+	t.Run("wrong number of keys", func(t *testing.T) {
+		if _, err := decodeCursor(encodeCursor(1, 2), 3); err == nil {
+			t.Errorf("Expected an error for a cursor with 2 keys")
+		}
+	})
+
+	t.Run("garbage", func(t *testing.T) {
+		if _, err := decodeCursor("not a cursor!", 3); err == nil {
+			t.Errorf("Expected an error for an invalid cursor")
+		}
+	})
+}
+
+func TestIsListRequest(t *testing.T) {
+	tests := map[string]bool{
+		"product_id=1&warehouse_id=1":                  false,
+		"product_id=1":                                 true,
+		"warehouse_id=1":                               true,
+		"below_threshold=true":                         true,
+		"product_id=1&warehouse_id=1&sort=stock_level": true,
+	}
+
+	for rawQuery, expected := range tests {
+		query, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := isListRequest(query); got != expected {
+			t.Errorf("Expected isListRequest(%q) to be %t, got %t", rawQuery, expected, got)
+		}
+	}
+}
+
+func TestHandleListInventory(t *testing.T) {
+	// requests rejected before touching the database
+	tests := map[string]string{
+		"zero product_id":          "product_id=0",
+		"negative warehouse_id":    "warehouse_id=-1",
+		"warehouse_id above int32": "warehouse_id=4294967297",
+		"cursor key above int32":   "warehouse_id=1&cursor=" + encodeCursor(1, 4294967297, 1),
+		"cursor key below int32":   "warehouse_id=1&cursor=" + encodeCursor(-2147483649, 1, 1),
+		"cursor with too few keys": "warehouse_id=1&cursor=" + encodeCursor(1, 1),
+	}
+
+	h := &InventoryHandler{}
+	for name, query := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.HandleGetInventory(rec, httptest.NewRequest(http.MethodGet, "/inventory?"+query, nil))
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rec.Code)
+			}
+		})
+	}
+}
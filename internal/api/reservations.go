@@ -0,0 +1,270 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	sqlc "github.com/achere/heroku-kafka-demo-go/db/sqlc"
+	"github.com/achere/heroku-kafka-demo-go/internal/inventory"
+	"github.com/achere/heroku-kafka-demo-go/internal/metrics"
+	"github.com/hashicorp/go-uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxReservationIDLength is the length of the reservation_id column
+const maxReservationIDLength = 64
+
+type ReservationHandler struct {
+	db         *pgxpool.Pool
+	queries    *sqlc.Queries
+	cache      inventory.Cache
+	alerts     *inventory.AlertProducer
+	defaultTTL time.Duration
+	maxTTL     time.Duration
+}
+
+func NewReservationHandler(
+	dbpool *pgxpool.Pool,
+	cache inventory.Cache,
+	alerts *inventory.AlertProducer,
+	defaultTTL time.Duration,
+	maxTTL time.Duration,
+) *ReservationHandler {
+	return &ReservationHandler{
+		db:         dbpool,
+		queries:    sqlc.New(dbpool),
+		cache:      cache,
+		alerts:     alerts,
+		defaultTTL: defaultTTL,
+		maxTTL:     maxTTL,
+	}
+}
+
+// ReservationRequest asks to hold stock of a product in a warehouse. The reservation ID is generated
+// if it is empty and the TTL defaults to the configured one
+type ReservationRequest struct {
+	ReservationID string `json:"reservation_id"`
+	ProductID     int    `json:"product_id"`
+	WarehouseID   int    `json:"warehouse_id"`
+	Quantity      int    `json:"quantity"`
+	TTLSeconds    int    `json:"ttl_seconds"`
+}
+
+// Reservation is a hold on stock of a product in a warehouse
+type Reservation struct {
+	ReservationID      string    `json:"reservation_id"`
+	ProductID          int       `json:"product_id"`
+	WarehouseID        int       `json:"warehouse_id"`
+	Quantity           int       `json:"quantity"`
+	Status             string    `json:"status"`
+	ExpiresAt          time.Time `json:"expires_at"`
+	AvailableToPromise *int      `json:"available_to_promise,omitempty"`
+	Stock              *int      `json:"stock,omitempty"`
+}
+
+// Availability is the stock of a product in a warehouse that is not held by reservations
+type Availability struct {
+	ProductID          int `json:"product_id"`
+	WarehouseID        int `json:"warehouse_id"`
+	Stock              int `json:"stock"`
+	Reserved           int `json:"reserved"`
+	AvailableToPromise int `json:"available_to_promise"`
+}
+
+// HandlePostReservation reserves stock until the reservation is confirmed, released or expires
+func (h *ReservationHandler) HandlePostReservation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req ReservationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !validID(req.ProductID) || !validID(req.WarehouseID) {
+		http.Error(w, "Invalid product_id or warehouse_id", http.StatusBadRequest)
+		return
+	}
+
+	if req.Quantity <= 0 || req.Quantity > math.MaxInt32 {
+		http.Error(w, "quantity must be positive", http.StatusBadRequest)
+		return
+	}
+
+	ttl := h.defaultTTL
+	if req.TTLSeconds != 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+
+	if ttl <= 0 || ttl > h.maxTTL {
+		http.Error(w, "ttl_seconds must be positive and at most "+strconv.Itoa(int(h.maxTTL.Seconds())), http.StatusBadRequest)
+		return
+	}
+
+	if req.ReservationID == "" {
+		id, err := uuid.GenerateUUID()
+		if err != nil {
+			log.Printf("Error generating reservation id: %v", err)
+			http.Error(w, "Error creating reservation", http.StatusInternalServerError)
+			return
+		}
+		req.ReservationID = id
+	}
+
+	if len(req.ReservationID) > maxReservationIDLength {
+		http.Error(w, "reservation_id must be at most 64 characters", http.StatusBadRequest)
+		return
+	}
+
+	var res sqlc.Reservation
+	var available int
+	err := sqlc.ExecTx(ctx, h.db, metrics.ObserveTx, func(q *sqlc.Queries) error {
+		var err error
+		res, available, err = inventory.Reserve(
+			ctx, q, req.ReservationID, req.ProductID, req.WarehouseID, req.Quantity, ttl,
+		)
+		return err
+	})
+	if err != nil {
+		writeReservationError(w, "creating reservation", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, Reservation{
+		ReservationID:      res.ReservationID,
+		ProductID:          int(res.ProductID),
+		WarehouseID:        int(res.WarehouseID),
+		Quantity:           int(res.Quantity),
+		Status:             res.Status,
+		ExpiresAt:          res.ExpiresAt.Time,
+		AvailableToPromise: &available,
+	})
+}
+
+// HandleConfirmReservation turns a reservation into a permanent stock decrease
+func (h *ReservationHandler) HandleConfirmReservation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	reservationID := r.PathValue("id")
+
+	var res sqlc.GetReservationForUpdateRow
+	var stock int
+	err := inventory.ExecTx(ctx, h.db, h.cache, func(q *sqlc.Queries, c inventory.Cache) error {
+		var err error
+		var threshold int
+		res, stock, threshold, err = inventory.ConfirmReservation(ctx, q, c, reservationID)
+		if err != nil {
+			return err
+		}
+
+		_, err = h.alerts.Enqueue(
+			ctx, q, int(res.ProductID), int(res.WarehouseID), stock, threshold,
+		)
+		return err
+	})
+	if err != nil {
+		writeReservationError(w, "confirming reservation", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Reservation{
+		ReservationID: res.ReservationID,
+		ProductID:     int(res.ProductID),
+		WarehouseID:   int(res.WarehouseID),
+		Quantity:      int(res.Quantity),
+		Status:        inventory.ReservationConfirmed,
+		ExpiresAt:     res.ExpiresAt.Time,
+		Stock:         &stock,
+	})
+}
+
+// HandleReleaseReservation releases a reservation, making its stock available again
+func (h *ReservationHandler) HandleReleaseReservation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	reservationID := r.PathValue("id")
+
+	var res sqlc.GetReservationForUpdateRow
+	err := sqlc.ExecTx(ctx, h.db, metrics.ObserveTx, func(q *sqlc.Queries) error {
+		var err error
+		res, err = inventory.ReleaseReservation(ctx, q, reservationID)
+		return err
+	})
+	if err != nil {
+		writeReservationError(w, "releasing reservation", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Reservation{
+		ReservationID: res.ReservationID,
+		ProductID:     int(res.ProductID),
+		WarehouseID:   int(res.WarehouseID),
+		Quantity:      int(res.Quantity),
+		Status:        res.Status,
+		ExpiresAt:     res.ExpiresAt.Time,
+	})
+}
+
+// HandleGetAvailability responds with the stock of a product in a warehouse that is available to
+// promise, which is the stock level minus active reservations
+func (h *ReservationHandler) HandleGetAvailability(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	productID, ok := parseID(r.URL.Query().Get("product_id"))
+	if !ok {
+		http.Error(w, "Invalid product_id", http.StatusBadRequest)
+		return
+	}
+
+	warehouseID, ok := parseID(r.URL.Query().Get("warehouse_id"))
+	if !ok {
+		http.Error(w, "Invalid warehouse_id", http.StatusBadRequest)
+		return
+	}
+
+	inv, err := h.queries.GetInventory(ctx, sqlc.GetInventoryParams{
+		WarehouseID: int32(warehouseID),
+		ProductID:   int32(productID),
+	})
+	if err != nil {
+		writeReservationError(w, "fetching inventory", err)
+		return
+	}
+
+	reserved, err := h.queries.SumActiveReservations(ctx, sqlc.SumActiveReservationsParams{
+		ProductID:   int32(productID),
+		WarehouseID: int32(warehouseID),
+	})
+	if err != nil {
+		writeReservationError(w, "fetching reservations", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Availability{
+		ProductID:          productID,
+		WarehouseID:        warehouseID,
+		Stock:              int(inv.StockLevel),
+		Reserved:           int(reserved),
+		AvailableToPromise: int(inv.StockLevel - reserved),
+	})
+}
+
+// writeReservationError maps reservation errors to responses
+func writeReservationError(w http.ResponseWriter, action string, err error) {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, inventory.ErrInsufficientStock),
+		errors.Is(err, inventory.ErrNegativeStock),
+		errors.Is(err, inventory.ErrReservationExists),
+		errors.Is(err, inventory.ErrReservationNotActive):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Error %s: %v", action, err)
+		http.Error(w, "Error "+action, http.StatusInternalServerError)
+	}
+}
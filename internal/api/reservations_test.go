@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlePostReservation(t *testing.T) {
+	// requests rejected before touching the database
+	tests := map[string]string{
+		"missing product":        `{"warehouse_id":1,"quantity":1}`,
+		"product out of range":   `{"product_id":4294967297,"warehouse_id":1,"quantity":1}`,
+		"warehouse out of range": `{"product_id":1,"warehouse_id":2147483648,"quantity":1}`,
+		"zero quantity":          `{"product_id":1,"warehouse_id":1,"quantity":0}`,
+		"quantity above int32":   `{"product_id":1,"warehouse_id":1,"quantity":2147483648}`,
+	}
+
+	h := &ReservationHandler{maxTTL: time.Hour}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/reservations", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+			h.HandlePostReservation(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rec.Code)
+			}
+		})
+	}
+}
+
+func TestHandleGetAvailability(t *testing.T) {
+	tests := map[string]string{
+		"missing product":        "warehouse_id=1",
+		"product out of range":   "product_id=4294967297&warehouse_id=1",
+		"warehouse out of range": "product_id=1&warehouse_id=2147483648",
+	}
+
+	h := &ReservationHandler{}
+	for name, query := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/inventory/available?"+query, nil)
+			rec := httptest.NewRecorder()
+			h.HandleGetAvailability(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+
+	sqlc "github.com/achere/heroku-kafka-demo-go/db/sqlc"
+	"github.com/achere/heroku-kafka-demo-go/internal/inventory"
+	"github.com/jackc/pgx/v5"
+)
+
+// InventoryThreshold is the low-stock alert threshold of a product in a warehouse along with its
+// current stock, which is ignored in requests
+type InventoryThreshold struct {
+	ProductID      int `json:"product_id"`
+	WarehouseID    int `json:"warehouse_id"`
+	AlertThreshold int `json:"alert_threshold"`
+	Stock          int `json:"stock"`
+}
+
+// HandlePutThreshold sets the low-stock alert threshold of a product in a warehouse, emitting an alert
+// right away if the stock is already below the new threshold
+func (h *InventoryHandler) HandlePutThreshold(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req InventoryThreshold
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !validID(req.ProductID) || !validID(req.WarehouseID) {
+		http.Error(w, "Invalid product_id or warehouse_id", http.StatusBadRequest)
+		return
+	}
+
+	if req.AlertThreshold < 0 || req.AlertThreshold > math.MaxInt32 {
+		http.Error(w, "alert_threshold must be non-negative", http.StatusBadRequest)
+		return
+	}
+
+	var stock int
+	err := inventory.ExecTx(ctx, h.db, h.cache, func(q *sqlc.Queries, c inventory.Cache) error {
+		var err error
+		stock, err = inventory.UpdateThreshold(ctx, q, c, req.ProductID, req.WarehouseID, req.AlertThreshold)
+		if err != nil {
+			return err
+		}
+
+		_, err = h.alerts.Enqueue(
+			ctx, q, req.ProductID, req.WarehouseID, stock, req.AlertThreshold,
+		)
+		return err
+	})
+
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		http.Error(w, "Inventory not found", http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("Error updating alert threshold: %v", err)
+		http.Error(w, "Error updating alert threshold", http.StatusInternalServerError)
+		return
+	}
+
+	req.Stock = stock
+	writeJSON(w, http.StatusOK, req)
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlePutThreshold(t *testing.T) {
+	// requests rejected before touching the database
+	tests := map[string]string{
+		"negative threshold":     `{"product_id":1,"warehouse_id":1,"alert_threshold":-1}`,
+		"threshold above int32":  `{"product_id":1,"warehouse_id":1,"alert_threshold":2147483648}`,
+		"missing product":        `{"warehouse_id":1,"alert_threshold":5}`,
+		"product out of range":   `{"product_id":4294967297,"warehouse_id":1,"alert_threshold":5}`,
+		"warehouse out of range": `{"product_id":1,"warehouse_id":2147483648,"alert_threshold":5}`,
+	}
+
+	h := &InventoryHandler{}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/inventory/threshold", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+			h.HandlePutThreshold(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rec.Code)
+			}
+		})
+	}
+}
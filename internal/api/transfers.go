@@ -0,0 +1,225 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	sqlc "github.com/achere/heroku-kafka-demo-go/db/sqlc"
+	"github.com/achere/heroku-kafka-demo-go/internal/inventory"
+	"github.com/hashicorp/go-uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxTransferIDLength is the length of the transfer_id column
+const maxTransferIDLength = 64
+
+type TransferHandler struct {
+	db      *pgxpool.Pool
+	queries *sqlc.Queries
+	cache   inventory.Cache
+	alerts  *inventory.AlertProducer
+}
+
+func NewTransferHandler(dbpool *pgxpool.Pool, cache inventory.Cache, alerts *inventory.AlertProducer) *TransferHandler {
+	return &TransferHandler{
+		db:      dbpool,
+		queries: sqlc.New(dbpool),
+		cache:   cache,
+		alerts:  alerts,
+	}
+}
+
+// TransferRequest asks to move stock of a product between warehouses. The transfer ID is generated
+// if it is empty. In-transit transfers only debit the source and have to be received separately
+type TransferRequest struct {
+	TransferID             string `json:"transfer_id"`
+	ProductID              int    `json:"product_id"`
+	SourceWarehouseID      int    `json:"source_warehouse_id"`
+	DestinationWarehouseID int    `json:"destination_warehouse_id"`
+	Quantity               int    `json:"quantity"`
+	InTransit              bool   `json:"in_transit"`
+}
+
+// Transfer is a movement of stock of a product between warehouses, Stock holds the resulting stock of
+// the warehouses changed by the request
+type Transfer struct {
+	TransferID             string          `json:"transfer_id"`
+	ProductID              int             `json:"product_id"`
+	SourceWarehouseID      int             `json:"source_warehouse_id"`
+	DestinationWarehouseID int             `json:"destination_warehouse_id"`
+	Quantity               int             `json:"quantity"`
+	Status                 string          `json:"status"`
+	DispatchedAt           time.Time       `json:"dispatched_at"`
+	ReceivedAt             *time.Time      `json:"received_at,omitempty"`
+	Stock                  []TransferStock `json:"stock,omitempty"`
+}
+
+// TransferStock is the stock of a warehouse after a transfer leg was applied
+type TransferStock struct {
+	WarehouseID int `json:"warehouse_id"`
+	Stock       int `json:"stock"`
+}
+
+// HandlePostTransfer moves stock between warehouses, or dispatches it when in_transit is set
+func (h *TransferHandler) HandlePostTransfer(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req TransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !validID(req.ProductID) || !validID(req.SourceWarehouseID) || !validID(req.DestinationWarehouseID) {
+		http.Error(w, "Invalid product_id, source_warehouse_id or destination_warehouse_id", http.StatusBadRequest)
+		return
+	}
+
+	if req.Quantity <= 0 {
+		http.Error(w, "quantity must be positive", http.StatusBadRequest)
+		return
+	}
+
+	if req.TransferID == "" {
+		id, err := uuid.GenerateUUID()
+		if err != nil {
+			log.Printf("Error generating transfer id: %v", err)
+			http.Error(w, "Error creating transfer", http.StatusInternalServerError)
+			return
+		}
+		req.TransferID = id
+	}
+
+	if len(req.TransferID) > maxTransferIDLength {
+		http.Error(w, "transfer_id must be at most 64 characters", http.StatusBadRequest)
+		return
+	}
+
+	var t sqlc.Transfer
+	var legs []inventory.TransferLeg
+	err := inventory.ExecTx(ctx, h.db, h.cache, func(q *sqlc.Queries, c inventory.Cache) error {
+		var err error
+		if req.InTransit {
+			var leg inventory.TransferLeg
+			t, leg, err = inventory.DispatchTransfer(
+				ctx, q, c, req.TransferID, req.ProductID, req.SourceWarehouseID, req.DestinationWarehouseID, req.Quantity,
+			)
+			legs = []inventory.TransferLeg{leg}
+		} else {
+			t, legs, err = inventory.Transfer(
+				ctx, q, c, req.TransferID, req.ProductID, req.SourceWarehouseID, req.DestinationWarehouseID, req.Quantity,
+			)
+		}
+		if err != nil {
+			return err
+		}
+
+		return h.enqueueAlerts(ctx, q, int(t.ProductID), legs)
+	})
+	if err != nil {
+		writeTransferError(w, "creating transfer", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, fromTransfer(t, legs))
+}
+
+// HandleReceiveTransfer adds the stock of an in-transit transfer to its destination warehouse
+func (h *TransferHandler) HandleReceiveTransfer(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	transferID := r.PathValue("id")
+
+	var t sqlc.Transfer
+	var leg inventory.TransferLeg
+	err := inventory.ExecTx(ctx, h.db, h.cache, func(q *sqlc.Queries, c inventory.Cache) error {
+		var err error
+		t, leg, err = inventory.ReceiveTransfer(ctx, q, c, transferID)
+		if err != nil {
+			return err
+		}
+
+		return h.enqueueAlerts(ctx, q, int(t.ProductID), []inventory.TransferLeg{leg})
+	})
+	if err != nil {
+		writeTransferError(w, "receiving transfer", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, fromTransfer(t, []inventory.TransferLeg{leg}))
+}
+
+// HandleGetTransfer responds with a transfer and its status
+func (h *TransferHandler) HandleGetTransfer(w http.ResponseWriter, r *http.Request) {
+	t, err := h.queries.GetTransfer(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeTransferError(w, "fetching transfer", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, fromTransfer(t, nil))
+}
+
+// enqueueAlerts queues low-stock alerts for the warehouses changed by a transfer
+func (h *TransferHandler) enqueueAlerts(
+	ctx context.Context,
+	q *sqlc.Queries,
+	productID int,
+	legs []inventory.TransferLeg,
+) error {
+	for _, leg := range legs {
+		_, err := h.alerts.Enqueue(
+			ctx, q, productID, leg.WarehouseID, leg.Stock, leg.Threshold,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeTransferError maps transfer errors to responses
+func writeTransferError(w http.ResponseWriter, action string, err error) {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, inventory.ErrSameWarehouse),
+		errors.Is(err, inventory.ErrDeltaOutOfRange):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, inventory.ErrInsufficientStock),
+		errors.Is(err, inventory.ErrNegativeStock),
+		errors.Is(err, inventory.ErrTransferExists),
+		errors.Is(err, inventory.ErrTransferNotInTransit):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Error %s: %v", action, err)
+		http.Error(w, "Error "+action, http.StatusInternalServerError)
+	}
+}
+
+func fromTransfer(t sqlc.Transfer, legs []inventory.TransferLeg) Transfer {
+	res := Transfer{
+		TransferID:             t.TransferID,
+		ProductID:              int(t.ProductID),
+		SourceWarehouseID:      int(t.SourceWarehouseID),
+		DestinationWarehouseID: int(t.DestinationWarehouseID),
+		Quantity:               int(t.Quantity),
+		Status:                 t.Status,
+		DispatchedAt:           t.DispatchedAt.Time,
+	}
+
+	if t.ReceivedAt.Valid {
+		res.ReceivedAt = &t.ReceivedAt.Time
+	}
+
+	for _, leg := range legs {
+		res.Stock = append(res.Stock, TransferStock{WarehouseID: leg.WarehouseID, Stock: leg.Stock})
+	}
+
+	return res
+}
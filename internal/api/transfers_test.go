@@ -0,0 +1,44 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/achere/heroku-kafka-demo-go/internal/inventory"
+)
+
+func TestHandlePostTransfer(t *testing.T) {
+	// requests rejected before touching the database
+	tests := map[string]string{
+		"missing product":          `{"source_warehouse_id":1,"destination_warehouse_id":2,"quantity":1}`,
+		"product out of range":     `{"product_id":4294967297,"source_warehouse_id":1,"destination_warehouse_id":2,"quantity":1}`,
+		"source out of range":      `{"product_id":1,"source_warehouse_id":2147483648,"destination_warehouse_id":2,"quantity":1}`,
+		"destination out of range": `{"product_id":1,"source_warehouse_id":1,"destination_warehouse_id":2147483648,"quantity":1}`,
+		"zero quantity":            `{"product_id":1,"source_warehouse_id":1,"destination_warehouse_id":2,"quantity":0}`,
+	}
+
+	h := &TransferHandler{}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/transfers", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+			h.HandlePostTransfer(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rec.Code)
+			}
+		})
+	}
+}
+
+func TestWriteTransferError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeTransferError(rec, "creating transfer", fmt.Errorf("4294967297: %w", inventory.ErrDeltaOutOfRange))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
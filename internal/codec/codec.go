@@ -0,0 +1,105 @@
+package codec
+
+import (
+	"fmt"
+	"mime"
+
+	"github.com/IBM/sarama"
+)
+
+// HeaderContentType is the Kafka header naming the wire format of a message
+const HeaderContentType = "content-type"
+
+// Codec converts messages between a wire format and the JSON envelope they are validated and applied
+// as, see schema.Envelope
+type Codec interface {
+	// Name is how the codec is selected in the config
+	Name() string
+	// ContentType is how the codec is selected by the content-type header of a message
+	ContentType() string
+	// Decode converts a message in the wire format into its JSON envelope
+	Decode(data []byte) ([]byte, error)
+	// Encode converts a JSON envelope into the wire format
+	Encode(envelope []byte) ([]byte, error)
+}
+
+// Registry selects codecs by name or by the content-type header of a message, falling back to a
+// default for messages without one
+type Registry struct {
+	def           Codec
+	byName        map[string]Codec
+	byContentType map[string]Codec
+}
+
+// NewRegistry creates a Registry of codecs using the one named def for messages without a
+// content-type header
+func NewRegistry(def string, codecs ...Codec) (*Registry, error) {
+	r := &Registry{
+		byName:        make(map[string]Codec, len(codecs)),
+		byContentType: make(map[string]Codec, len(codecs)),
+	}
+
+	for _, c := range codecs {
+		r.byName[c.Name()] = c
+		r.byContentType[c.ContentType()] = c
+	}
+
+	var err error
+	if r.def, err = r.Lookup(def); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Lookup returns the codec with a name
+func (r *Registry) Lookup(name string) (Codec, error) {
+	c, ok := r.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown message format %q", name)
+	}
+
+	return c, nil
+}
+
+// ForMessage returns the codec named by the content-type header of a message or the default codec
+// if it has none
+func (r *Registry) ForMessage(headers []*sarama.RecordHeader) (Codec, error) {
+	for _, h := range headers {
+		if h == nil || string(h.Key) != HeaderContentType {
+			continue
+		}
+
+		mediaType, _, err := mime.ParseMediaType(string(h.Value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid content type %q: %v", h.Value, err)
+		}
+
+		c, ok := r.byContentType[mediaType]
+		if !ok {
+			return nil, fmt.Errorf("unsupported content type %q", mediaType)
+		}
+		return c, nil
+	}
+
+	return r.def, nil
+}
+
+// JSON is the codec of JSON messages, which are already in the form they are validated as
+type JSON struct{}
+
+func (JSON) Name() string {
+	return "json"
+}
+
+func (JSON) ContentType() string {
+	return "application/json"
+}
+
+func (JSON) Decode(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+func (JSON) Encode(envelope []byte) ([]byte, error) {
+	return envelope, nil
+}
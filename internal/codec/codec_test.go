@@ -0,0 +1,286 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/achere/heroku-kafka-demo-go/internal/schema"
+)
+
+func TestRegistry(t *testing.T) {
+	r, err := NewRegistry("json", JSON{}, NewProtobuf())
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	header := func(value string) []*sarama.RecordHeader {
+		return []*sarama.RecordHeader{{Key: []byte(HeaderContentType), Value: []byte(value)}}
+	}
+
+	t.Run("selects the codec by content type", func(t *testing.T) {
+		c, err := r.ForMessage(header("application/x-protobuf"))
+		if err != nil || c.Name() != "protobuf" {
+			t.Errorf("Expected the protobuf codec, got %v and %v", c, err)
+		}
+
+		c, err = r.ForMessage(header("application/json; charset=utf-8"))
+		if err != nil || c.Name() != "json" {
+			t.Errorf("Expected the json codec, got %v and %v", c, err)
+		}
+	})
+
+	t.Run("falls back to the default codec", func(t *testing.T) {
+		if c, err := r.ForMessage(nil); err != nil || c.Name() != "json" {
+			t.Errorf("Expected the json codec, got %v and %v", c, err)
+		}
+	})
+
+	t.Run("rejects unknown formats", func(t *testing.T) {
+		if _, err := r.ForMessage(header("application/avro")); err == nil {
+			t.Error("Expected an error for an unsupported content type")
+		}
+
+		if _, err := NewRegistry("xml", JSON{}); err == nil {
+			t.Error("Expected an error for an unknown default")
+		}
+	})
+}
+
+func TestProtobuf(t *testing.T) {
+	p := NewProtobuf()
+
+	env := schema.Envelope{
+		Type:       "stock_update",
+		Version:    1,
+		ID:         "po-1234-line-1",
+		OccurredAt: time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC),
+		Source:     "scanner",
+		Payload:    json.RawMessage(`{"product_id":1,"warehouse_id":300,"stock_delta":-7}`),
+	}
+	envelope, _ := json.Marshal(env)
+
+	t.Run("round trips an envelope", func(t *testing.T) {
+		data, err := p.Encode(envelope)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		decoded, err := p.Decode(data)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		if !bytes.Equal(decoded, envelope) {
+			t.Errorf("Expected %s, got %s", envelope, decoded)
+		}
+	})
+
+	t.Run("decodes the wire format", func(t *testing.T) {
+		// StockUpdate{product_id: 1, warehouse_id: 300, stock_delta: -7}
+		payload := []byte{
+			0x08, 0x01,
+			0x10, 0xac, 0x02,
+			0x18, 0xf9, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01,
+		}
+
+		var b []byte
+		b = appendString(b, 1, "stock_update")
+		b = appendInt32(b, 2, 1)
+		b = appendBytes(b, 6, payload)
+
+		decoded, err := p.Decode(b)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		if !strings.Contains(string(decoded), `"payload":{"product_id":1,"warehouse_id":300,"stock_delta":-7}`) {
+			t.Errorf("Unexpected envelope %s", decoded)
+		}
+	})
+
+	t.Run("skips unknown fields", func(t *testing.T) {
+		var payload []byte
+		payload = appendInt32(payload, 1, 1)
+		payload = appendInt32(payload, 9, 1)
+		payload = append(appendTag(payload, 10, wireFixed64), 1, 2, 3, 4, 5, 6, 7, 8)
+		payload = appendString(payload, 11, "added later")
+		payload = append(appendTag(payload, 12, wireFixed32), 1, 2, 3, 4)
+		payload = appendInt32(payload, 2, 300)
+
+		var b []byte
+		b = appendString(b, 1, "stock_update")
+		b = appendBytes(b, 6, payload)
+		b = appendString(b, 7, "added later")
+
+		decoded, err := p.Decode(b)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		if !strings.Contains(string(decoded), `"payload":{"product_id":1,"warehouse_id":300,"stock_delta":0}`) {
+			t.Errorf("Unexpected envelope %s", decoded)
+		}
+	})
+
+	t.Run("rejects known fields with another wire type", func(t *testing.T) {
+		var b []byte
+		b = appendString(b, 1, "stock_update")
+		b = appendBytes(b, 6, appendString(nil, 1, "1"))
+
+		if _, err := p.Decode(b); err == nil || !strings.Contains(err.Error(), "field 1 of StockUpdate") {
+			t.Errorf("Expected a wire type error, got %v", err)
+		}
+	})
+
+	t.Run("rejects truncated messages", func(t *testing.T) {
+		data, _ := p.Encode(envelope)
+
+		if _, err := p.Decode(data[:len(data)-2]); err == nil {
+			t.Error("Expected an error")
+		}
+	})
+
+	t.Run("rejects types without a definition", func(t *testing.T) {
+		var b []byte
+		b = appendString(b, 1, "transfer")
+
+		if _, err := p.Decode(b); err == nil {
+			t.Error("Expected an error")
+		}
+	})
+}
+
+// protoField is a field declared in proto/messages.proto
+type protoField struct {
+	typ, name string
+	num       int
+}
+
+// readProtoMessages parses the messages and fields declared in proto/messages.proto
+func readProtoMessages(t *testing.T) map[string][]protoField {
+	data, err := os.ReadFile("../../proto/messages.proto")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	messageRe := regexp.MustCompile(`^message (\w+) \{$`)
+	fieldRe := regexp.MustCompile(`^(\w+) (\w+) = (\d+);$`)
+
+	messages := make(map[string][]protoField)
+	var current string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+
+		if m := messageRe.FindStringSubmatch(line); m != nil {
+			current = m[1]
+			messages[current] = nil
+			continue
+		}
+
+		if m := fieldRe.FindStringSubmatch(line); m != nil && current != "" {
+			num, _ := strconv.Atoi(m[3])
+			messages[current] = append(messages[current], protoField{typ: m[1], name: m[2], num: num})
+		}
+	}
+
+	return messages
+}
+
+func TestProtoDefinitions(t *testing.T) {
+	p := NewProtobuf()
+	messages := readProtoMessages(t)
+
+	if len(messages["Envelope"]) == 0 {
+		t.Fatal("Expected an Envelope message in proto/messages.proto")
+	}
+
+	// appendField sets a field to a value derived from its number, so every field gets a distinct one
+	appendField := func(b []byte, f protoField, value string) []byte {
+		switch f.typ {
+		case "int32":
+			return appendInt32(b, f.num, -int32(f.num)*1000)
+		case "string":
+			return appendString(b, f.num, value)
+		case "bytes":
+			return appendBytes(b, f.num, []byte(value))
+		default:
+			t.Fatalf("Unsupported field type %s of %s", f.typ, f.name)
+			return nil
+		}
+	}
+
+	for msgType, newMsg := range p.payloads {
+		t.Run("round trips every field of "+msgType, func(t *testing.T) {
+			name := reflect.TypeOf(newMsg()).Elem().Name()
+
+			var fields []protoField
+			for n, f := range messages {
+				if strings.EqualFold(n, name) {
+					fields = f
+				}
+			}
+			if len(fields) == 0 {
+				t.Fatalf("Expected a definition of %s in proto/messages.proto", name)
+			}
+
+			var payload []byte
+			for _, f := range fields {
+				payload = appendField(payload, f, "")
+			}
+
+			var b []byte
+			for _, f := range messages["Envelope"] {
+				switch f.name {
+				case "type":
+					b = appendField(b, f, msgType)
+				case "occurred_at":
+					b = appendField(b, f, "2025-01-02T15:04:05Z")
+				case "payload":
+					b = appendField(b, f, string(payload))
+				default:
+					b = appendField(b, f, f.name+"-value")
+				}
+			}
+
+			decoded, err := p.Decode(b)
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+
+			var env map[string]any
+			if err := json.Unmarshal(decoded, &env); err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+
+			for _, f := range messages["Envelope"] {
+				if _, ok := env[f.name]; !ok {
+					t.Errorf("Expected envelope field %s in %s", f.name, decoded)
+				}
+			}
+
+			decodedPayload, _ := env["payload"].(map[string]any)
+			for _, f := range fields {
+				if v, ok := decodedPayload[f.name].(float64); !ok || v != float64(-f.num*1000) {
+					t.Errorf("Expected %s to be %d, got %v", f.name, -f.num*1000, decodedPayload[f.name])
+				}
+			}
+
+			encoded, err := p.Encode(decoded)
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+
+			if !bytes.Equal(encoded, b) {
+				t.Errorf("Expected %x, got %x", b, encoded)
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/achere/heroku-kafka-demo-go/internal/schema"
+)
+
+// Protobuf wire types, the messages in proto/messages.proto only use varint and length-delimited
+// fields but fields added later may be of any of them
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("truncated protobuf message")
+
+// protoMessage is a payload with a protobuf wire format, it is converted to and from JSON with
+// encoding/json
+type protoMessage interface {
+	marshalProto() []byte
+	unmarshalProto(data []byte) error
+}
+
+// Protobuf is the codec of the messages in proto/messages.proto, an Envelope whose payload is the
+// message its type names
+type Protobuf struct {
+	payloads map[string]func() protoMessage
+}
+
+// NewProtobuf creates the Protobuf codec for stock updates and low-stock alerts
+func NewProtobuf() *Protobuf {
+	return &Protobuf{
+		payloads: map[string]func() protoMessage{
+			"stock_update":    func() protoMessage { return &stockUpdate{} },
+			"low_stock_alert": func() protoMessage { return &lowStockAlert{} },
+		},
+	}
+}
+
+func (p *Protobuf) Name() string {
+	return "protobuf"
+}
+
+func (p *Protobuf) ContentType() string {
+	return "application/x-protobuf"
+}
+
+func (p *Protobuf) Decode(data []byte) ([]byte, error) {
+	var env schema.Envelope
+	var occurredAt string
+	var payload []byte
+
+	err := parseFields(data, func(num, typ int, v uint64, b []byte) error {
+		switch {
+		case num == 1 && typ == wireBytes:
+			env.Type = string(b)
+		case num == 2 && typ == wireVarint:
+			env.Version = int(int32(v))
+		case num == 3 && typ == wireBytes:
+			env.ID = string(b)
+		case num == 4 && typ == wireBytes:
+			occurredAt = string(b)
+		case num == 5 && typ == wireBytes:
+			env.Source = string(b)
+		case num == 6 && typ == wireBytes:
+			payload = b
+		case num <= 6:
+			return wrongWireType("Envelope", num, typ)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if occurredAt != "" {
+		if env.OccurredAt, err = time.Parse(time.RFC3339Nano, occurredAt); err != nil {
+			return nil, fmt.Errorf("invalid occurred_at %q: %v", occurredAt, err)
+		}
+	}
+
+	msg, err := p.payload(env.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := msg.unmarshalProto(payload); err != nil {
+		return nil, fmt.Errorf("error decoding %s payload: %w", env.Type, err)
+	}
+
+	if env.Payload, err = json.Marshal(msg); err != nil {
+		return nil, fmt.Errorf("error marshalling %s payload: %v", env.Type, err)
+	}
+
+	return json.Marshal(env)
+}
+
+func (p *Protobuf) Encode(envelope []byte) ([]byte, error) {
+	var env schema.Envelope
+	if err := json.Unmarshal(envelope, &env); err != nil {
+		return nil, fmt.Errorf("error unmarshalling envelope: %v", err)
+	}
+
+	msg, err := p.payload(env.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(env.Payload))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(msg); err != nil {
+		return nil, fmt.Errorf("error unmarshalling %s payload: %v", env.Type, err)
+	}
+
+	var b []byte
+	b = appendString(b, 1, env.Type)
+	b = appendInt32(b, 2, int32(env.Version))
+	b = appendString(b, 3, env.ID)
+	if !env.OccurredAt.IsZero() {
+		b = appendString(b, 4, env.OccurredAt.Format(time.RFC3339Nano))
+	}
+	b = appendString(b, 5, env.Source)
+	b = appendBytes(b, 6, msg.marshalProto())
+
+	return b, nil
+}
+
+func (p *Protobuf) payload(msgType string) (protoMessage, error) {
+	newMsg, ok := p.payloads[msgType]
+	if !ok {
+		return nil, fmt.Errorf("no protobuf definition for message type %q", msgType)
+	}
+
+	return newMsg(), nil
+}
+
+// stockUpdate is the StockUpdate message
+type stockUpdate struct {
+	ProductID   int32 `json:"product_id"`
+	WarehouseID int32 `json:"warehouse_id"`
+	StockDelta  int32 `json:"stock_delta"`
+}
+
+func (m *stockUpdate) marshalProto() []byte {
+	var b []byte
+	b = appendInt32(b, 1, m.ProductID)
+	b = appendInt32(b, 2, m.WarehouseID)
+	b = appendInt32(b, 3, m.StockDelta)
+	return b
+}
+
+func (m *stockUpdate) unmarshalProto(data []byte) error {
+	return parseFields(data, func(num, typ int, v uint64, _ []byte) error {
+		var field *int32
+		switch num {
+		case 1:
+			field = &m.ProductID
+		case 2:
+			field = &m.WarehouseID
+		case 3:
+			field = &m.StockDelta
+		default:
+			return nil
+		}
+
+		if typ != wireVarint {
+			return wrongWireType("StockUpdate", num, typ)
+		}
+		*field = int32(v)
+		return nil
+	})
+}
+
+// lowStockAlert is the LowStockAlert message
+type lowStockAlert struct {
+	ProductID    int32 `json:"product_id"`
+	WarehouseID  int32 `json:"warehouse_id"`
+	CurrentStock int32 `json:"current_stock"`
+	Threshold    int32 `json:"threshold"`
+}
+
+func (m *lowStockAlert) marshalProto() []byte {
+	var b []byte
+	b = appendInt32(b, 1, m.ProductID)
+	b = appendInt32(b, 2, m.WarehouseID)
+	b = appendInt32(b, 3, m.CurrentStock)
+	b = appendInt32(b, 4, m.Threshold)
+	return b
+}
+
+func (m *lowStockAlert) unmarshalProto(data []byte) error {
+	return parseFields(data, func(num, typ int, v uint64, _ []byte) error {
+		var field *int32
+		switch num {
+		case 1:
+			field = &m.ProductID
+		case 2:
+			field = &m.WarehouseID
+		case 3:
+			field = &m.CurrentStock
+		case 4:
+			field = &m.Threshold
+		default:
+			return nil
+		}
+
+		if typ != wireVarint {
+			return wrongWireType("LowStockAlert", num, typ)
+		}
+		*field = int32(v)
+		return nil
+	})
+}
+
+func wrongWireType(message string, num, typ int) error {
+	return fmt.Errorf("field %d of %s has wire type %d", num, message, typ)
+}
+
+// parseFields calls visit with every field of a message, with the value of varint and fixed-size
+// fields and the data of length-delimited ones. Unknown fields are visited as well and left for visit
+// to skip, so fields added to the definitions don't break older consumers. Groups are deprecated and
+// rejected
+func parseFields(data []byte, visit func(num, typ int, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		tag, n := consumeVarint(data)
+		if n == 0 {
+			return errTruncated
+		}
+		data = data[n:]
+
+		num, typ := int(tag>>3), int(tag&7)
+		if num == 0 {
+			return errors.New("invalid protobuf field number 0")
+		}
+
+		switch typ {
+		case wireVarint:
+			v, n := consumeVarint(data)
+			if n == 0 {
+				return errTruncated
+			}
+			data = data[n:]
+
+			if err := visit(num, typ, v, nil); err != nil {
+				return err
+			}
+		case wireBytes:
+			l, n := consumeVarint(data)
+			if n == 0 || l > uint64(len(data)-n) {
+				return errTruncated
+			}
+			b := data[n : n+int(l)]
+			data = data[n+int(l):]
+
+			if err := visit(num, typ, 0, b); err != nil {
+				return err
+			}
+		case wireFixed64, wireFixed32:
+			size := 8
+			if typ == wireFixed32 {
+				size = 4
+			}
+			if len(data) < size {
+				return errTruncated
+			}
+
+			var v uint64
+			for i := size - 1; i >= 0; i-- {
+				v = v<<8 | uint64(data[i])
+			}
+			data = data[size:]
+
+			if err := visit(num, typ, v, nil); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d of field %d", typ, num)
+		}
+	}
+
+	return nil
+}
+
+// consumeVarint decodes a varint and returns it with the number of bytes read, which is 0 if data
+// doesn't hold a valid varint
+func consumeVarint(data []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < len(data) && i < 10; i++ {
+		v |= uint64(data[i]&0x7f) << (7 * i)
+		if data[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+
+	return 0, 0
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendTag(b []byte, num, typ int) []byte {
+	return appendVarint(b, uint64(num)<<3|uint64(typ))
+}
+
+// appendInt32 appends an int32 field, leaving it out when it is zero like proto3 does. Negative values
+// are sign extended to 10 bytes
+func appendInt32(b []byte, num int, v int32) []byte {
+	if v == 0 {
+		return b
+	}
+
+	b = appendTag(b, num, wireVarint)
+	return appendVarint(b, uint64(int64(v)))
+}
+
+func appendString(b []byte, num int, v string) []byte {
+	return appendBytes(b, num, []byte(v))
+}
+
+func appendBytes(b []byte, num int, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+
+	b = appendTag(b, num, wireBytes)
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
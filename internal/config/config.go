@@ -3,36 +3,165 @@ package config
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"log"
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/joeshaw/envdecode"
 )
 
 // KafkaConfig is the configuration for Kafka
 type KafkaConfig struct {
-	URL           string `env:"KAFKA_URL,required"`
-	TrustedCert   string `env:"KAFKA_TRUSTED_CERT,required"`
-	ClientCertKey string `env:"KAFKA_CLIENT_CERT_KEY,required"`
-	ClientCert    string `env:"KAFKA_CLIENT_CERT,required"`
-	Prefix        string `env:"KAFKA_PREFIX"`
-	Topic         string `env:"KAFKA_TOPIC,default=stock-updates"`
-	ProducerTopic string `env:"KAFKA_PROD_TOPIC,default=low-stock-alerts"`
-	ConsumerGroup string `env:"KAFKA_CONSUMER_GROUP,default=wms"`
+	URL           string        `env:"KAFKA_URL,required"`
+	TrustedCert   string        `env:"KAFKA_TRUSTED_CERT,required"`
+	ClientCertKey string        `env:"KAFKA_CLIENT_CERT_KEY,required"`
+	ClientCert    string        `env:"KAFKA_CLIENT_CERT,required"`
+	Prefix        string        `env:"KAFKA_PREFIX"`
+	Topic         string        `env:"KAFKA_TOPIC,default=stock-updates"`
+	ProducerTopic string        `env:"KAFKA_PROD_TOPIC,default=low-stock-alerts"`
+	DLQTopic      string        `env:"KAFKA_DLQ_TOPIC"`
+	ConsumerGroup string        `env:"KAFKA_CONSUMER_GROUP,default=wms"`
+	Workers       int           `env:"KAFKA_CONSUMER_WORKERS,default=1"`
+	BatchSize     int           `env:"KAFKA_BATCH_SIZE,default=1"`
+	BatchWait     time.Duration `env:"KAFKA_BATCH_WAIT,default=100ms"`
 	SkipTLS       bool
 }
 
+// validate rejects settings that can't be used together. Batches are applied in order by the consumer
+// itself, so batching can't be combined with workers
+func (kc KafkaConfig) validate() error {
+	if kc.BatchSize >= 2 && kc.Workers > 1 {
+		return errors.New("KAFKA_BATCH_SIZE and KAFKA_CONSUMER_WORKERS can't both be above 1")
+	}
+
+	return nil
+}
+
 // WebConfig is the configuration for the web server
 type WebConfig struct {
-	Port string `env:"PORT,required"`
+	Port               string        `env:"PORT,required"`
+	ShutdownTimeout    time.Duration `env:"SHUTDOWN_TIMEOUT,default=25s"`
+	HealthCheckTimeout time.Duration `env:"HEALTH_CHECK_TIMEOUT,default=2s"`
+}
+
+// RetryConfig is the configuration for retrying messages that failed with a transient error
+type RetryConfig struct {
+	MaxAttempts    int           `env:"RETRY_MAX_ATTEMPTS,default=5"`
+	InitialBackoff time.Duration `env:"RETRY_INITIAL_BACKOFF,default=100ms"`
+	MaxBackoff     time.Duration `env:"RETRY_MAX_BACKOFF,default=5s"`
+}
+
+// LedgerConfig is the configuration for the processed message ledger, entries are pruned once they are
+// older than the retention. Pruning is disabled when the retention is zero
+type LedgerConfig struct {
+	Retention     time.Duration `env:"PROCESSED_MESSAGES_RETENTION,default=168h"`
+	PruneInterval time.Duration `env:"PROCESSED_MESSAGES_PRUNE_INTERVAL,default=1h"`
+}
+
+// validate rejects a prune interval the pruner's ticker can't run with, it is only used when pruning
+// is enabled
+func (lc LedgerConfig) validate() error {
+	if lc.Retention > 0 && lc.PruneInterval <= 0 {
+		return errors.New("PROCESSED_MESSAGES_PRUNE_INTERVAL must be positive")
+	}
+
+	return nil
+}
+
+// OutboxConfig is the configuration for relaying outbox messages to Kafka. Sent messages are pruned
+// once they are older than the retention, pruning is disabled when the retention is zero
+type OutboxConfig struct {
+	PollInterval  time.Duration `env:"OUTBOX_POLL_INTERVAL,default=1s"`
+	BatchSize     int           `env:"OUTBOX_BATCH_SIZE,default=100"`
+	Retention     time.Duration `env:"OUTBOX_RETENTION,default=168h"`
+	PruneInterval time.Duration `env:"OUTBOX_PRUNE_INTERVAL,default=1h"`
+}
+
+// validate rejects intervals the relay's and pruner's tickers can't run with, the prune interval is
+// only used when pruning is enabled
+func (oc OutboxConfig) validate() error {
+	if oc.PollInterval <= 0 {
+		return errors.New("OUTBOX_POLL_INTERVAL must be positive")
+	}
+
+	if oc.Retention > 0 && oc.PruneInterval <= 0 {
+		return errors.New("OUTBOX_PRUNE_INTERVAL must be positive")
+	}
+
+	return nil
+}
+
+// ReservationConfig is the configuration for stock reservations
+type ReservationConfig struct {
+	DefaultTTL    time.Duration `env:"RESERVATION_DEFAULT_TTL,default=15m"`
+	MaxTTL        time.Duration `env:"RESERVATION_MAX_TTL,default=24h"`
+	SweepInterval time.Duration `env:"RESERVATION_SWEEP_INTERVAL,default=30s"`
+}
+
+// validate rejects a sweep interval the sweeper's ticker can't run with
+func (rc ReservationConfig) validate() error {
+	if rc.SweepInterval <= 0 {
+		return errors.New("RESERVATION_SWEEP_INTERVAL must be positive")
+	}
+
+	return nil
+}
+
+// ReconcileConfig is the configuration for reconciling inventory with stock logs inside the app, it
+// is disabled when no interval is set
+type ReconcileConfig struct {
+	Interval time.Duration `env:"RECONCILE_INTERVAL"`
+	Repair   bool          `env:"RECONCILE_REPAIR"`
+}
+
+// CacheConfig is the configuration for the Redis inventory cache, entries never expire when the TTL
+// is zero. With warm-up on start the whole inventory is loaded into the cache at startup, holding
+// readiness back until it is done if configured. A local size enables an in-memory LRU tier in front
+// of Redis
+type CacheConfig struct {
+	TTL                 time.Duration `env:"CACHE_TTL,default=1h"`
+	WarmupOnStart       bool          `env:"CACHE_WARMUP_ON_START"`
+	WarmupHoldReadiness bool          `env:"CACHE_WARMUP_HOLD_READINESS"`
+	WarmupBatchSize     int           `env:"CACHE_WARMUP_BATCH_SIZE,default=1000"`
+	WarmupConcurrency   int           `env:"CACHE_WARMUP_CONCURRENCY,default=4"`
+	LocalSize           int           `env:"CACHE_LOCAL_SIZE"`
+	LocalTTL            time.Duration `env:"CACHE_LOCAL_TTL,default=5s"`
+}
+
+// SchemaConfig is the configuration for message envelopes, their schemas and wire formats. Schemas
+// are looked up in the registry at the URL if one is set and in the schemas embedded in the app
+// otherwise. Bare messages without an envelope are accepted as version 1 of their type unless
+// disallowed. Consumed messages without a content-type header are decoded with the message format,
+// alerts are published in the alert format
+type SchemaConfig struct {
+	RegistryURL       string `env:"SCHEMA_REGISTRY_URL"`
+	AllowBareMessages bool   `env:"SCHEMA_ALLOW_BARE_MESSAGES,default=true"`
+	Source            string `env:"MESSAGE_SOURCE,default=wms"`
+	MessageFormat     string `env:"MESSAGE_FORMAT,default=json"`
+	AlertFormat       string `env:"ALERT_FORMAT,default=json"`
+}
+
+// AdminConfig is the configuration for the admin endpoints. They are closed when no token is set
+type AdminConfig struct {
+	Token             string `env:"ADMIN_TOKEN"`
+	MessageBufferSize int    `env:"MESSAGE_BUFFER_SIZE,default=10"`
 }
 
 // AppConfig is the configuration for the application
 type AppConfig struct {
 	Kafka       KafkaConfig
 	Web         WebConfig
+	Retry       RetryConfig
+	Ledger      LedgerConfig
+	Outbox      OutboxConfig
+	Reservation ReservationConfig
+	Reconcile   ReconcileConfig
+	Cache       CacheConfig
+	Schema      SchemaConfig
+	Admin       AdminConfig
 	DatabaseURL string `env:"DATABASE_URL,required"`
 	RedisURL    string `env:"REDIS_URL,required"`
 }
@@ -46,6 +175,22 @@ func NewAppConfig() (*AppConfig, error) {
 		return nil, err
 	}
 
+	if err := cfg.Kafka.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Ledger.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Outbox.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Reservation.validate(); err != nil {
+		return nil, err
+	}
+
 	if os.Getenv("KAFKA_ENV") == "dev" {
 		cfg.Kafka.SkipTLS = true
 	}
@@ -116,6 +261,18 @@ func (ac *AppConfig) ProducerTopic() string {
 	return topic
 }
 
+// DLQTopic returns the Kafka topic to dead-letter unprocessable messages to, it is empty when
+// dead-lettering is disabled
+func (ac *AppConfig) DLQTopic() string {
+	topic := ac.Kafka.DLQTopic
+
+	if topic != "" && ac.Kafka.Prefix != "" {
+		topic = ac.Kafka.Prefix + topic
+	}
+
+	return topic
+}
+
 // GroupID returns the Kafka consumer group ID to use
 func (ac *AppConfig) Group() string {
 	group := ac.Kafka.ConsumerGroup
@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 )
 
 func TestBrokerAddresses(t *testing.T) {
@@ -63,3 +64,123 @@ func TestGroup(t *testing.T) {
 		t.Errorf("Expected %s, got %s", expected, cfg.Group())
 	}
 }
+
+func TestDLQTopic(t *testing.T) {
+	t.Run("with prefix", func(t *testing.T) {
+		cfg := &AppConfig{
+			Kafka: KafkaConfig{
+				Prefix:   "foobar.",
+				DLQTopic: "stock-updates-dlq",
+			},
+		}
+
+		expected := "foobar.stock-updates-dlq"
+
+		if cfg.DLQTopic() != expected {
+			t.Errorf("Expected %s, got %s", expected, cfg.DLQTopic())
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		cfg := &AppConfig{
+			Kafka: KafkaConfig{
+				Prefix: "foobar.",
+			},
+		}
+
+		if cfg.DLQTopic() != "" {
+			t.Errorf("Expected empty topic, got %s", cfg.DLQTopic())
+		}
+	})
+}
+
+func TestKafkaConfigValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		workers   int
+		batchSize int
+		valid     bool
+	}{
+		{"defaults", 1, 1, true},
+		{"workers", 4, 1, true},
+		{"batching", 1, 50, true},
+		{"workers with a batch size below 2", 4, 0, true},
+		{"workers with batching", 4, 50, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := KafkaConfig{Workers: tt.workers, BatchSize: tt.batchSize}.validate()
+			if (err == nil) != tt.valid {
+				t.Errorf("Expected valid %t, got error %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestReservationConfigValidate(t *testing.T) {
+	tests := map[time.Duration]bool{
+		30 * time.Second: true,
+		0:                false,
+		-time.Second:     false,
+	}
+
+	for interval, valid := range tests {
+		err := ReservationConfig{SweepInterval: interval}.validate()
+		if (err == nil) != valid {
+			t.Errorf("Expected sweep interval %s to be valid %t, got error %v", interval, valid, err)
+		}
+	}
+}
+
+func TestLedgerConfigValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention time.Duration
+		interval  time.Duration
+		valid     bool
+	}{
+		{"defaults", 168 * time.Hour, time.Hour, true},
+		{"zero interval", 168 * time.Hour, 0, false},
+		{"negative interval", 168 * time.Hour, -time.Hour, false},
+		{"zero interval with pruning disabled", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := LedgerConfig{Retention: tt.retention, PruneInterval: tt.interval}.validate()
+			if (err == nil) != tt.valid {
+				t.Errorf("Expected valid %t, got error %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestOutboxConfigValidate(t *testing.T) {
+	tests := []struct {
+		name          string
+		pollInterval  time.Duration
+		retention     time.Duration
+		pruneInterval time.Duration
+		valid         bool
+	}{
+		{"defaults", time.Second, 168 * time.Hour, time.Hour, true},
+		{"zero poll interval", 0, 168 * time.Hour, time.Hour, false},
+		{"negative poll interval", -time.Second, 168 * time.Hour, time.Hour, false},
+		{"zero prune interval", time.Second, 168 * time.Hour, 0, false},
+		{"zero prune interval with pruning disabled", time.Second, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := OutboxConfig{
+				PollInterval:  tt.pollInterval,
+				Retention:     tt.retention,
+				PruneInterval: tt.pruneInterval,
+			}.validate()
+			if (err == nil) != tt.valid {
+				t.Errorf("Expected valid %t, got error %v", tt.valid, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Check statuses
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Report statuses
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// CheckFunc checks a dependency, returning optional details to report along with its status
+type CheckFunc func(ctx context.Context) (any, error)
+
+// Check is a named dependency check. The service is not ready while a required check fails, other
+// checks are only reported
+type Check struct {
+	Name     string
+	Required bool
+	Run      CheckFunc
+}
+
+// CheckResult is the outcome of a single check
+type CheckResult struct {
+	Status   string `json:"status"`
+	Required bool   `json:"required"`
+	Error    string `json:"error,omitempty"`
+	Details  any    `json:"details,omitempty"`
+}
+
+// Report is the outcome of all checks
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Checker runs dependency checks to tell whether the service is ready
+type Checker struct {
+	checks  []Check
+	timeout time.Duration
+}
+
+// NewChecker creates a new Checker, every check has to complete within timeout
+func NewChecker(timeout time.Duration, checks ...Check) *Checker {
+	return &Checker{
+		checks:  checks,
+		timeout: timeout,
+	}
+}
+
+// Ping returns a check that only reports whether ping succeeds
+func Ping(name string, ping func(ctx context.Context) error) Check {
+	return Check{
+		Name:     name,
+		Required: true,
+		Run: func(ctx context.Context) (any, error) {
+			return nil, ping(ctx)
+		},
+	}
+}
+
+// Run runs all checks concurrently and reports the service as unavailable if a required check fails
+func (c *Checker) Run(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	results := make([]CheckResult, len(c.checks))
+
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runCheck(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{
+		Status: StatusOK,
+		Checks: make(map[string]CheckResult, len(c.checks)),
+	}
+
+	for i, check := range c.checks {
+		report.Checks[check.Name] = results[i]
+		if check.Required && results[i].Status != StatusUp {
+			report.Status = StatusUnavailable
+		}
+	}
+
+	return report
+}
+
+// runCheck runs a check, giving up on it once ctx is done. Checks backed by clients that don't take
+// a context keep running in the background until they return
+func runCheck(ctx context.Context, check Check) CheckResult {
+	type outcome struct {
+		details any
+		err     error
+	}
+
+	done := make(chan outcome, 1)
+	go func() {
+		details, err := check.Run(ctx)
+		done <- outcome{details, err}
+	}()
+
+	res := CheckResult{Status: StatusUp, Required: check.Required}
+
+	select {
+	case o := <-done:
+		res.Details = o.details
+		if o.err != nil {
+			res.Status = StatusDown
+			res.Error = o.err.Error()
+		}
+	case <-ctx.Done():
+		res.Status = StatusDown
+		res.Error = ctx.Err().Error()
+	}
+
+	return res
+}
+
+// HandleHealthz responds with 200 as long as the process is able to serve requests
+func (c *Checker) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": StatusOK})
+}
+
+// HandleReadyz responds with the status of every dependency, with 503 if a required one is down
+func (c *Checker) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	report := c.Run(r.Context())
+
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
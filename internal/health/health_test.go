@@ -0,0 +1,104 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestChecker(t *testing.T) {
+	up := func(ctx context.Context) (any, error) { return nil, nil }
+	down := func(ctx context.Context) (any, error) { return nil, errors.New("connection refused") }
+
+	t.Run("all checks up", func(t *testing.T) {
+		c := NewChecker(time.Second, Check{Name: "postgres", Required: true, Run: up})
+
+		report := c.Run(context.Background())
+
+		if report.Status != StatusOK {
+			t.Errorf("Expected status %s, got %s", StatusOK, report.Status)
+		}
+
+		if report.Checks["postgres"].Status != StatusUp {
+			t.Errorf("Expected postgres to be %s, got %s", StatusUp, report.Checks["postgres"].Status)
+		}
+	})
+
+	t.Run("required check down", func(t *testing.T) {
+		c := NewChecker(
+			time.Second,
+			Check{Name: "postgres", Required: true, Run: up},
+			Check{Name: "redis", Required: true, Run: down},
+		)
+
+		report := c.Run(context.Background())
+
+		if report.Status != StatusUnavailable {
+			t.Errorf("Expected status %s, got %s", StatusUnavailable, report.Status)
+		}
+
+		if report.Checks["redis"].Error != "connection refused" {
+			t.Errorf("Expected redis error to be reported, got %q", report.Checks["redis"].Error)
+		}
+	})
+
+	t.Run("optional check down", func(t *testing.T) {
+		c := NewChecker(time.Second, Check{Name: "consumer_lag", Run: down})
+
+		report := c.Run(context.Background())
+
+		if report.Status != StatusOK {
+			t.Errorf("Expected status %s, got %s", StatusOK, report.Status)
+		}
+
+		if report.Checks["consumer_lag"].Status != StatusDown {
+			t.Errorf("Expected consumer_lag to be %s, got %s", StatusDown, report.Checks["consumer_lag"].Status)
+		}
+	})
+
+	t.Run("check times out", func(t *testing.T) {
+		block := make(chan struct{})
+		defer close(block)
+
+		c := NewChecker(10*time.Millisecond, Check{
+			Name:     "kafka",
+			Required: true,
+			Run: func(ctx context.Context) (any, error) {
+				<-block
+				return nil, nil
+			},
+		})
+
+		report := c.Run(context.Background())
+
+		if report.Checks["kafka"].Error != context.DeadlineExceeded.Error() {
+			t.Errorf("Expected kafka to time out, got %q", report.Checks["kafka"].Error)
+		}
+	})
+}
+
+func TestHandleReadyz(t *testing.T) {
+	c := NewChecker(time.Second, Ping("redis", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	}))
+
+	rec := httptest.NewRecorder()
+	c.HandleReadyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+
+	var report Report
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("Expected JSON body, got %s", err)
+	}
+
+	if report.Checks["redis"].Status != StatusDown {
+		t.Errorf("Expected redis to be %s, got %s", StatusDown, report.Checks["redis"].Status)
+	}
+}
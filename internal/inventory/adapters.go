@@ -2,29 +2,163 @@ package inventory
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// setIfNewer stores a value along with its version in a hash unless the hash already holds the same
+// or a newer version. Entries written before they were versioned are plain strings and replaced
+var setIfNewer = redis.NewScript(`
+if redis.call('TYPE', KEYS[1]).ok == 'hash' then
+	local current = redis.call('HGET', KEYS[1], 'version')
+	if current and tonumber(current) >= tonumber(ARGV[2]) then
+		return 0
+	end
+else
+	redis.call('DEL', KEYS[1])
+end
+
+redis.call('HSET', KEYS[1], 'value', ARGV[1], 'version', ARGV[2])
+if tonumber(ARGV[3]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+else
+	redis.call('PERSIST', KEYS[1])
+end
+return 1
+`)
+
+// invalidateBatchSize is the number of keys scanned and deleted at a time when invalidating
+const invalidateBatchSize = 500
+
 // RedisCache struct that proxies to Redis
 type RedisCache struct {
 	client *redis.Client
+	ttl    time.Duration
 }
 
-// NewRedisCache function creates a proxy to Redis that satisfies the Cache interface
-func NewRedisCache(client *redis.Client) *RedisCache {
-	return &RedisCache{client: client}
+// NewRedisCache function creates a proxy to Redis that satisfies the Cache interface, entries expire
+// after ttl or never if it is zero
+func NewRedisCache(client *redis.Client, ttl time.Duration) *RedisCache {
+	return &RedisCache{client: client, ttl: ttl}
 }
 
 func (r *RedisCache) Get(ctx context.Context, key string) (string, error) {
-	val, err := r.client.Get(ctx, key).Result()
+	val, err := r.client.HGet(ctx, key, "value").Result()
 	if err == redis.Nil {
 		return "", nil
 	}
 	return val, err
 }
 
-func (r *RedisCache) Set(ctx context.Context, key, value string, expiration time.Duration) error {
-	return r.client.Set(ctx, key, value, expiration).Err()
+func (r *RedisCache) Set(ctx context.Context, key, value string, version int64) error {
+	return setIfNewer.Run(ctx, r.client, []string{key}, value, version, r.ttl.Milliseconds()).Err()
+}
+
+// SetMany sets entries in a single pipeline, skipping the ones the cache holds a newer version of
+func (r *RedisCache) SetMany(ctx context.Context, entries []CacheEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	// Pipelined commands can't fall back to loading the script, make sure it is loaded up front
+	if err := setIfNewer.Load(ctx, r.client).Err(); err != nil {
+		return err
+	}
+
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, e := range entries {
+			setIfNewer.EvalSha(ctx, pipe, []string{e.Key}, e.Value, e.Version, r.ttl.Milliseconds())
+		}
+		return nil
+	})
+	return err
+}
+
+func (r *RedisCache) Delete(ctx context.Context, key string) error {
+	return r.client.Del(ctx, key).Err()
+}
+
+// Invalidate deletes the cached inventory of a product in every warehouse, of every product in a
+// warehouse or of both when either ID is zero, and returns the number of entries deleted
+func (r *RedisCache) Invalidate(ctx context.Context, productID, warehouseID int) (int, error) {
+	if productID != 0 && warehouseID != 0 {
+		deleted, err := r.client.Del(ctx, cacheKey(productID, warehouseID)).Result()
+		return int(deleted), err
+	}
+
+	iter := r.client.Scan(ctx, 0, cachePattern(productID, warehouseID), invalidateBatchSize).Iterator()
+
+	deleted := 0
+	keys := make([]string, 0, invalidateBatchSize)
+	flush := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+
+		n, err := r.client.Del(ctx, keys...).Result()
+		deleted += int(n)
+		keys = keys[:0]
+		return err
+	}
+
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == invalidateBatchSize {
+			if err := flush(); err != nil {
+				return deleted, err
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return deleted, err
+	}
+
+	return deleted, flush()
+}
+
+// RedisInvalidationBus broadcasts cache invalidations to every instance over Redis pub/sub. Messages
+// are the ID of the publishing instance and a key pattern, so an instance can skip its own
+type RedisInvalidationBus struct {
+	client     *redis.Client
+	channel    string
+	instanceID string
+}
+
+// NewRedisInvalidationBus creates a bus on channel for an instance identified by instanceID
+func NewRedisInvalidationBus(client *redis.Client, channel, instanceID string) *RedisInvalidationBus {
+	return &RedisInvalidationBus{client: client, channel: channel, instanceID: instanceID}
+}
+
+// Publish tells the other instances to drop the keys matching pattern
+func (b *RedisInvalidationBus) Publish(ctx context.Context, pattern string) error {
+	return b.client.Publish(ctx, b.channel, b.instanceID+" "+pattern).Err()
+}
+
+// Subscribe calls evict with the pattern of every invalidation published by other instances until
+// ctx is done. Invalidations published while the subscription reconnects are lost, local entries
+// have to expire to make up for them
+func (b *RedisInvalidationBus) Subscribe(ctx context.Context, evict func(pattern string)) {
+	sub := b.client.Subscribe(ctx, b.channel)
+	defer sub.Close()
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			instanceID, pattern, found := strings.Cut(msg.Payload, " ")
+			if !found || instanceID == b.instanceID {
+				continue
+			}
+
+			evict(pattern)
+		}
+	}
 }
@@ -0,0 +1,91 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/achere/heroku-kafka-demo-go/db/sqlc"
+	"github.com/achere/heroku-kafka-demo-go/internal/schema"
+)
+
+// Low-stock alerts are published in an envelope of this type, following this version of its schema
+const (
+	LowStockAlertType    = "low_stock_alert"
+	LowStockAlertVersion = 1
+)
+
+// LowStockAlert is published when stock drops below the alert threshold
+type LowStockAlert struct {
+	ProductID    int `json:"product_id"`
+	WarehouseID  int `json:"warehouse_id"`
+	CurrentStock int `json:"current_stock"`
+	Threshold    int `json:"threshold"`
+}
+
+type outboxStore interface {
+	InsertOutboxMessage(ctx context.Context, arg db.InsertOutboxMessageParams) error
+}
+
+// AlertProducer writes low-stock alerts for a topic to the outbox, wrapped in an envelope and
+// validated against the alert schema
+type AlertProducer struct {
+	topic     string
+	source    string
+	validator *schema.Validator
+}
+
+// NewAlertProducer creates an AlertProducer for topic, source is recorded in the envelope of every
+// alert
+func NewAlertProducer(topic, source string, validator *schema.Validator) *AlertProducer {
+	return &AlertProducer{
+		topic:     topic,
+		source:    source,
+		validator: validator,
+	}
+}
+
+// Enqueue writes a low-stock alert to the outbox if stock is below the threshold and reports whether
+// it did. Alerts are keyed by warehouse_id:product_id so the alerts of an inventory stay in order. It
+// should be called in the transaction that updated the stock so the alert is only published if the
+// update is committed
+func (p *AlertProducer) Enqueue(
+	ctx context.Context,
+	store outboxStore,
+	productID int,
+	warehouseID int,
+	stock int,
+	threshold int,
+) (bool, error) {
+	if stock >= threshold {
+		return false, nil
+	}
+
+	alert := LowStockAlert{
+		ProductID:    productID,
+		WarehouseID:  warehouseID,
+		CurrentStock: stock,
+		Threshold:    threshold,
+	}
+	env, err := schema.NewEnvelope(LowStockAlertType, LowStockAlertVersion, p.source, alert)
+	if err != nil {
+		return false, err
+	}
+
+	payload, err := p.validator.Encode(ctx, env)
+	if err != nil {
+		return false, fmt.Errorf("error encoding low-stock alert: %w", err)
+	}
+
+	err = store.InsertOutboxMessage(ctx, db.InsertOutboxMessageParams{
+		Topic:      p.topic,
+		MessageKey: fmt.Sprintf("%d:%d", warehouseID, productID),
+		Payload:    payload,
+	})
+	if err != nil {
+		return false, fmt.Errorf("error writing low-stock alert to outbox: %w", err)
+	}
+	slog.Info("alert queued", "at", "inventory", "topic", p.topic, "value", string(payload))
+
+	return true, nil
+}
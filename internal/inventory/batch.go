@@ -0,0 +1,169 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/achere/heroku-kafka-demo-go/db/sqlc"
+	"github.com/jackc/pgx/v5"
+)
+
+// StockChange is a stock delta for the inventory of a product in a warehouse
+type StockChange struct {
+	ProductID   int
+	WarehouseID int
+	Delta       int
+}
+
+// StockLevel is the stock and low-stock alert threshold of an inventory after a StockChange
+type StockLevel struct {
+	ProductID   int
+	WarehouseID int
+	Stock       int
+	Threshold   int
+}
+
+type batchInventoryStore interface {
+	inventoryGetter
+	AdjustInventoryBatch(ctx context.Context, arg []db.AdjustInventoryBatchParams) *db.AdjustInventoryBatchBatchResults
+	InsertStockLogBatch(ctx context.Context, arg []db.InsertStockLogBatchParams) *db.InsertStockLogBatchBatchResults
+	SumActiveReservationsBatch(ctx context.Context, arg []db.SumActiveReservationsBatchParams) *db.SumActiveReservationsBatchBatchResults
+}
+
+// UpdateInventoryBatch applies stock changes in order like UpdateInventory does, sending each kind of
+// statement for all changes in a single round trip. It must be called in a transaction as it fails
+// as a whole: when any change would make stock negative or take reserved stock, the changes before it
+// have been applied already. It returns the stock levels in the order of the changes
+func UpdateInventoryBatch(
+	ctx context.Context,
+	store batchInventoryStore,
+	c Cache,
+	changes []StockChange,
+) ([]StockLevel, error) {
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	params := make([]db.AdjustInventoryBatchParams, len(changes))
+	for i, ch := range changes {
+		if err := checkDelta(ch.Delta); err != nil {
+			return nil, err
+		}
+
+		params[i] = db.AdjustInventoryBatchParams{
+			StockDelta:  int32(ch.Delta),
+			WarehouseID: int32(ch.WarehouseID),
+			ProductID:   int32(ch.ProductID),
+		}
+	}
+
+	rows := make([]db.AdjustInventoryBatchRow, len(changes))
+	failed := -1
+	var err error
+	store.AdjustInventoryBatch(ctx, params).QueryRow(func(i int, row db.AdjustInventoryBatchRow, rowErr error) {
+		if rowErr != nil && err == nil {
+			failed, err = i, rowErr
+		}
+		rows[i] = row
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		ch := changes[failed]
+		return nil, negativeStockError(ctx, store, int32(ch.WarehouseID), int32(ch.ProductID), ch.Delta)
+	}
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("db dml", "at", "inventory", "action", "AdjustInventoryBatch", "count", len(rows))
+
+	if err := checkReservations(ctx, store, changes, rows); err != nil {
+		return nil, err
+	}
+
+	levels := make([]StockLevel, len(changes))
+	logs := make([]db.InsertStockLogBatchParams, len(changes))
+	for i, ch := range changes {
+		row := rows[i]
+		CacheInventory(ctx, c, ch.ProductID, ch.WarehouseID, int(row.StockLevel), int(row.AlertThreshold), row.Version)
+
+		levels[i] = StockLevel{
+			ProductID:   ch.ProductID,
+			WarehouseID: ch.WarehouseID,
+			Stock:       int(row.StockLevel),
+			Threshold:   int(row.AlertThreshold),
+		}
+		logs[i] = db.InsertStockLogBatchParams{
+			ProductID:     int32(ch.ProductID),
+			WarehouseID:   int32(ch.WarehouseID),
+			PreviousStock: row.PreviousStock,
+			UpdatedStock:  row.StockLevel,
+		}
+	}
+
+	store.InsertStockLogBatch(ctx, logs).Exec(func(i int, logErr error) {
+		if logErr != nil && err == nil {
+			err = logErr
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return levels, nil
+}
+
+// checkReservations makes sure no change that took stock left less than is reserved. Reservations
+// can't change while the inventory rows are locked, so they are read once per inventory
+func checkReservations(
+	ctx context.Context,
+	store batchInventoryStore,
+	changes []StockChange,
+	rows []db.AdjustInventoryBatchRow,
+) error {
+	var params []db.SumActiveReservationsBatchParams
+	index := make(map[string]int)
+	for _, ch := range changes {
+		key := cacheKey(ch.ProductID, ch.WarehouseID)
+		if _, ok := index[key]; ch.Delta >= 0 || ok {
+			continue
+		}
+
+		index[key] = len(params)
+		params = append(params, db.SumActiveReservationsBatchParams{
+			ProductID:   int32(ch.ProductID),
+			WarehouseID: int32(ch.WarehouseID),
+		})
+	}
+	if len(params) == 0 {
+		return nil
+	}
+
+	reserved := make([]int32, len(params))
+	var err error
+	store.SumActiveReservationsBatch(ctx, params).QueryRow(func(i int, r int32, sumErr error) {
+		if sumErr != nil && err == nil {
+			err = sumErr
+		}
+		reserved[i] = r
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, ch := range changes {
+		if ch.Delta >= 0 {
+			continue
+		}
+
+		r := reserved[index[cacheKey(ch.ProductID, ch.WarehouseID)]]
+		if rows[i].StockLevel < r {
+			return fmt.Errorf(
+				"applying delta %d to stock %d with %d reserved: %w",
+				ch.Delta, rows[i].PreviousStock, r, ErrInsufficientStock,
+			)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/achere/heroku-kafka-demo-go/db/sqlc"
+	"github.com/achere/heroku-kafka-demo-go/internal/metrics"
+)
+
+// cacheKey is the key the inventory of a product in a warehouse is cached under
+func cacheKey(productID, warehouseID int) string {
+	return fmt.Sprintf("%d:%d", warehouseID, productID)
+}
+
+// cachePattern matches the keys of a product in every warehouse, of every product in a warehouse or
+// of both when either ID is zero. It is a valid pattern for both Redis SCAN and path.Match
+func cachePattern(productID, warehouseID int) string {
+	product, warehouse := "*", "*"
+	if productID != 0 {
+		product = fmt.Sprint(productID)
+	}
+	if warehouseID != 0 {
+		warehouse = fmt.Sprint(warehouseID)
+	}
+
+	return warehouse + ":" + product
+}
+
+// cacheValue is the cached stock and threshold in the format getInvFromCache parses
+func cacheValue(stock, threshold int) string {
+	return fmt.Sprintf("%d,%d", stock, threshold)
+}
+
+// CacheEntry is a versioned cache value
+type CacheEntry struct {
+	Key     string
+	Value   string
+	Version int64
+}
+
+// BulkCache writes many versioned entries at once, never replacing newer versions
+type BulkCache interface {
+	SetMany(ctx context.Context, entries []CacheEntry) error
+}
+
+// CacheInventory function caches the stock and threshold of a product in a warehouse as of version.
+// Cache errors are only logged since the database stays the source of truth
+func CacheInventory(ctx context.Context, c Cache, productID, warehouseID, stock, threshold int, version int64) {
+	key := cacheKey(productID, warehouseID)
+	val := cacheValue(stock, threshold)
+
+	if err := c.Set(ctx, key, val, version); err != nil {
+		slog.Error("cache set err", "at", "inventory", "err", err)
+	} else {
+		slog.Info("cache set", "at", "inventory", "key", key, "value", val, "version", version)
+	}
+}
+
+// cacheWrite is a Set, or a Delete when deleted is true, buffered by TxCache
+type cacheWrite struct {
+	key     string
+	value   string
+	version int64
+	deleted bool
+}
+
+// TxCache buffers the writes to a Cache made within a transaction, so the cache never holds stock
+// that was rolled back. Flush applies them once the transaction has committed. Reads see the writes
+// buffered so far
+type TxCache struct {
+	cache  Cache
+	writes []cacheWrite
+}
+
+// NewTxCache creates a TxCache that writes to c when flushed
+func NewTxCache(c Cache) *TxCache {
+	return &TxCache{cache: c}
+}
+
+func (t *TxCache) Get(ctx context.Context, key string) (string, error) {
+	for i := len(t.writes) - 1; i >= 0; i-- {
+		if w := t.writes[i]; w.key == key {
+			return w.value, nil
+		}
+	}
+
+	return t.cache.Get(ctx, key)
+}
+
+func (t *TxCache) Set(ctx context.Context, key, value string, version int64) error {
+	t.writes = append(t.writes, cacheWrite{key: key, value: value, version: version})
+	return nil
+}
+
+func (t *TxCache) Delete(ctx context.Context, key string) error {
+	t.writes = append(t.writes, cacheWrite{key: key, deleted: true})
+	return nil
+}
+
+// Flush applies the buffered writes to the underlying cache in order and forgets them. Errors are
+// logged, a failed write leaves an entry that is either replaced by a newer version or expires
+func (t *TxCache) Flush(ctx context.Context) {
+	for _, w := range t.writes {
+		var err error
+		if w.deleted {
+			err = t.cache.Delete(ctx, w.key)
+		} else {
+			err = t.cache.Set(ctx, w.key, w.value, w.version)
+		}
+
+		if err != nil {
+			slog.Error("cache flush err", "at", "inventory", "key", w.key, "err", err)
+		}
+	}
+
+	t.writes = nil
+}
+
+// ExecTx function runs fn in a transaction like db.ExecTx, handing it a cache whose writes only reach
+// c after the transaction has committed
+func ExecTx(ctx context.Context, conn db.TxBeginner, c Cache, fn func(q *db.Queries, c Cache) error) error {
+	tc := NewTxCache(c)
+
+	err := db.ExecTx(ctx, conn, metrics.ObserveTx, func(q *db.Queries) error {
+		return fn(q, tc)
+	})
+	if err != nil {
+		return err
+	}
+
+	tc.Flush(ctx)
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package inventory
+
+import (
+	"context"
+	"testing"
+)
+
+type versionedEntry struct {
+	value   string
+	version int64
+}
+
+// mapCache is a Cache that keeps entries in a map and, like RedisCache, ignores older versions
+type mapCache map[string]versionedEntry
+
+func (m mapCache) Get(ctx context.Context, key string) (string, error) {
+	return m[key].value, nil
+}
+
+func (m mapCache) Set(ctx context.Context, key, value string, version int64) error {
+	if e, ok := m[key]; ok && e.version >= version {
+		return nil
+	}
+	m[key] = versionedEntry{value, version}
+	return nil
+}
+
+func (m mapCache) Delete(ctx context.Context, key string) error {
+	delete(m, key)
+	return nil
+}
+
+func TestTxCache(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("writes are buffered until flushed", func(t *testing.T) {
+		cache := mapCache{"1:1": {"10,5", 3}}
+		tc := NewTxCache(cache)
+
+		tc.Set(ctx, "1:1", "7,5", 4)
+		tc.Delete(ctx, "1:2")
+
+		if got, _ := cache.Get(ctx, "1:1"); got != "10,5" {
+			t.Errorf("Expected cache to be unchanged before flush, got %q", got)
+		}
+
+		if got, _ := tc.Get(ctx, "1:1"); got != "7,5" {
+			t.Errorf("Expected buffered value 7,5, got %q", got)
+		}
+
+		tc.Flush(ctx)
+
+		if got, _ := cache.Get(ctx, "1:1"); got != "7,5" {
+			t.Errorf("Expected 7,5 after flush, got %q", got)
+		}
+	})
+
+	t.Run("reads see buffered deletes", func(t *testing.T) {
+		cache := mapCache{"1:1": {"10,5", 3}}
+		tc := NewTxCache(cache)
+
+		tc.Delete(ctx, "1:1")
+
+		if got, _ := tc.Get(ctx, "1:1"); got != "" {
+			t.Errorf("Expected a miss after delete, got %q", got)
+		}
+	})
+
+	t.Run("older versions don't overwrite newer ones", func(t *testing.T) {
+		cache := mapCache{"1:1": {"10,5", 5}}
+		tc := NewTxCache(cache)
+
+		tc.Set(ctx, "1:1", "7,5", 4)
+		tc.Flush(ctx)
+
+		if got, _ := cache.Get(ctx, "1:1"); got != "10,5" {
+			t.Errorf("Expected newer entry 10,5 to be kept, got %q", got)
+		}
+	})
+}
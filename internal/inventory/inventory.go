@@ -2,32 +2,60 @@ package inventory
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/achere/heroku-kafka-demo-go/db/sqlc"
+	"github.com/achere/heroku-kafka-demo-go/internal/metrics"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var (
+	// ErrNegativeStock is returned when applying a stock delta would make the stock negative
+	ErrNegativeStock = errors.New("stock would become negative")
+	// ErrInsufficientStock is returned when stock that is held by reservations would be taken
+	ErrInsufficientStock = errors.New("not enough stock available to promise")
+	// ErrDeltaOutOfRange is returned for a stock delta that doesn't fit the int32 stock columns
+	ErrDeltaOutOfRange = errors.New("stock delta out of range")
+	// ErrLevelOutOfRange is returned for a stock level or alert threshold that is negative or doesn't
+	// fit the int32 inventory columns
+	ErrLevelOutOfRange = errors.New("level out of range")
+)
+
+var cacheRequests = metrics.Default.NewCounterVec(
+	"inventory_cache_requests_total",
+	"Inventory cache lookups by result, hit or miss.",
+	"result",
 )
 
 type inventoryStore interface {
 	inventoryGetter
-	UpdateInventory(ctx context.Context, arg db.UpdateInventoryParams) error
+	AdjustInventory(ctx context.Context, arg db.AdjustInventoryParams) (db.AdjustInventoryRow, error)
 	InsertStockLog(ctx context.Context, arg db.InsertStockLogParams) error
+	SumActiveReservations(ctx context.Context, arg db.SumActiveReservationsParams) (int32, error)
 }
 
 type inventoryGetter interface {
 	GetInventory(ctx context.Context, arg db.GetInventoryParams) (db.GetInventoryRow, error)
 }
 
+// Cache holds the stock and threshold of inventory keyed by warehouse and product. Set never replaces
+// an entry with an older version, so a write that loses a race can't leave stale stock behind
 type Cache interface {
 	Get(ctx context.Context, key string) (string, error)
-	Set(ctx context.Context, key, value string, expiration time.Duration) error
+	Set(ctx context.Context, key, value string, version int64) error
+	Delete(ctx context.Context, key string) error
 }
 
 // UpdateInventory function takes product and warehouse IDs along with the stock delta, updates the
-// stock if possible and returns the updated stock along with the threshold for low stock alert
+// stock if possible and returns the updated stock along with the threshold for low stock alert. The
+// delta is applied atomically in Postgres, so concurrent updates of the same inventory never overwrite
+// each other, and the returned values are the ones Postgres holds after the update
 func UpdateInventory(
 	productID int,
 	warehouseID int,
@@ -36,73 +64,199 @@ func UpdateInventory(
 	ctx context.Context,
 	c Cache,
 ) (int, int, error) {
-	var stock, threshold int
+	return updateStock(ctx, store, c, productID, warehouseID, stockDelta, pgtype.Text{})
+}
+
+// updateStock applies a stock delta like UpdateInventory does, recording the transfer the change is a
+// leg of in the stock log when transferID is set
+func updateStock(
+	ctx context.Context,
+	store inventoryStore,
+	c Cache,
+	productID int,
+	warehouseID int,
+	stockDelta int,
+	transferID pgtype.Text,
+) (int, int, error) {
+	if err := checkDelta(stockDelta); err != nil {
+		return 0, 0, err
+	}
 
 	whID := int32(warehouseID)
 	prodID := int32(productID)
 
-	cacheKey := fmt.Sprintf("%d:%d", whID, prodID)
-
-	stock, threshold, ok := getInvFromCache(ctx, c, cacheKey)
+	inv, err := store.AdjustInventory(ctx, db.AdjustInventoryParams{
+		StockDelta:  int32(stockDelta),
+		WarehouseID: whID,
+		ProductID:   prodID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, negativeStockError(ctx, store, whID, prodID, stockDelta)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	slog.Info("db dml", "at", "inventory", "action", "AdjustInventory", "value", fmt.Sprintf("%+v", inv))
 
-	if !ok {
-		inv, err := store.GetInventory(
-			ctx,
-			db.GetInventoryParams{
-				WarehouseID: whID,
-				ProductID:   prodID,
-			},
-		)
+	// The row stays locked until the transaction ends, so no reservation can be created in between
+	if stockDelta < 0 {
+		reserved, err := store.SumActiveReservations(ctx, db.SumActiveReservationsParams{
+			ProductID:   prodID,
+			WarehouseID: whID,
+		})
 		if err != nil {
 			return 0, 0, err
 		}
-		slog.Info("db get", "at", "inventory", "query", "GetInventory", "value", fmt.Sprintf("%+v", inv))
 
-		stock = int(inv.StockLevel)
-		threshold = int(inv.AlertThreshold)
+		if inv.StockLevel < reserved {
+			return 0, 0, fmt.Errorf(
+				"applying delta %d to stock %d with %d reserved: %w",
+				stockDelta, inv.PreviousStock, reserved, ErrInsufficientStock,
+			)
+		}
 	}
 
-	newStock := stock + stockDelta
-	if newStock < 0 {
-		return 0, 0, fmt.Errorf("applying delta %d to stock %d would make it negative", stockDelta, stock)
-	}
+	CacheInventory(ctx, c, productID, warehouseID, int(inv.StockLevel), int(inv.AlertThreshold), inv.Version)
 
-	slog.Info("db dml", "at", "inventory", "action", "UpdateInvenotry", "value", newStock)
-	updStock := int32(newStock)
-	err := store.UpdateInventory(
+	err = store.InsertStockLog(
 		ctx,
-		db.UpdateInventoryParams{
-			StockLevel:  updStock,
-			WarehouseID: whID,
-			ProductID:   prodID,
+		db.InsertStockLogParams{
+			PreviousStock: inv.PreviousStock,
+			UpdatedStock:  inv.StockLevel,
+			WarehouseID:   whID,
+			ProductID:     prodID,
+			TransferID:    transferID,
 		},
 	)
 	if err != nil {
 		return 0, 0, err
 	}
 
-	cacheVal := fmt.Sprintf("%d,%d", newStock, threshold)
-	err = c.Set(ctx, cacheKey, cacheVal, 0)
+	return int(inv.StockLevel), int(inv.AlertThreshold), nil
+}
+
+// checkDelta rejects a stock delta that would wrap around when stored as an int32
+func checkDelta(delta int) error {
+	if delta < math.MinInt32 || delta > math.MaxInt32 {
+		return fmt.Errorf("%d: %w", delta, ErrDeltaOutOfRange)
+	}
+
+	return nil
+}
+
+// checkLevel rejects a stock level or alert threshold that is negative or would wrap around when
+// stored as an int32
+func checkLevel(name string, level int) error {
+	if level < 0 || level > math.MaxInt32 {
+		return fmt.Errorf("%s %d: %w", name, level, ErrLevelOutOfRange)
+	}
+
+	return nil
+}
+
+// negativeStockError tells why AdjustInventory updated no row: the inventory doesn't exist, which is
+// reported as pgx.ErrNoRows, or the delta would have made the stock negative
+func negativeStockError(ctx context.Context, store inventoryGetter, whID, prodID int32, stockDelta int) error {
+	inv, err := store.GetInventory(ctx, db.GetInventoryParams{
+		WarehouseID: whID,
+		ProductID:   prodID,
+	})
 	if err != nil {
-		slog.Error("cache set err", "at", "inventory", "err", err)
-	} else {
-		slog.Info("cache set", "at", "inventory", "key", cacheKey, "value", cacheVal)
+		return err
 	}
 
-	err = store.InsertStockLog(
-		ctx,
-		db.InsertStockLogParams{
-			PreviousStock: int32(stock),
-			UpdatedStock:  updStock,
-			WarehouseID:   whID,
-			ProductID:     prodID,
-		},
-	)
+	return fmt.Errorf("applying delta %d to stock %d: %w", stockDelta, inv.StockLevel, ErrNegativeStock)
+}
+
+type thresholdStore interface {
+	UpdateAlertThreshold(ctx context.Context, arg db.UpdateAlertThresholdParams) (db.UpdateAlertThresholdRow, error)
+}
+
+// UpdateThreshold function sets the low-stock alert threshold of a product in a warehouse, caches the
+// updated inventory and returns the current stock
+func UpdateThreshold(
+	ctx context.Context,
+	store thresholdStore,
+	c Cache,
+	productID int,
+	warehouseID int,
+	threshold int,
+) (int, error) {
+	if err := checkLevel("threshold", threshold); err != nil {
+		return 0, err
+	}
+
+	inv, err := store.UpdateAlertThreshold(ctx, db.UpdateAlertThresholdParams{
+		AlertThreshold: int32(threshold),
+		WarehouseID:    int32(warehouseID),
+		ProductID:      int32(productID),
+	})
 	if err != nil {
-		return 0, 0, err
+		return 0, err
+	}
+	slog.Info("db dml", "at", "inventory", "action", "UpdateAlertThreshold", "value", fmt.Sprintf("%+v", inv))
+
+	CacheInventory(ctx, c, productID, warehouseID, int(inv.StockLevel), int(inv.AlertThreshold), inv.Version)
+
+	return int(inv.StockLevel), nil
+}
+
+type provisionStore interface {
+	GetProduct(ctx context.Context, productID int32) (db.Product, error)
+	GetWarehouse(ctx context.Context, warehouseID int32) (db.Warehouse, error)
+	CreateInventory(ctx context.Context, arg db.CreateInventoryParams) (db.Inventory, error)
+	InsertStockLog(ctx context.Context, arg db.InsertStockLogParams) error
+}
+
+// ProvisionInventory function creates the inventory of a product in a warehouse with its initial stock
+// and low-stock alert threshold, recording the initial stock in the stock log. Deleted products and
+// warehouses can't be provisioned
+func ProvisionInventory(
+	ctx context.Context,
+	store provisionStore,
+	productID int,
+	warehouseID int,
+	stock int,
+	threshold int,
+) (db.Inventory, error) {
+	if err := checkLevel("stock", stock); err != nil {
+		return db.Inventory{}, err
+	}
+
+	if err := checkLevel("threshold", threshold); err != nil {
+		return db.Inventory{}, err
+	}
+
+	if _, err := store.GetProduct(ctx, int32(productID)); err != nil {
+		return db.Inventory{}, fmt.Errorf("product %d: %w", productID, err)
 	}
 
-	return newStock, threshold, nil
+	if _, err := store.GetWarehouse(ctx, int32(warehouseID)); err != nil {
+		return db.Inventory{}, fmt.Errorf("warehouse %d: %w", warehouseID, err)
+	}
+
+	inv, err := store.CreateInventory(ctx, db.CreateInventoryParams{
+		ProductID:      int32(productID),
+		WarehouseID:    int32(warehouseID),
+		StockLevel:     int32(stock),
+		AlertThreshold: int32(threshold),
+	})
+	if err != nil {
+		return db.Inventory{}, err
+	}
+	slog.Info("db dml", "at", "inventory", "action", "CreateInventory", "value", fmt.Sprintf("%+v", inv))
+
+	err = store.InsertStockLog(ctx, db.InsertStockLogParams{
+		PreviousStock: 0,
+		UpdatedStock:  inv.StockLevel,
+		WarehouseID:   inv.WarehouseID,
+		ProductID:     inv.ProductID,
+	})
+	if err != nil {
+		return db.Inventory{}, err
+	}
+
+	return inv, nil
 }
 
 // FetchInventory function takes product and warehouse IDs as a paramater and returns matching stock
@@ -113,35 +267,28 @@ func FetchInventory(
 	ctx context.Context,
 	c Cache,
 ) (int, error) {
-	cacheKey := fmt.Sprintf("%d:%d", warehouseID, productID)
-	stock, threshold, ok := getInvFromCache(ctx, c, cacheKey)
-
-	if !ok {
-		inv, err := store.GetInventory(
-			ctx,
-			db.GetInventoryParams{
-				WarehouseID: int32(warehouseID),
-				ProductID:   int32(productID),
-			},
-		)
-		if err != nil {
-			return 0, err
-		}
-		slog.Info("db get", "at", "inventory", "query", "GetInventory", "value", fmt.Sprintf("%+v", inv))
-
-		stock = int(inv.StockLevel)
-		threshold = int(inv.AlertThreshold)
+	stock, _, ok := getInvFromCache(ctx, c, cacheKey(productID, warehouseID))
+	if ok {
+		return stock, nil
 	}
 
-	cacheVal := fmt.Sprintf("%d,%d", stock, threshold)
-	err := c.Set(ctx, cacheKey, cacheVal, 0)
+	inv, err := store.GetInventory(
+		ctx,
+		db.GetInventoryParams{
+			WarehouseID: int32(warehouseID),
+			ProductID:   int32(productID),
+		},
+	)
 	if err != nil {
-		slog.Error("cache set err", "at", "inventory", "err", err)
-	} else {
-		slog.Info("cache set", "at", "inventory", "key", cacheKey, "value", cacheVal)
+		return 0, err
 	}
+	slog.Info("db get", "at", "inventory", "query", "GetInventory", "value", fmt.Sprintf("%+v", inv))
+
+	// A concurrent update may commit between the read and the write, the version keeps it from
+	// being overwritten with the stock read here
+	CacheInventory(ctx, c, productID, warehouseID, int(inv.StockLevel), int(inv.AlertThreshold), inv.Version)
 
-	return stock, nil
+	return int(inv.StockLevel), nil
 }
 
 func getInvFromCache(ctx context.Context, c Cache, key string) (int, int, bool) {
@@ -152,6 +299,13 @@ func getInvFromCache(ctx context.Context, c Cache, key string) (int, int, bool)
 		slog.Error("cache get err", "at", "inventory", "err", err)
 	}
 	slog.Info("cache get", "at", "inventory", "value", invCached)
+	defer func() {
+		if cacheValid {
+			cacheRequests.Inc("hit")
+		} else {
+			cacheRequests.Inc("miss")
+		}
+	}()
 
 	if invCached != "" {
 		vals := strings.Split(invCached, ",")
@@ -0,0 +1,201 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/achere/heroku-kafka-demo-go/db/sqlc"
+	"github.com/jackc/pgx/v5"
+)
+
+// fakeInventoryStore holds a single inventory and applies deltas like the AdjustInventory query
+type fakeInventoryStore struct {
+	exists    bool
+	stock     int32
+	threshold int32
+	version   int64
+	reserved  int32
+	logs      []db.InsertStockLogParams
+}
+
+func (s *fakeInventoryStore) GetInventory(ctx context.Context, arg db.GetInventoryParams) (db.GetInventoryRow, error) {
+	if !s.exists {
+		return db.GetInventoryRow{}, pgx.ErrNoRows
+	}
+
+	return db.GetInventoryRow{StockLevel: s.stock, AlertThreshold: s.threshold, Version: s.version}, nil
+}
+
+func (s *fakeInventoryStore) AdjustInventory(ctx context.Context, arg db.AdjustInventoryParams) (db.AdjustInventoryRow, error) {
+	if !s.exists || s.stock+arg.StockDelta < 0 {
+		return db.AdjustInventoryRow{}, pgx.ErrNoRows
+	}
+
+	prev := s.stock
+	s.stock += arg.StockDelta
+	s.version++
+
+	return db.AdjustInventoryRow{
+		PreviousStock:  prev,
+		StockLevel:     s.stock,
+		AlertThreshold: s.threshold,
+		Version:        s.version,
+	}, nil
+}
+
+func (s *fakeInventoryStore) InsertStockLog(ctx context.Context, arg db.InsertStockLogParams) error {
+	s.logs = append(s.logs, arg)
+	return nil
+}
+
+func (s *fakeInventoryStore) SumActiveReservations(ctx context.Context, arg db.SumActiveReservationsParams) (int32, error) {
+	return s.reserved, nil
+}
+
+func (s *fakeInventoryStore) UpdateAlertThreshold(ctx context.Context, arg db.UpdateAlertThresholdParams) (db.UpdateAlertThresholdRow, error) {
+	if !s.exists {
+		return db.UpdateAlertThresholdRow{}, pgx.ErrNoRows
+	}
+
+	s.threshold = arg.AlertThreshold
+	s.version++
+
+	return db.UpdateAlertThresholdRow{StockLevel: s.stock, AlertThreshold: s.threshold, Version: s.version}, nil
+}
+
+func TestUpdateInventory(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("returns the stock from the database rather than the cache", func(t *testing.T) {
+		store := &fakeInventoryStore{exists: true, stock: 10, threshold: 5, version: 3}
+		cache := mapCache{"2:1": {"99,5", 2}}
+
+		stock, threshold, err := UpdateInventory(1, 2, -4, store, ctx, cache)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		if stock != 6 || threshold != 5 {
+			t.Errorf("Expected stock 6 and threshold 5, got %d and %d", stock, threshold)
+		}
+
+		if e := cache["2:1"]; e.value != "6,5" || e.version != 4 {
+			t.Errorf("Expected cache to hold 6,5 at version 4, got %+v", e)
+		}
+
+		if len(store.logs) != 1 || store.logs[0].PreviousStock != 10 || store.logs[0].UpdatedStock != 6 {
+			t.Errorf("Expected a stock log from 10 to 6, got %+v", store.logs)
+		}
+	})
+
+	t.Run("rejects negative stock", func(t *testing.T) {
+		store := &fakeInventoryStore{exists: true, stock: 3, threshold: 5, version: 1}
+
+		_, _, err := UpdateInventory(1, 2, -4, store, ctx, mapCache{})
+		if !errors.Is(err, ErrNegativeStock) {
+			t.Errorf("Expected ErrNegativeStock, got %v", err)
+		}
+	})
+
+	t.Run("rejects taking reserved stock", func(t *testing.T) {
+		store := &fakeInventoryStore{exists: true, stock: 10, threshold: 5, version: 1, reserved: 8}
+
+		_, _, err := UpdateInventory(1, 2, -4, store, ctx, mapCache{})
+		if !errors.Is(err, ErrInsufficientStock) {
+			t.Errorf("Expected ErrInsufficientStock, got %v", err)
+		}
+	})
+
+	t.Run("rejects deltas out of the int32 range", func(t *testing.T) {
+		store := &fakeInventoryStore{exists: true, stock: 10, threshold: 5, version: 1}
+
+		_, _, err := UpdateInventory(1, 2, 4294967295, store, ctx, mapCache{})
+		if !errors.Is(err, ErrDeltaOutOfRange) {
+			t.Errorf("Expected ErrDeltaOutOfRange, got %v", err)
+		}
+
+		if store.stock != 10 {
+			t.Errorf("Expected stock to stay 10, got %d", store.stock)
+		}
+	})
+
+	t.Run("reports missing inventory", func(t *testing.T) {
+		_, _, err := UpdateInventory(1, 2, 4, &fakeInventoryStore{}, ctx, mapCache{})
+		if !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("Expected pgx.ErrNoRows, got %v", err)
+		}
+	})
+}
+
+func TestUpdateInventoryBatch(t *testing.T) {
+	t.Run("rejects deltas out of the int32 range before sending the batch", func(t *testing.T) {
+		changes := []StockChange{
+			{ProductID: 1, WarehouseID: 2, Delta: 3},
+			{ProductID: 1, WarehouseID: 2, Delta: -4294967297},
+		}
+
+		_, err := UpdateInventoryBatch(context.Background(), nil, mapCache{}, changes)
+		if !errors.Is(err, ErrDeltaOutOfRange) {
+			t.Errorf("Expected ErrDeltaOutOfRange, got %v", err)
+		}
+	})
+}
+
+func TestUpdateThreshold(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("sets the threshold and caches the inventory", func(t *testing.T) {
+		store := &fakeInventoryStore{exists: true, stock: 10, threshold: 5, version: 1}
+		cache := mapCache{}
+
+		stock, err := UpdateThreshold(ctx, store, cache, 1, 2, 8)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		if stock != 10 || store.threshold != 8 {
+			t.Errorf("Expected stock 10 and threshold 8, got %d and %d", stock, store.threshold)
+		}
+
+		if e := cache["2:1"]; e.value != "10,8" || e.version != 2 {
+			t.Errorf("Expected cache to hold 10,8 at version 2, got %+v", e)
+		}
+	})
+
+	for name, threshold := range map[string]int{"negative": -1, "above int32": 1 << 31} {
+		t.Run("rejects "+name+" thresholds", func(t *testing.T) {
+			store := &fakeInventoryStore{exists: true, stock: 10, threshold: 5, version: 1}
+
+			_, err := UpdateThreshold(ctx, store, mapCache{}, 1, 2, threshold)
+			if !errors.Is(err, ErrLevelOutOfRange) {
+				t.Errorf("Expected ErrLevelOutOfRange, got %v", err)
+			}
+
+			if store.threshold != 5 {
+				t.Errorf("Expected threshold to stay 5, got %d", store.threshold)
+			}
+		})
+	}
+}
+
+func TestProvisionInventoryRange(t *testing.T) {
+	ctx := context.Background()
+
+	tests := map[string]struct{ stock, threshold int }{
+		"negative stock":        {-1, 0},
+		"stock above int32":     {1 << 32, 0},
+		"negative threshold":    {10, -1},
+		"threshold above int32": {10, 1<<31 + 1},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// the store is never reached, so it is left nil
+			_, err := ProvisionInventory(ctx, nil, 1, 1, tt.stock, tt.threshold)
+			if !errors.Is(err, ErrLevelOutOfRange) {
+				t.Errorf("Expected ErrLevelOutOfRange, got %v", err)
+			}
+		})
+	}
+}
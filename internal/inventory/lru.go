@@ -0,0 +1,209 @@
+package inventory
+
+import (
+	"container/list"
+	"context"
+	"log/slog"
+	"path"
+	"sync"
+	"time"
+)
+
+// InvalidationBus tells other instances to drop cached keys matching a pattern
+type InvalidationBus interface {
+	Publish(ctx context.Context, pattern string) error
+}
+
+type lruEntry struct {
+	key       string
+	value     string
+	expiresAt time.Time
+}
+
+// lruRead is a read through of a key in flight, its generation moves whenever the key is evicted so
+// the readers don't store a value that was invalidated while it was being read
+type lruRead struct {
+	readers    int
+	generation uint64
+}
+
+// LRUCache is a bounded in-memory Cache layered over another one, usually a RedisCache. It only holds
+// values read through from the next cache, writes drop the local entry, go to the next cache and are
+// published on the bus so other instances drop theirs as well. Entries expire after ttl or never if
+// it is zero
+type LRUCache struct {
+	next Cache
+	bus  InvalidationBus
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+	// reads holds the keys being read through, only evicting one of them keeps its value from being
+	// stored
+	reads map[string]*lruRead
+}
+
+// NewLRUCache creates an LRUCache holding up to size entries in front of next, bus may be nil for a
+// single instance
+func NewLRUCache(next Cache, bus InvalidationBus, size int, ttl time.Duration) *LRUCache {
+	return &LRUCache{
+		next:  next,
+		bus:   bus,
+		size:  max(size, 1),
+		ttl:   ttl,
+		now:   time.Now,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+		reads: make(map[string]*lruRead),
+	}
+}
+
+func (c *LRUCache) Get(ctx context.Context, key string) (string, error) {
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*lruEntry)
+		if e.expiresAt.IsZero() || c.now().Before(e.expiresAt) {
+			c.ll.MoveToFront(el)
+			c.mu.Unlock()
+			return e.value, nil
+		}
+		c.remove(el)
+	}
+	read, ok := c.reads[key]
+	if !ok {
+		read = &lruRead{}
+		c.reads[key] = read
+	}
+	read.readers++
+	generation := read.generation
+	c.mu.Unlock()
+
+	val, err := c.next.Get(ctx, key)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if read.readers--; read.readers == 0 {
+		delete(c.reads, key)
+	}
+
+	if err != nil || val == "" {
+		return val, err
+	}
+
+	if read.generation == generation {
+		c.add(key, val)
+	}
+
+	return val, nil
+}
+
+func (c *LRUCache) Set(ctx context.Context, key, value string, version int64) error {
+	c.Evict(key)
+
+	if err := c.next.Set(ctx, key, value, version); err != nil {
+		return err
+	}
+
+	c.publish(ctx, key)
+	return nil
+}
+
+func (c *LRUCache) Delete(ctx context.Context, key string) error {
+	c.Evict(key)
+
+	if err := c.next.Delete(ctx, key); err != nil {
+		return err
+	}
+
+	c.publish(ctx, key)
+	return nil
+}
+
+// Invalidate drops the local entries of a product, a warehouse or everything when both IDs are zero on
+// every instance and invalidates the next cache if it supports it. It returns the number of entries
+// deleted from the next cache
+func (c *LRUCache) Invalidate(ctx context.Context, productID, warehouseID int) (int, error) {
+	pattern := cachePattern(productID, warehouseID)
+	c.Evict(pattern)
+	defer c.publish(ctx, pattern)
+
+	if inv, ok := c.next.(interface {
+		Invalidate(ctx context.Context, productID, warehouseID int) (int, error)
+	}); ok {
+		return inv.Invalidate(ctx, productID, warehouseID)
+	}
+
+	return 0, nil
+}
+
+// Evict drops the local entries whose keys match pattern, it is called with the invalidations other
+// instances publish
+func (c *LRUCache) Evict(pattern string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[pattern]; ok {
+		c.remove(el)
+	} else {
+		for key, el := range c.items {
+			if ok, _ := path.Match(pattern, key); ok {
+				c.remove(el)
+			}
+		}
+	}
+
+	for key, read := range c.reads {
+		if ok, _ := path.Match(pattern, key); ok {
+			read.generation++
+		}
+	}
+}
+
+// Len returns the number of entries held locally, including expired ones not evicted yet
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ll.Len()
+}
+
+// add stores a value, evicting the least recently used entry when full. It must be called with mu held
+func (c *LRUCache) add(key, value string) {
+	var expiresAt time.Time
+	if c.ttl > 0 {
+		expiresAt = c.now().Add(c.ttl)
+	}
+
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*lruEntry)
+		e.value, e.expiresAt = value, expiresAt
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+
+	if c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+	}
+}
+
+// remove drops an entry. It must be called with mu held
+func (c *LRUCache) remove(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*lruEntry).key)
+}
+
+func (c *LRUCache) publish(ctx context.Context, pattern string) {
+	if c.bus == nil {
+		return
+	}
+
+	if err := c.bus.Publish(ctx, pattern); err != nil {
+		slog.Error("cache invalidation publish err", "at", "inventory", "pattern", pattern, "err", err)
+	}
+}
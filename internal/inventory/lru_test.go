@@ -0,0 +1,135 @@
+package inventory
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type recordingBus struct {
+	patterns []string
+}
+
+func (b *recordingBus) Publish(ctx context.Context, pattern string) error {
+	b.patterns = append(b.patterns, pattern)
+	return nil
+}
+
+// hookCache calls onGet before reading from a mapCache, to act while a read through is in flight
+type hookCache struct {
+	mapCache
+	onGet func(key string)
+}
+
+func (h *hookCache) Get(ctx context.Context, key string) (string, error) {
+	h.onGet(key)
+	return h.mapCache.Get(ctx, key)
+}
+
+func TestLRUCache(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("reads through and evicts the least recently used entry", func(t *testing.T) {
+		next := mapCache{"1:1": {"10,5", 1}, "1:2": {"20,5", 1}, "1:3": {"30,5", 1}}
+		c := NewLRUCache(next, nil, 2, 0)
+
+		c.Get(ctx, "1:1")
+		c.Get(ctx, "1:2")
+		c.Get(ctx, "1:1")
+		c.Get(ctx, "1:3")
+
+		if c.Len() != 2 {
+			t.Fatalf("Expected 2 entries, got %d", c.Len())
+		}
+
+		// 1:2 was the least recently used, a change in the next cache is only seen for it
+		next["1:1"] = versionedEntry{"11,5", 2}
+		next["1:2"] = versionedEntry{"21,5", 2}
+
+		if got, _ := c.Get(ctx, "1:1"); got != "10,5" {
+			t.Errorf("Expected 1:1 to be served locally, got %q", got)
+		}
+
+		if got, _ := c.Get(ctx, "1:2"); got != "21,5" {
+			t.Errorf("Expected 1:2 to be read through, got %q", got)
+		}
+	})
+
+	t.Run("entries expire after the ttl", func(t *testing.T) {
+		next := mapCache{"1:1": {"10,5", 1}}
+		c := NewLRUCache(next, nil, 10, time.Minute)
+
+		now := time.Now()
+		c.now = func() time.Time { return now }
+
+		c.Get(ctx, "1:1")
+		next["1:1"] = versionedEntry{"11,5", 2}
+
+		now = now.Add(2 * time.Minute)
+
+		if got, _ := c.Get(ctx, "1:1"); got != "11,5" {
+			t.Errorf("Expected the expired entry to be read through, got %q", got)
+		}
+	})
+
+	t.Run("writes drop the local entry and are published", func(t *testing.T) {
+		next := mapCache{"1:1": {"10,5", 1}}
+		bus := &recordingBus{}
+		c := NewLRUCache(next, bus, 10, 0)
+
+		c.Get(ctx, "1:1")
+		c.Set(ctx, "1:1", "7,5", 2)
+
+		if got, _ := c.Get(ctx, "1:1"); got != "7,5" {
+			t.Errorf("Expected the written value, got %q", got)
+		}
+
+		c.Delete(ctx, "1:1")
+
+		if len(bus.patterns) != 2 || bus.patterns[0] != "1:1" || bus.patterns[1] != "1:1" {
+			t.Errorf("Expected 2 invalidations of 1:1, got %v", bus.patterns)
+		}
+	})
+
+	t.Run("evicts keys matching a pattern", func(t *testing.T) {
+		next := mapCache{"1:1": {"10,5", 1}, "2:1": {"20,5", 1}, "1:2": {"30,5", 1}}
+		c := NewLRUCache(next, nil, 10, 0)
+
+		for key := range next {
+			c.Get(ctx, key)
+		}
+
+		c.Evict(cachePattern(1, 0))
+
+		if c.Len() != 1 {
+			t.Errorf("Expected only 1:2 to be left, got %d entries", c.Len())
+		}
+	})
+
+	t.Run("doesn't store a value evicted while it was read through", func(t *testing.T) {
+		next := &hookCache{mapCache: mapCache{"1:1": {"10,5", 1}, "1:2": {"20,5", 1}}}
+		c := NewLRUCache(next, nil, 10, 0)
+
+		next.onGet = func(key string) { c.Evict(cachePattern(1, 0)) }
+		c.Get(ctx, "1:1")
+
+		if c.Len() != 0 {
+			t.Errorf("Expected the evicted value not to be stored, got %d entries", c.Len())
+		}
+	})
+
+	t.Run("stores a value read through while another key is evicted", func(t *testing.T) {
+		next := &hookCache{mapCache: mapCache{"1:1": {"10,5", 1}, "2:1": {"20,5", 1}}}
+		c := NewLRUCache(next, nil, 10, 0)
+
+		next.onGet = func(key string) { c.Evict("2:1") }
+		c.Get(ctx, "1:1")
+
+		if c.Len() != 1 {
+			t.Errorf("Expected 1:1 to be stored, got %d entries", c.Len())
+		}
+		if len(c.reads) != 0 {
+			t.Errorf("Expected no reads in flight, got %d", len(c.reads))
+		}
+	})
+}
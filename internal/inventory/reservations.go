@@ -0,0 +1,202 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/achere/heroku-kafka-demo-go/db/sqlc"
+	"github.com/jackc/pgx/v5"
+)
+
+// Reservation statuses, only active reservations hold stock
+const (
+	ReservationActive    = "active"
+	ReservationConfirmed = "confirmed"
+	ReservationReleased  = "released"
+	ReservationExpired   = "expired"
+)
+
+var (
+	// ErrReservationExists is returned when creating a reservation with an ID that is already taken
+	ErrReservationExists = errors.New("reservation already exists")
+	// ErrReservationNotActive is returned when confirming or releasing a reservation that was already
+	// confirmed, released or has expired
+	ErrReservationNotActive = errors.New("reservation is not active")
+)
+
+type reservationStore interface {
+	GetInventoryForUpdate(ctx context.Context, arg db.GetInventoryForUpdateParams) (db.GetInventoryForUpdateRow, error)
+	SumActiveReservations(ctx context.Context, arg db.SumActiveReservationsParams) (int32, error)
+	CreateReservation(ctx context.Context, arg db.CreateReservationParams) (db.Reservation, error)
+	GetReservationForUpdate(ctx context.Context, reservationID string) (db.GetReservationForUpdateRow, error)
+	UpdateReservationStatus(ctx context.Context, arg db.UpdateReservationStatusParams) error
+}
+
+// Reserve function holds quantity units of a product in a warehouse until the reservation is
+// confirmed, released or ttl passes. It returns the reservation along with the stock that is still
+// available to promise, which is the stock level minus active reservations
+func Reserve(
+	ctx context.Context,
+	store reservationStore,
+	reservationID string,
+	productID int,
+	warehouseID int,
+	quantity int,
+	ttl time.Duration,
+) (db.Reservation, int, error) {
+	inv, err := store.GetInventoryForUpdate(ctx, db.GetInventoryForUpdateParams{
+		WarehouseID: int32(warehouseID),
+		ProductID:   int32(productID),
+	})
+	if err != nil {
+		return db.Reservation{}, 0, err
+	}
+
+	reserved, err := store.SumActiveReservations(ctx, db.SumActiveReservationsParams{
+		ProductID:   int32(productID),
+		WarehouseID: int32(warehouseID),
+	})
+	if err != nil {
+		return db.Reservation{}, 0, err
+	}
+
+	available := int(inv.StockLevel - reserved)
+	if quantity > available {
+		return db.Reservation{}, 0, fmt.Errorf(
+			"reserving %d with %d available: %w", quantity, available, ErrInsufficientStock,
+		)
+	}
+
+	res, err := store.CreateReservation(ctx, db.CreateReservationParams{
+		ReservationID: reservationID,
+		ProductID:     int32(productID),
+		WarehouseID:   int32(warehouseID),
+		Quantity:      int32(quantity),
+		TtlSeconds:    int32(ttl.Seconds()),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.Reservation{}, 0, fmt.Errorf("reservation %s: %w", reservationID, ErrReservationExists)
+	}
+	if err != nil {
+		return db.Reservation{}, 0, err
+	}
+	slog.Info("db dml", "at", "inventory", "action", "CreateReservation", "value", fmt.Sprintf("%+v", res))
+
+	return res, available - quantity, nil
+}
+
+// ConfirmReservation function turns an active reservation into a permanent stock decrease and returns
+// the reservation along with the updated stock and the threshold for low stock alert
+func ConfirmReservation(
+	ctx context.Context,
+	store confirmStore,
+	c Cache,
+	reservationID string,
+) (db.GetReservationForUpdateRow, int, int, error) {
+	res, err := lockActiveReservation(ctx, store, reservationID)
+	if err != nil {
+		return res, 0, 0, err
+	}
+
+	// Confirm first so the reservation no longer holds the stock it is about to take
+	err = store.UpdateReservationStatus(ctx, db.UpdateReservationStatusParams{
+		Status:        ReservationConfirmed,
+		ReservationID: reservationID,
+	})
+	if err != nil {
+		return res, 0, 0, err
+	}
+
+	stock, threshold, err := UpdateInventory(
+		int(res.ProductID), int(res.WarehouseID), -int(res.Quantity), store, ctx, c,
+	)
+	if err != nil {
+		return res, 0, 0, err
+	}
+
+	return res, stock, threshold, nil
+}
+
+// ReleaseReservation function releases an active reservation, making its stock available again
+func ReleaseReservation(
+	ctx context.Context,
+	store reservationStore,
+	reservationID string,
+) (db.GetReservationForUpdateRow, error) {
+	res, err := lockActiveReservation(ctx, store, reservationID)
+	if err != nil {
+		return res, err
+	}
+
+	err = store.UpdateReservationStatus(ctx, db.UpdateReservationStatusParams{
+		Status:        ReservationReleased,
+		ReservationID: reservationID,
+	})
+	if err != nil {
+		return res, err
+	}
+	res.Status = ReservationReleased
+
+	return res, nil
+}
+
+// lockActiveReservation locks a reservation for the rest of the transaction, failing if it is not
+// active or has expired without being swept yet
+func lockActiveReservation(
+	ctx context.Context,
+	store reservationStore,
+	reservationID string,
+) (db.GetReservationForUpdateRow, error) {
+	res, err := store.GetReservationForUpdate(ctx, reservationID)
+	if err != nil {
+		return res, err
+	}
+
+	if res.Status != ReservationActive || res.Expired {
+		status := res.Status
+		if res.Expired {
+			status = ReservationExpired
+		}
+
+		return res, fmt.Errorf("reservation %s is %s: %w", reservationID, status, ErrReservationNotActive)
+	}
+
+	return res, nil
+}
+
+type confirmStore interface {
+	reservationStore
+	inventoryStore
+}
+
+type reservationExpirer interface {
+	ExpireReservations(ctx context.Context) (int64, error)
+}
+
+// SweepExpiredReservations function marks reservations past their TTL as expired every interval
+// until ctx is done. Expired reservations already stop holding stock, sweeping keeps the table tidy
+func SweepExpiredReservations(ctx context.Context, store reservationExpirer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		expired, err := store.ExpireReservations(ctx)
+		if err != nil {
+			slog.Error("error expiring reservations", "at", "inventory", "err", err)
+			continue
+		}
+
+		if expired > 0 {
+			slog.Info("reservations expired", "at", "inventory", "count", expired)
+		}
+	}
+}
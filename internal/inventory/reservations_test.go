@@ -0,0 +1,293 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/achere/heroku-kafka-demo-go/db/sqlc"
+	"github.com/jackc/pgx/v5"
+)
+
+type fakeReservation struct {
+	row       db.GetReservationForUpdateRow
+	expiresAt time.Time
+}
+
+// fakeReservationStore holds reservations of the inventory of fakeInventoryStore, with a clock the
+// tests move forward to let reservations expire
+type fakeReservationStore struct {
+	*fakeInventoryStore
+	now          time.Time
+	reservations map[string]*fakeReservation
+}
+
+func newFakeReservationStore(stock int32) *fakeReservationStore {
+	return &fakeReservationStore{
+		fakeInventoryStore: &fakeInventoryStore{exists: true, stock: stock, threshold: 5, version: 1},
+		now:                time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC),
+		reservations:       make(map[string]*fakeReservation),
+	}
+}
+
+func (s *fakeReservationStore) GetInventoryForUpdate(ctx context.Context, arg db.GetInventoryForUpdateParams) (db.GetInventoryForUpdateRow, error) {
+	if !s.exists {
+		return db.GetInventoryForUpdateRow{}, pgx.ErrNoRows
+	}
+
+	return db.GetInventoryForUpdateRow{StockLevel: s.stock, AlertThreshold: s.threshold, Version: s.version}, nil
+}
+
+// SumActiveReservations sums the active reservations that haven't expired, like the query does
+func (s *fakeReservationStore) SumActiveReservations(ctx context.Context, arg db.SumActiveReservationsParams) (int32, error) {
+	var sum int32
+	for _, r := range s.reservations {
+		if r.row.Status == ReservationActive && s.now.Before(r.expiresAt) {
+			sum += r.row.Quantity
+		}
+	}
+
+	return sum, nil
+}
+
+func (s *fakeReservationStore) CreateReservation(ctx context.Context, arg db.CreateReservationParams) (db.Reservation, error) {
+	if _, ok := s.reservations[arg.ReservationID]; ok {
+		return db.Reservation{}, pgx.ErrNoRows
+	}
+
+	s.reservations[arg.ReservationID] = &fakeReservation{
+		row: db.GetReservationForUpdateRow{
+			ReservationID: arg.ReservationID,
+			ProductID:     arg.ProductID,
+			WarehouseID:   arg.WarehouseID,
+			Quantity:      arg.Quantity,
+			Status:        ReservationActive,
+		},
+		expiresAt: s.now.Add(time.Duration(arg.TtlSeconds) * time.Second),
+	}
+
+	return db.Reservation{
+		ReservationID: arg.ReservationID,
+		ProductID:     arg.ProductID,
+		WarehouseID:   arg.WarehouseID,
+		Quantity:      arg.Quantity,
+		Status:        ReservationActive,
+	}, nil
+}
+
+func (s *fakeReservationStore) GetReservationForUpdate(ctx context.Context, reservationID string) (db.GetReservationForUpdateRow, error) {
+	r, ok := s.reservations[reservationID]
+	if !ok {
+		return db.GetReservationForUpdateRow{}, pgx.ErrNoRows
+	}
+
+	row := r.row
+	row.Expired = !s.now.Before(r.expiresAt)
+	return row, nil
+}
+
+func (s *fakeReservationStore) UpdateReservationStatus(ctx context.Context, arg db.UpdateReservationStatusParams) error {
+	s.reservations[arg.ReservationID].row.Status = arg.Status
+	return nil
+}
+
+func (s *fakeReservationStore) status(reservationID string) string {
+	return s.reservations[reservationID].row.Status
+}
+
+func TestReserve(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("holds stock until it is no longer available", func(t *testing.T) {
+		store := newFakeReservationStore(10)
+
+		_, available, err := Reserve(ctx, store, "r-1", 1, 2, 6, time.Minute)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		if available != 4 {
+			t.Errorf("Expected 4 available, got %d", available)
+		}
+
+		_, _, err = Reserve(ctx, store, "r-2", 1, 2, 5, time.Minute)
+		if !errors.Is(err, ErrInsufficientStock) {
+			t.Errorf("Expected ErrInsufficientStock, got %v", err)
+		}
+
+		if _, ok := store.reservations["r-2"]; ok {
+			t.Error("Expected r-2 not to be created")
+		}
+	})
+
+	t.Run("rejects a taken reservation ID", func(t *testing.T) {
+		store := newFakeReservationStore(10)
+
+		if _, _, err := Reserve(ctx, store, "r-1", 1, 2, 1, time.Minute); err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		_, _, err := Reserve(ctx, store, "r-1", 1, 2, 1, time.Minute)
+		if !errors.Is(err, ErrReservationExists) {
+			t.Errorf("Expected ErrReservationExists, got %v", err)
+		}
+	})
+
+	t.Run("reports missing inventory", func(t *testing.T) {
+		store := newFakeReservationStore(10)
+		store.exists = false
+
+		_, _, err := Reserve(ctx, store, "r-1", 1, 2, 1, time.Minute)
+		if !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("Expected pgx.ErrNoRows, got %v", err)
+		}
+	})
+
+	t.Run("expired reservations stop holding stock", func(t *testing.T) {
+		store := newFakeReservationStore(10)
+
+		if _, _, err := Reserve(ctx, store, "r-1", 1, 2, 10, time.Minute); err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		store.now = store.now.Add(time.Minute)
+
+		_, available, err := Reserve(ctx, store, "r-2", 1, 2, 10, time.Minute)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		if available != 0 {
+			t.Errorf("Expected nothing left available, got %d", available)
+		}
+	})
+}
+
+func TestConfirmReservation(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("takes the reserved stock", func(t *testing.T) {
+		store := newFakeReservationStore(10)
+		Reserve(ctx, store, "r-1", 1, 2, 6, time.Minute)
+
+		_, stock, threshold, err := ConfirmReservation(ctx, store, mapCache{}, "r-1")
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		if stock != 4 || threshold != 5 || store.stock != 4 {
+			t.Errorf("Expected stock 4 and threshold 5, got %d and %d", stock, threshold)
+		}
+
+		if status := store.status("r-1"); status != ReservationConfirmed {
+			t.Errorf("Expected r-1 to be confirmed, got %s", status)
+		}
+
+		if len(store.logs) != 1 || store.logs[0].PreviousStock != 10 || store.logs[0].UpdatedStock != 4 {
+			t.Errorf("Expected a stock log from 10 to 4, got %+v", store.logs)
+		}
+	})
+
+	t.Run("confirms only once", func(t *testing.T) {
+		store := newFakeReservationStore(10)
+		Reserve(ctx, store, "r-1", 1, 2, 6, time.Minute)
+		ConfirmReservation(ctx, store, mapCache{}, "r-1")
+
+		_, _, _, err := ConfirmReservation(ctx, store, mapCache{}, "r-1")
+		if !errors.Is(err, ErrReservationNotActive) {
+			t.Errorf("Expected ErrReservationNotActive, got %v", err)
+		}
+
+		if store.stock != 4 {
+			t.Errorf("Expected the stock to be taken once, got %d", store.stock)
+		}
+	})
+
+	t.Run("rejects released reservations", func(t *testing.T) {
+		store := newFakeReservationStore(10)
+		Reserve(ctx, store, "r-1", 1, 2, 6, time.Minute)
+		ReleaseReservation(ctx, store, "r-1")
+
+		_, _, _, err := ConfirmReservation(ctx, store, mapCache{}, "r-1")
+		if !errors.Is(err, ErrReservationNotActive) {
+			t.Errorf("Expected ErrReservationNotActive, got %v", err)
+		}
+
+		if store.stock != 10 {
+			t.Errorf("Expected stock to stay 10, got %d", store.stock)
+		}
+	})
+
+	t.Run("rejects expired reservations that weren't swept yet", func(t *testing.T) {
+		store := newFakeReservationStore(10)
+		Reserve(ctx, store, "r-1", 1, 2, 6, time.Minute)
+		store.now = store.now.Add(2 * time.Minute)
+
+		_, _, _, err := ConfirmReservation(ctx, store, mapCache{}, "r-1")
+		if !errors.Is(err, ErrReservationNotActive) {
+			t.Errorf("Expected ErrReservationNotActive, got %v", err)
+		}
+
+		if status := store.status("r-1"); status != ReservationActive {
+			t.Errorf("Expected r-1 to be left for the sweeper, got %s", status)
+		}
+	})
+
+	t.Run("reports unknown reservations", func(t *testing.T) {
+		_, _, _, err := ConfirmReservation(ctx, newFakeReservationStore(10), mapCache{}, "r-1")
+		if !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("Expected pgx.ErrNoRows, got %v", err)
+		}
+	})
+}
+
+func TestReleaseReservation(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("makes the stock available again", func(t *testing.T) {
+		store := newFakeReservationStore(10)
+		Reserve(ctx, store, "r-1", 1, 2, 10, time.Minute)
+
+		res, err := ReleaseReservation(ctx, store, "r-1")
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		if res.Status != ReservationReleased || store.status("r-1") != ReservationReleased {
+			t.Errorf("Expected r-1 to be released, got %s", store.status("r-1"))
+		}
+
+		if _, available, err := Reserve(ctx, store, "r-2", 1, 2, 10, time.Minute); err != nil || available != 0 {
+			t.Errorf("Expected the released stock to be reservable, got %d available and %v", available, err)
+		}
+
+		if store.stock != 10 {
+			t.Errorf("Expected stock to stay 10, got %d", store.stock)
+		}
+	})
+
+	t.Run("releases only once", func(t *testing.T) {
+		store := newFakeReservationStore(10)
+		Reserve(ctx, store, "r-1", 1, 2, 6, time.Minute)
+		ReleaseReservation(ctx, store, "r-1")
+
+		if _, err := ReleaseReservation(ctx, store, "r-1"); !errors.Is(err, ErrReservationNotActive) {
+			t.Errorf("Expected ErrReservationNotActive, got %v", err)
+		}
+	})
+
+	t.Run("rejects confirmed reservations", func(t *testing.T) {
+		store := newFakeReservationStore(10)
+		Reserve(ctx, store, "r-1", 1, 2, 6, time.Minute)
+		ConfirmReservation(ctx, store, mapCache{}, "r-1")
+
+		if _, err := ReleaseReservation(ctx, store, "r-1"); !errors.Is(err, ErrReservationNotActive) {
+			t.Errorf("Expected ErrReservationNotActive, got %v", err)
+		}
+
+		if store.status("r-1") != ReservationConfirmed {
+			t.Errorf("Expected r-1 to stay confirmed, got %s", store.status("r-1"))
+		}
+	})
+}
@@ -0,0 +1,165 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/achere/heroku-kafka-demo-go/db/sqlc"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Transfer statuses, stock of an in-transit transfer has left the source warehouse but has not
+// arrived at the destination yet
+const (
+	TransferInTransit = "in_transit"
+	TransferReceived  = "received"
+)
+
+var (
+	// ErrTransferExists is returned when dispatching a transfer with an ID that is already taken
+	ErrTransferExists = errors.New("transfer already exists")
+	// ErrTransferNotInTransit is returned when receiving a transfer that was already received
+	ErrTransferNotInTransit = errors.New("transfer is not in transit")
+	// ErrSameWarehouse is returned when the source and destination of a transfer are the same
+	ErrSameWarehouse = errors.New("source and destination warehouse are the same")
+)
+
+type transferStore interface {
+	inventoryStore
+	CreateTransfer(ctx context.Context, arg db.CreateTransferParams) (db.Transfer, error)
+	GetTransferForUpdate(ctx context.Context, transferID string) (db.Transfer, error)
+	MarkTransferReceived(ctx context.Context, transferID string) (db.Transfer, error)
+}
+
+// TransferLeg is the stock of one side of a transfer after it was applied
+type TransferLeg struct {
+	WarehouseID int
+	Stock       int
+	Threshold   int
+}
+
+// DispatchTransfer function takes quantity units of a product out of the source warehouse and puts
+// them in transit to the destination warehouse. Stock held by reservations can't be dispatched.
+// It returns the transfer along with the source leg
+func DispatchTransfer(
+	ctx context.Context,
+	store transferStore,
+	c Cache,
+	transferID string,
+	productID int,
+	sourceWarehouseID int,
+	destinationWarehouseID int,
+	quantity int,
+) (db.Transfer, TransferLeg, error) {
+	if sourceWarehouseID == destinationWarehouseID {
+		return db.Transfer{}, TransferLeg{}, ErrSameWarehouse
+	}
+
+	if err := checkDelta(quantity); err != nil {
+		return db.Transfer{}, TransferLeg{}, err
+	}
+
+	// The destination is checked up front so a missing inventory is reported as not found instead of
+	// a foreign key violation
+	_, err := store.GetInventory(ctx, db.GetInventoryParams{
+		WarehouseID: int32(destinationWarehouseID),
+		ProductID:   int32(productID),
+	})
+	if err != nil {
+		return db.Transfer{}, TransferLeg{}, fmt.Errorf("destination warehouse %d: %w", destinationWarehouseID, err)
+	}
+
+	t, err := store.CreateTransfer(ctx, db.CreateTransferParams{
+		TransferID:             transferID,
+		ProductID:              int32(productID),
+		SourceWarehouseID:      int32(sourceWarehouseID),
+		DestinationWarehouseID: int32(destinationWarehouseID),
+		Quantity:               int32(quantity),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.Transfer{}, TransferLeg{}, fmt.Errorf("transfer %s: %w", transferID, ErrTransferExists)
+	}
+	if err != nil {
+		return db.Transfer{}, TransferLeg{}, err
+	}
+	slog.Info("db dml", "at", "inventory", "action", "CreateTransfer", "value", fmt.Sprintf("%+v", t))
+
+	stock, threshold, err := updateStock(
+		ctx, store, c, productID, sourceWarehouseID, -quantity, pgtype.Text{String: transferID, Valid: true},
+	)
+	if err != nil {
+		return db.Transfer{}, TransferLeg{}, err
+	}
+
+	return t, TransferLeg{WarehouseID: sourceWarehouseID, Stock: stock, Threshold: threshold}, nil
+}
+
+// ReceiveTransfer function adds the quantity of an in-transit transfer to the stock of its destination
+// warehouse and returns the transfer along with the destination leg
+func ReceiveTransfer(
+	ctx context.Context,
+	store transferStore,
+	c Cache,
+	transferID string,
+) (db.Transfer, TransferLeg, error) {
+	t, err := store.GetTransferForUpdate(ctx, transferID)
+	if err != nil {
+		return t, TransferLeg{}, err
+	}
+
+	if t.Status != TransferInTransit {
+		return t, TransferLeg{}, fmt.Errorf("transfer %s is %s: %w", transferID, t.Status, ErrTransferNotInTransit)
+	}
+
+	stock, threshold, err := updateStock(
+		ctx,
+		store,
+		c,
+		int(t.ProductID),
+		int(t.DestinationWarehouseID),
+		int(t.Quantity),
+		pgtype.Text{String: transferID, Valid: true},
+	)
+	if err != nil {
+		return t, TransferLeg{}, err
+	}
+
+	t, err = store.MarkTransferReceived(ctx, transferID)
+	if err != nil {
+		return t, TransferLeg{}, err
+	}
+	slog.Info("db dml", "at", "inventory", "action", "MarkTransferReceived", "value", fmt.Sprintf("%+v", t))
+
+	return t, TransferLeg{WarehouseID: int(t.DestinationWarehouseID), Stock: stock, Threshold: threshold}, nil
+}
+
+// Transfer function moves quantity units of a product from the source to the destination warehouse,
+// dispatching and receiving it at once. Both legs are applied by the caller's transaction so stock
+// is never lost or duplicated. It returns the transfer along with the source and destination legs
+func Transfer(
+	ctx context.Context,
+	store transferStore,
+	c Cache,
+	transferID string,
+	productID int,
+	sourceWarehouseID int,
+	destinationWarehouseID int,
+	quantity int,
+) (db.Transfer, []TransferLeg, error) {
+	_, source, err := DispatchTransfer(
+		ctx, store, c, transferID, productID, sourceWarehouseID, destinationWarehouseID, quantity,
+	)
+	if err != nil {
+		return db.Transfer{}, nil, err
+	}
+
+	t, destination, err := ReceiveTransfer(ctx, store, c, transferID)
+	if err != nil {
+		return t, nil, err
+	}
+
+	return t, []TransferLeg{source, destination}, nil
+}
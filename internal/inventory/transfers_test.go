@@ -0,0 +1,251 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/achere/heroku-kafka-demo-go/db/sqlc"
+	"github.com/jackc/pgx/v5"
+)
+
+// fakeTransferStore holds the inventory of a product in several warehouses, each a
+// fakeInventoryStore, along with the transfers between them
+type fakeTransferStore struct {
+	warehouses map[int32]*fakeInventoryStore
+	transfers  map[string]db.Transfer
+}
+
+func newFakeTransferStore(stock map[int32]int32) *fakeTransferStore {
+	s := &fakeTransferStore{
+		warehouses: make(map[int32]*fakeInventoryStore),
+		transfers:  make(map[string]db.Transfer),
+	}
+	for warehouseID, level := range stock {
+		s.warehouses[warehouseID] = &fakeInventoryStore{exists: true, stock: level, threshold: 5, version: 1}
+	}
+
+	return s
+}
+
+func (s *fakeTransferStore) warehouse(id int32) *fakeInventoryStore {
+	if w, ok := s.warehouses[id]; ok {
+		return w
+	}
+	return &fakeInventoryStore{}
+}
+
+func (s *fakeTransferStore) GetInventory(ctx context.Context, arg db.GetInventoryParams) (db.GetInventoryRow, error) {
+	return s.warehouse(arg.WarehouseID).GetInventory(ctx, arg)
+}
+
+func (s *fakeTransferStore) AdjustInventory(ctx context.Context, arg db.AdjustInventoryParams) (db.AdjustInventoryRow, error) {
+	return s.warehouse(arg.WarehouseID).AdjustInventory(ctx, arg)
+}
+
+func (s *fakeTransferStore) InsertStockLog(ctx context.Context, arg db.InsertStockLogParams) error {
+	return s.warehouse(arg.WarehouseID).InsertStockLog(ctx, arg)
+}
+
+func (s *fakeTransferStore) SumActiveReservations(ctx context.Context, arg db.SumActiveReservationsParams) (int32, error) {
+	return s.warehouse(arg.WarehouseID).SumActiveReservations(ctx, arg)
+}
+
+func (s *fakeTransferStore) CreateTransfer(ctx context.Context, arg db.CreateTransferParams) (db.Transfer, error) {
+	if _, ok := s.transfers[arg.TransferID]; ok {
+		return db.Transfer{}, pgx.ErrNoRows
+	}
+
+	t := db.Transfer{
+		TransferID:             arg.TransferID,
+		ProductID:              arg.ProductID,
+		SourceWarehouseID:      arg.SourceWarehouseID,
+		DestinationWarehouseID: arg.DestinationWarehouseID,
+		Quantity:               arg.Quantity,
+		Status:                 TransferInTransit,
+	}
+	s.transfers[arg.TransferID] = t
+
+	return t, nil
+}
+
+func (s *fakeTransferStore) GetTransferForUpdate(ctx context.Context, transferID string) (db.Transfer, error) {
+	t, ok := s.transfers[transferID]
+	if !ok {
+		return db.Transfer{}, pgx.ErrNoRows
+	}
+
+	return t, nil
+}
+
+func (s *fakeTransferStore) MarkTransferReceived(ctx context.Context, transferID string) (db.Transfer, error) {
+	t := s.transfers[transferID]
+	t.Status = TransferReceived
+	s.transfers[transferID] = t
+
+	return t, nil
+}
+
+func TestDispatchTransfer(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("takes the stock out of the source warehouse", func(t *testing.T) {
+		store := newFakeTransferStore(map[int32]int32{1: 10, 2: 3})
+
+		tr, leg, err := DispatchTransfer(ctx, store, mapCache{}, "t-1", 7, 1, 2, 4)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		if tr.Status != TransferInTransit || leg.WarehouseID != 1 || leg.Stock != 6 {
+			t.Errorf("Expected an in-transit transfer leaving 6 in warehouse 1, got %+v and %+v", tr, leg)
+		}
+
+		if store.warehouses[2].stock != 3 {
+			t.Errorf("Expected the destination stock to stay 3 until received, got %d", store.warehouses[2].stock)
+		}
+
+		logs := store.warehouses[1].logs
+		if len(logs) != 1 || logs[0].TransferID.String != "t-1" {
+			t.Errorf("Expected a stock log of transfer t-1, got %+v", logs)
+		}
+	})
+
+	t.Run("rejects more than the source holds", func(t *testing.T) {
+		store := newFakeTransferStore(map[int32]int32{1: 3, 2: 0})
+
+		_, _, err := DispatchTransfer(ctx, store, mapCache{}, "t-1", 7, 1, 2, 4)
+		if !errors.Is(err, ErrNegativeStock) {
+			t.Errorf("Expected ErrNegativeStock, got %v", err)
+		}
+
+		if store.warehouses[1].stock != 3 {
+			t.Errorf("Expected the source stock to stay 3, got %d", store.warehouses[1].stock)
+		}
+	})
+
+	t.Run("rejects reserved stock", func(t *testing.T) {
+		store := newFakeTransferStore(map[int32]int32{1: 10, 2: 0})
+		store.warehouses[1].reserved = 8
+
+		_, _, err := DispatchTransfer(ctx, store, mapCache{}, "t-1", 7, 1, 2, 4)
+		if !errors.Is(err, ErrInsufficientStock) {
+			t.Errorf("Expected ErrInsufficientStock, got %v", err)
+		}
+	})
+
+	t.Run("rejects a taken transfer ID", func(t *testing.T) {
+		store := newFakeTransferStore(map[int32]int32{1: 10, 2: 0})
+		DispatchTransfer(ctx, store, mapCache{}, "t-1", 7, 1, 2, 4)
+
+		_, _, err := DispatchTransfer(ctx, store, mapCache{}, "t-1", 7, 1, 2, 4)
+		if !errors.Is(err, ErrTransferExists) {
+			t.Errorf("Expected ErrTransferExists, got %v", err)
+		}
+
+		if store.warehouses[1].stock != 6 {
+			t.Errorf("Expected the stock to be dispatched once, got %d", store.warehouses[1].stock)
+		}
+	})
+
+	t.Run("rejects transfers within a warehouse", func(t *testing.T) {
+		store := newFakeTransferStore(map[int32]int32{1: 10})
+
+		if _, _, err := DispatchTransfer(ctx, store, mapCache{}, "t-1", 7, 1, 1, 4); !errors.Is(err, ErrSameWarehouse) {
+			t.Errorf("Expected ErrSameWarehouse, got %v", err)
+		}
+	})
+
+	t.Run("rejects quantities out of the int32 range", func(t *testing.T) {
+		store := newFakeTransferStore(map[int32]int32{1: 10, 2: 0})
+
+		_, _, err := DispatchTransfer(ctx, store, mapCache{}, "t-1", 7, 1, 2, 4294967297)
+		if !errors.Is(err, ErrDeltaOutOfRange) {
+			t.Errorf("Expected ErrDeltaOutOfRange, got %v", err)
+		}
+
+		if _, ok := store.transfers["t-1"]; ok {
+			t.Error("Expected no transfer to be created")
+		}
+	})
+
+	t.Run("reports a missing destination", func(t *testing.T) {
+		store := newFakeTransferStore(map[int32]int32{1: 10})
+
+		_, _, err := DispatchTransfer(ctx, store, mapCache{}, "t-1", 7, 1, 2, 4)
+		if !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("Expected pgx.ErrNoRows, got %v", err)
+		}
+
+		if _, ok := store.transfers["t-1"]; ok {
+			t.Error("Expected no transfer to be created")
+		}
+	})
+}
+
+func TestReceiveTransfer(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("adds the stock to the destination warehouse", func(t *testing.T) {
+		store := newFakeTransferStore(map[int32]int32{1: 10, 2: 3})
+		DispatchTransfer(ctx, store, mapCache{}, "t-1", 7, 1, 2, 4)
+
+		tr, leg, err := ReceiveTransfer(ctx, store, mapCache{}, "t-1")
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		if tr.Status != TransferReceived || leg.WarehouseID != 2 || leg.Stock != 7 {
+			t.Errorf("Expected a received transfer leaving 7 in warehouse 2, got %+v and %+v", tr, leg)
+		}
+	})
+
+	t.Run("receives only once", func(t *testing.T) {
+		store := newFakeTransferStore(map[int32]int32{1: 10, 2: 3})
+		DispatchTransfer(ctx, store, mapCache{}, "t-1", 7, 1, 2, 4)
+		ReceiveTransfer(ctx, store, mapCache{}, "t-1")
+
+		_, _, err := ReceiveTransfer(ctx, store, mapCache{}, "t-1")
+		if !errors.Is(err, ErrTransferNotInTransit) {
+			t.Errorf("Expected ErrTransferNotInTransit, got %v", err)
+		}
+
+		if store.warehouses[2].stock != 7 {
+			t.Errorf("Expected the stock to arrive once, got %d", store.warehouses[2].stock)
+		}
+	})
+
+	t.Run("rejects receiving before dispatch", func(t *testing.T) {
+		store := newFakeTransferStore(map[int32]int32{1: 10, 2: 3})
+
+		_, _, err := ReceiveTransfer(ctx, store, mapCache{}, "t-1")
+		if !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("Expected pgx.ErrNoRows, got %v", err)
+		}
+
+		if store.warehouses[2].stock != 3 {
+			t.Errorf("Expected the destination stock to stay 3, got %d", store.warehouses[2].stock)
+		}
+	})
+}
+
+func TestTransfer(t *testing.T) {
+	store := newFakeTransferStore(map[int32]int32{1: 10, 2: 3})
+
+	tr, legs, err := Transfer(context.Background(), store, mapCache{}, "t-1", 7, 1, 2, 4)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if tr.Status != TransferReceived {
+		t.Errorf("Expected the transfer to be received, got %s", tr.Status)
+	}
+
+	if len(legs) != 2 || legs[0].Stock != 6 || legs[1].Stock != 7 {
+		t.Errorf("Expected legs leaving 6 and 7, got %+v", legs)
+	}
+
+	if total := store.warehouses[1].stock + store.warehouses[2].stock; total != 13 {
+		t.Errorf("Expected the total stock to stay 13, got %d", total)
+	}
+}
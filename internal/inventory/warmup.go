@@ -0,0 +1,245 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/achere/heroku-kafka-demo-go/db/sqlc"
+)
+
+// Cache warm-up states
+const (
+	WarmupIdle    = "idle"
+	WarmupRunning = "running"
+	WarmupDone    = "done"
+	WarmupFailed  = "failed"
+)
+
+// ErrNotWarmedUp is returned by CacheWarmer.Ready until a warm-up has completed
+var ErrNotWarmedUp = errors.New("cache is not warmed up")
+
+type warmupStore interface {
+	CountInventory(ctx context.Context) (int64, error)
+	ListInventoryAfter(ctx context.Context, arg db.ListInventoryAfterParams) ([]db.ListInventoryAfterRow, error)
+}
+
+// WarmupStatus is the progress of the current or last cache warm-up
+type WarmupStatus struct {
+	State      string     `json:"state"`
+	Loaded     int        `json:"loaded"`
+	Total      int        `json:"total"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// CacheWarmer streams the whole inventory table into a cache. Pages are read one after another and
+// written with up to concurrency pipelines in flight. Entries are versioned, so a warm-up never
+// overwrites stock that was updated while it was running
+type CacheWarmer struct {
+	store       warmupStore
+	cache       BulkCache
+	batchSize   int
+	concurrency int
+	trigger     chan struct{}
+
+	mu     sync.Mutex
+	status WarmupStatus
+	warmed bool
+}
+
+// NewCacheWarmer creates a CacheWarmer that reads batchSize rows at a time
+func NewCacheWarmer(store warmupStore, c BulkCache, batchSize, concurrency int) *CacheWarmer {
+	return &CacheWarmer{
+		store:       store,
+		cache:       c,
+		batchSize:   max(batchSize, 1),
+		concurrency: max(concurrency, 1),
+		trigger:     make(chan struct{}, 1),
+		status:      WarmupStatus{State: WarmupIdle},
+	}
+}
+
+// Trigger asks Serve to run a warm-up, reporting false if one is already running or pending
+func (w *CacheWarmer) Trigger() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.status.State == WarmupRunning {
+		return false
+	}
+
+	select {
+	case w.trigger <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Serve runs a warm-up every time one is triggered until ctx is done
+func (w *CacheWarmer) Serve(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.trigger:
+		}
+
+		if err := w.Run(ctx); err != nil {
+			slog.Error("error warming up cache", "at", "inventory", "err", err)
+		}
+	}
+}
+
+// Status returns the progress of the current or last warm-up
+func (w *CacheWarmer) Status() WarmupStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.status
+}
+
+// Ready returns ErrNotWarmedUp until a warm-up has completed, later warm-ups don't affect it
+func (w *CacheWarmer) Ready() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.warmed {
+		return fmt.Errorf("%w, warm-up is %s", ErrNotWarmedUp, w.status.State)
+	}
+
+	return nil
+}
+
+// Run loads every inventory into the cache and returns once all of it was written or the first
+// error occurred
+func (w *CacheWarmer) Run(ctx context.Context) error {
+	total, err := w.store.CountInventory(ctx)
+	if err != nil {
+		w.finish(err)
+		return err
+	}
+
+	start := time.Now()
+	w.mu.Lock()
+	w.status = WarmupStatus{State: WarmupRunning, Total: int(total), StartedAt: &start}
+	w.mu.Unlock()
+
+	slog.Info("cache warm-up started", "at", "inventory", "total", total)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var writeErr error
+	fail := func(err error) {
+		errOnce.Do(func() {
+			writeErr = err
+			cancel()
+		})
+	}
+
+	sem := make(chan struct{}, w.concurrency)
+	params := db.ListInventoryAfterParams{PageSize: int32(w.batchSize)}
+
+	for ctx.Err() == nil {
+		rows, err := w.store.ListInventoryAfter(ctx, params)
+		if err != nil {
+			fail(err)
+			break
+		}
+
+		if len(rows) == 0 {
+			break
+		}
+
+		last := rows[len(rows)-1]
+		params.AfterProductID, params.AfterWarehouseID = last.ProductID, last.WarehouseID
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := w.cache.SetMany(ctx, cacheEntries(rows)); err != nil {
+				fail(err)
+				return
+			}
+			w.progress(len(rows))
+		}()
+
+		if len(rows) < w.batchSize {
+			break
+		}
+	}
+	wg.Wait()
+
+	if writeErr == nil {
+		writeErr = ctx.Err()
+	}
+
+	w.finish(writeErr)
+
+	return writeErr
+}
+
+// progress records that n more entries were written
+func (w *CacheWarmer) progress(n int) {
+	w.mu.Lock()
+	w.status.Loaded += n
+	loaded, total := w.status.Loaded, w.status.Total
+	w.mu.Unlock()
+
+	slog.Info("cache warm-up progress", "at", "inventory", "loaded", loaded, "total", total)
+}
+
+func (w *CacheWarmer) finish(err error) {
+	now := time.Now()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.status.FinishedAt = &now
+	if err != nil {
+		w.status.State = WarmupFailed
+		w.status.Error = err.Error()
+		return
+	}
+
+	w.status.State = WarmupDone
+	w.warmed = true
+
+	slog.Info(
+		"cache warm-up done",
+		"at", "inventory",
+		"loaded", w.status.Loaded,
+		"duration", now.Sub(*w.status.StartedAt).String(),
+	)
+}
+
+func cacheEntries(rows []db.ListInventoryAfterRow) []CacheEntry {
+	entries := make([]CacheEntry, len(rows))
+	for i, row := range rows {
+		entries[i] = CacheEntry{
+			Key:     cacheKey(int(row.ProductID), int(row.WarehouseID)),
+			Value:   cacheValue(int(row.StockLevel), int(row.AlertThreshold)),
+			Version: row.Version,
+		}
+	}
+
+	return entries
+}
@@ -0,0 +1,125 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/achere/heroku-kafka-demo-go/db/sqlc"
+)
+
+// sliceStore serves ListInventoryAfter from rows sorted by product and warehouse
+type sliceStore []db.ListInventoryAfterRow
+
+func (s sliceStore) CountInventory(ctx context.Context) (int64, error) {
+	return int64(len(s)), nil
+}
+
+func (s sliceStore) ListInventoryAfter(ctx context.Context, arg db.ListInventoryAfterParams) ([]db.ListInventoryAfterRow, error) {
+	var page []db.ListInventoryAfterRow
+	for _, row := range s {
+		if row.ProductID < arg.AfterProductID ||
+			(row.ProductID == arg.AfterProductID && row.WarehouseID <= arg.AfterWarehouseID) {
+			continue
+		}
+		page = append(page, row)
+		if len(page) == int(arg.PageSize) {
+			break
+		}
+	}
+
+	return page, nil
+}
+
+type recordingBulkCache struct {
+	mu      sync.Mutex
+	entries map[string]CacheEntry
+	err     error
+}
+
+func (c *recordingBulkCache) SetMany(ctx context.Context, entries []CacheEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+
+	for _, e := range entries {
+		c.entries[e.Key] = e
+	}
+	return nil
+}
+
+func TestCacheWarmer(t *testing.T) {
+	ctx := context.Background()
+
+	var store sliceStore
+	for p := int32(1); p <= 5; p++ {
+		for wh := int32(1); wh <= 3; wh++ {
+			store = append(store, db.ListInventoryAfterRow{
+				ProductID: p, WarehouseID: wh, StockLevel: p * 10, AlertThreshold: wh, Version: 2,
+			})
+		}
+	}
+
+	t.Run("loads every inventory", func(t *testing.T) {
+		cache := &recordingBulkCache{entries: make(map[string]CacheEntry)}
+		w := NewCacheWarmer(store, cache, 4, 2)
+
+		if err := w.Ready(); !errors.Is(err, ErrNotWarmedUp) {
+			t.Errorf("Expected ErrNotWarmedUp before warm-up, got %v", err)
+		}
+
+		if err := w.Run(ctx); err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		if len(cache.entries) != len(store) {
+			t.Errorf("Expected %d entries, got %d", len(store), len(cache.entries))
+		}
+
+		if e := cache.entries["3:2"]; e.Value != "20,3" || e.Version != 2 {
+			t.Errorf("Expected entry 3:2 to be 20,3 at version 2, got %+v", e)
+		}
+
+		status := w.Status()
+		if status.State != WarmupDone || status.Loaded != len(store) || status.Total != len(store) {
+			t.Errorf("Expected done with %d of %d loaded, got %+v", len(store), len(store), status)
+		}
+
+		if err := w.Ready(); err != nil {
+			t.Errorf("Expected ready after warm-up, got %s", err)
+		}
+	})
+
+	t.Run("reports write errors", func(t *testing.T) {
+		cache := &recordingBulkCache{entries: make(map[string]CacheEntry), err: errors.New("connection refused")}
+		w := NewCacheWarmer(store, cache, 4, 2)
+
+		if err := w.Run(ctx); err == nil {
+			t.Fatal("Expected an error")
+		}
+
+		if status := w.Status(); status.State != WarmupFailed || status.Error != "connection refused" {
+			t.Errorf("Expected failed with the write error, got %+v", status)
+		}
+
+		if err := w.Ready(); err == nil {
+			t.Error("Expected not to be ready after a failed warm-up")
+		}
+	})
+
+	t.Run("only one warm-up is pending at a time", func(t *testing.T) {
+		w := NewCacheWarmer(store, &recordingBulkCache{entries: make(map[string]CacheEntry)}, 4, 2)
+
+		if !w.Trigger() {
+			t.Error("Expected the first trigger to be accepted")
+		}
+
+		if w.Trigger() {
+			t.Error("Expected the second trigger to be rejected")
+		}
+	})
+}
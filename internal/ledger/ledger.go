@@ -0,0 +1,114 @@
+package ledger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/achere/heroku-kafka-demo-go/db/sqlc"
+)
+
+// Store is the part of the queries the processed message ledger is kept with
+type Store interface {
+	InsertProcessedMessage(ctx context.Context, arg db.InsertProcessedMessageParams) (int64, error)
+	DeleteProcessedMessagesFrom(ctx context.Context, arg db.DeleteProcessedMessagesFromParams) (int64, error)
+}
+
+// Params are the ledger entry of a message, its key along with where it was consumed from so the
+// entry can be forgotten when its offset is replayed
+func Params(cm *sarama.ConsumerMessage, key string) db.InsertProcessedMessageParams {
+	return db.InsertProcessedMessageParams{
+		MessageKey:     key,
+		KafkaTopic:     cm.Topic,
+		KafkaPartition: cm.Partition,
+		KafkaOffset:    cm.Offset,
+	}
+}
+
+// Record adds the key of a message to the ledger and reports whether it was processed before
+func Record(ctx context.Context, s Store, cm *sarama.ConsumerMessage, key string) (bool, error) {
+	inserted, err := s.InsertProcessedMessage(ctx, Params(cm, key))
+	if err != nil {
+		return false, fmt.Errorf("error recording processed message: %w", err)
+	}
+
+	return inserted == 0, nil
+}
+
+// Forget removes the entries of messages consumed from topic at or after the offset of every
+// partition in offsets, so they are applied again when the offsets are replayed
+func Forget(ctx context.Context, s Store, topic string, offsets map[int32]int64) (int64, error) {
+	var forgotten int64
+
+	for partition, offset := range offsets {
+		n, err := s.DeleteProcessedMessagesFrom(ctx, db.DeleteProcessedMessagesFromParams{
+			KafkaTopic:     topic,
+			KafkaPartition: partition,
+			KafkaOffset:    offset,
+		})
+		if err != nil {
+			return forgotten, fmt.Errorf("error forgetting processed messages on partition %d: %w", partition, err)
+		}
+
+		forgotten += n
+	}
+
+	return forgotten, nil
+}
+
+// pruneBatchSize is the number of entries deleted at a time when pruning, so no single statement
+// holds locks on a large part of the ledger
+const pruneBatchSize = 10000
+
+// Pruner deletes ledger entries older than a retention
+type Pruner interface {
+	DeleteProcessedMessagesBefore(ctx context.Context, arg db.DeleteProcessedMessagesBeforeParams) (int64, error)
+}
+
+// Prune deletes the entries recorded longer than retention ago and returns how many were deleted.
+// Redelivered messages are only recognized as long as their entry is kept, so the retention should
+// be at least the retention of the topic
+func Prune(ctx context.Context, p Pruner, retention time.Duration) (int64, error) {
+	var pruned int64
+
+	for {
+		n, err := p.DeleteProcessedMessagesBefore(ctx, db.DeleteProcessedMessagesBeforeParams{
+			RetentionSeconds: int64(retention / time.Second),
+			BatchSize:        pruneBatchSize,
+		})
+		if err != nil {
+			return pruned, fmt.Errorf("error pruning processed messages: %w", err)
+		}
+
+		pruned += n
+		if n < pruneBatchSize {
+			return pruned, nil
+		}
+	}
+}
+
+// PruneEvery prunes the entries older than retention every interval until ctx is done
+func PruneEvery(ctx context.Context, p Pruner, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pruned, err := Prune(ctx, p, retention)
+		if err != nil {
+			slog.Error("error pruning processed messages", "at", "ledger", "err", err)
+			continue
+		}
+
+		if pruned > 0 {
+			slog.Info("processed messages pruned", "at", "ledger", "count", pruned)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package ledger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/achere/heroku-kafka-demo-go/db/sqlc"
+)
+
+// mapStore keeps ledger entries by key like the processed_messages table
+type mapStore map[string]db.InsertProcessedMessageParams
+
+func (s mapStore) InsertProcessedMessage(ctx context.Context, arg db.InsertProcessedMessageParams) (int64, error) {
+	if _, ok := s[arg.MessageKey]; ok {
+		return 0, nil
+	}
+
+	s[arg.MessageKey] = arg
+	return 1, nil
+}
+
+func (s mapStore) DeleteProcessedMessagesFrom(ctx context.Context, arg db.DeleteProcessedMessagesFromParams) (int64, error) {
+	var n int64
+	for key, e := range s {
+		if e.KafkaTopic == arg.KafkaTopic && e.KafkaPartition == arg.KafkaPartition && e.KafkaOffset >= arg.KafkaOffset {
+			delete(s, key)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func TestLedger(t *testing.T) {
+	ctx := context.Background()
+	store := mapStore{}
+
+	// keys as the stock message handler derives them, from the envelope ID or the offset
+	messages := []struct {
+		cm  *sarama.ConsumerMessage
+		key string
+	}{
+		{&sarama.ConsumerMessage{Topic: "stock-updates", Partition: 0, Offset: 10}, "offset:stock-updates:0:10"},
+		{&sarama.ConsumerMessage{Topic: "stock-updates", Partition: 0, Offset: 11}, "id:po-1234-line-1"},
+		{&sarama.ConsumerMessage{Topic: "stock-updates", Partition: 0, Offset: 12}, "offset:stock-updates:0:12"},
+		{&sarama.ConsumerMessage{Topic: "stock-updates", Partition: 1, Offset: 11}, "offset:stock-updates:1:11"},
+	}
+
+	record := func() []bool {
+		duplicates := make([]bool, len(messages))
+		for i, m := range messages {
+			duplicate, err := Record(ctx, store, m.cm, m.key)
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+			duplicates[i] = duplicate
+		}
+		return duplicates
+	}
+
+	t.Run("records new messages", func(t *testing.T) {
+		for i, duplicate := range record() {
+			if duplicate {
+				t.Errorf("Expected message %d not to be a duplicate", i)
+			}
+		}
+	})
+
+	t.Run("skips redelivered messages", func(t *testing.T) {
+		for i, duplicate := range record() {
+			if !duplicate {
+				t.Errorf("Expected message %d to be a duplicate", i)
+			}
+		}
+	})
+
+	t.Run("applies replayed offsets once forgotten", func(t *testing.T) {
+		forgotten, err := Forget(ctx, store, "stock-updates", map[int32]int64{0: 11})
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		if forgotten != 2 {
+			t.Errorf("Expected 2 entries to be forgotten, got %d", forgotten)
+		}
+
+		expected := []bool{true, false, false, true}
+		for i, duplicate := range record() {
+			if duplicate != expected[i] {
+				t.Errorf("Expected message %d duplicate to be %t, got %t", i, expected[i], duplicate)
+			}
+		}
+	})
+}
+
+// agedStore holds the ages of ledger entries
+type agedStore struct {
+	ages  []time.Duration
+	calls int
+}
+
+func (s *agedStore) DeleteProcessedMessagesBefore(ctx context.Context, arg db.DeleteProcessedMessagesBeforeParams) (int64, error) {
+	s.calls++
+
+	var n int64
+	kept := s.ages[:0]
+	for _, age := range s.ages {
+		if age > time.Duration(arg.RetentionSeconds)*time.Second && n < int64(arg.BatchSize) {
+			n++
+			continue
+		}
+		kept = append(kept, age)
+	}
+	s.ages = kept
+
+	return n, nil
+}
+
+func TestPrune(t *testing.T) {
+	store := &agedStore{}
+	for i := 0; i < pruneBatchSize+5; i++ {
+		store.ages = append(store.ages, 48*time.Hour)
+	}
+	store.ages = append(store.ages, time.Hour, 2*time.Hour)
+
+	pruned, err := Prune(context.Background(), store, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if pruned != pruneBatchSize+5 {
+		t.Errorf("Expected %d entries to be pruned, got %d", pruneBatchSize+5, pruned)
+	}
+
+	if len(store.ages) != 2 {
+		t.Errorf("Expected the 2 recent entries to be kept, got %d", len(store.ages))
+	}
+
+	if store.calls != 2 {
+		t.Errorf("Expected 2 batches, got %d", store.calls)
+	}
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"strings"
+
+	gometrics "github.com/rcrowley/go-metrics"
+)
+
+// quantiles reported for go-metrics histograms and timers
+var quantiles = []float64{0.5, 0.75, 0.95, 0.99}
+
+// NewGoMetricsCollector returns a collector bridging a go-metrics registry, such as the one Sarama
+// records broker, producer and consumer metrics in. Metric names are prefixed with namespace and
+// turned into valid Prometheus names. Meters are reported as counters, histograms and timers as
+// summaries
+func NewGoMetricsCollector(namespace string, r gometrics.Registry) Collector {
+	return CollectorFunc(func() []Family {
+		var families []Family
+
+		r.Each(func(name string, m any) {
+			name = namespace + "_" + sanitizeName(name)
+
+			switch m := m.(type) {
+			case gometrics.Counter:
+				families = append(families, valueFamily(name, TypeGauge, float64(m.Count())))
+			case gometrics.Gauge:
+				families = append(families, valueFamily(name, TypeGauge, float64(m.Value())))
+			case gometrics.GaugeFloat64:
+				families = append(families, valueFamily(name, TypeGauge, m.Value()))
+			case gometrics.Meter:
+				families = append(families, valueFamily(name+"_total", TypeCounter, float64(m.Snapshot().Count())))
+			case gometrics.Histogram:
+				s := m.Snapshot()
+				families = append(families, summaryFamily(name, s.Count(), float64(s.Sum()), s.Percentiles(quantiles)))
+			case gometrics.Timer:
+				s := m.Snapshot()
+				families = append(families, summaryFamily(name, s.Count(), float64(s.Sum()), s.Percentiles(quantiles)))
+			}
+		})
+
+		return families
+	})
+}
+
+func valueFamily(name, metricType string, value float64) Family {
+	return Family{
+		Name:    name,
+		Help:    "Bridged from go-metrics.",
+		Type:    metricType,
+		Samples: []Sample{{Value: value}},
+	}
+}
+
+func summaryFamily(name string, count int64, sum float64, values []float64) Family {
+	f := Family{Name: name, Help: "Bridged from go-metrics.", Type: TypeSummary}
+
+	for i, q := range quantiles {
+		f.Samples = append(f.Samples, Sample{
+			Labels: []Label{{Name: "quantile", Value: formatValue(q)}},
+			Value:  values[i],
+		})
+	}
+
+	f.Samples = append(f.Samples,
+		Sample{Suffix: "_sum", Value: sum},
+		Sample{Suffix: "_count", Value: float64(count)},
+	)
+
+	return f
+}
+
+// sanitizeName replaces characters that are not allowed in Prometheus metric names with underscores
+func sanitizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == ':':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InstrumentHandler records the latency of every request served by next per route, method and
+// status code in reg. The route is the pattern of the ServeMux route that matched the request
+func InstrumentHandler(reg *Registry, next http.Handler) http.Handler {
+	duration := reg.NewHistogramVec(
+		"http_request_duration_seconds",
+		"Latency of HTTP requests by route.",
+		DefaultBuckets,
+		"route", "method", "code",
+	)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		duration.Observe(time.Since(start).Seconds(), routeOf(r), r.Method, strconv.Itoa(rec.status))
+	})
+}
+
+// routeOf returns the path of the pattern ServeMux matched r with, requests that matched no route
+// are grouped together to keep the number of series bounded
+func routeOf(r *http.Request) string {
+	if r.Pattern == "" {
+		return "unmatched"
+	}
+
+	if _, path, ok := strings.Cut(r.Pattern, " "); ok {
+		return path
+	}
+
+	return r.Pattern
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
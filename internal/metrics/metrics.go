@@ -0,0 +1,392 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metric types of the Prometheus text format
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+	TypeSummary   = "summary"
+)
+
+// DefaultBuckets are histogram buckets in seconds suited for request and handler latencies
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Label is a label name and value pair of a sample
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a single value of a metric family. Suffix is appended to the family name, as for the
+// _bucket, _sum and _count samples of histograms
+type Sample struct {
+	Suffix string
+	Labels []Label
+	Value  float64
+}
+
+// Family is a named metric with all of its samples
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// Collector collects metric families when metrics are scraped
+type Collector interface {
+	Collect() []Family
+}
+
+// Registry holds the collectors exposed on /metrics
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+// Default is the registry metrics of the service are registered with
+var Default = NewRegistry()
+
+// NewRegistry creates a new empty Registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a collector to the registry
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.collectors = append(r.collectors, c)
+}
+
+// NewCounterVec creates a counter partitioned by labelNames and registers it
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{vec: newVec(name, help, labelNames)}
+	r.Register(c)
+
+	return c
+}
+
+// NewGaugeVec creates a gauge partitioned by labelNames and registers it
+func (r *Registry) NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	g := &GaugeVec{vec: newVec(name, help, labelNames)}
+	r.Register(g)
+
+	return g
+}
+
+// NewHistogramVec creates a histogram with the given upper bucket bounds partitioned by labelNames
+// and registers it
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	h := &HistogramVec{vec: newVec(name, help, labelNames), buckets: buckets}
+	r.Register(h)
+
+	return h
+}
+
+// Gather collects the metric families of all collectors sorted by name
+func (r *Registry) Gather() []Family {
+	r.mu.Lock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	var families []Family
+	for _, c := range collectors {
+		families = append(families, c.Collect()...)
+	}
+
+	sort.SliceStable(families, func(i, j int) bool {
+		return families[i].Name < families[j].Name
+	})
+
+	return families
+}
+
+// WriteText writes all metric families in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	for _, f := range r.Gather() {
+		if len(f.Samples) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.Name, escapeHelp(f.Help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.Name, f.Type)
+
+		for _, s := range f.Samples {
+			bw.WriteString(f.Name)
+			bw.WriteString(s.Suffix)
+			writeLabels(bw, s.Labels)
+			bw.WriteByte(' ')
+			bw.WriteString(formatValue(s.Value))
+			bw.WriteByte('\n')
+		}
+	}
+
+	return bw.Flush()
+}
+
+// ServeHTTP responds with all metrics in the Prometheus text exposition format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	if err := r.WriteText(w); err != nil {
+		http.Error(w, "Error writing metrics", http.StatusInternalServerError)
+	}
+}
+
+func writeLabels(w *bufio.Writer, labels []Label) {
+	if len(labels) == 0 {
+		return
+	}
+
+	w.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(l.Name)
+		w.WriteString(`="`)
+		w.WriteString(escapeLabelValue(l.Value))
+		w.WriteByte('"')
+	}
+	w.WriteByte('}')
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueEscaper.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// vec holds the series of a metric partitioned by label values
+type vec struct {
+	name       string
+	help       string
+	labelNames []string
+
+	mu     sync.Mutex
+	series map[string]any
+	labels map[string][]Label
+}
+
+func newVec(name, help string, labelNames []string) *vec {
+	return &vec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		series:     make(map[string]any),
+		labels:     make(map[string][]Label),
+	}
+}
+
+// get returns the series for labelValues, creating it with create if it doesn't exist. It must be
+// called with mu held
+func (v *vec) get(labelValues []string, create func() any) any {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf(
+			"metric %s: expected %d label values, got %d", v.name, len(v.labelNames), len(labelValues),
+		))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = create()
+		v.series[key] = s
+
+		labels := make([]Label, len(labelValues))
+		for i, value := range labelValues {
+			labels[i] = Label{Name: v.labelNames[i], Value: value}
+		}
+		v.labels[key] = labels
+	}
+
+	return s
+}
+
+// sortedKeys returns the keys of all series in a stable order. It must be called with mu held
+func (v *vec) sortedKeys() []string {
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	*vec
+}
+
+// Inc increments the counter for labelValues by one
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter for labelValues by delta, which must not be negative
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v := c.get(labelValues, func() any { return new(float64) }).(*float64)
+	*v += delta
+}
+
+// Collect implements Collector
+func (c *CounterVec) Collect() []Family {
+	return []Family{c.collectValues(TypeCounter)}
+}
+
+// GaugeVec is a gauge partitioned by labels
+type GaugeVec struct {
+	*vec
+}
+
+// Set sets the gauge for labelValues
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	v := g.get(labelValues, func() any { return new(float64) }).(*float64)
+	*v = value
+}
+
+// Add adds delta to the gauge for labelValues
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	v := g.get(labelValues, func() any { return new(float64) }).(*float64)
+	*v += delta
+}
+
+// Collect implements Collector
+func (g *GaugeVec) Collect() []Family {
+	return []Family{g.collectValues(TypeGauge)}
+}
+
+func (v *vec) collectValues(metricType string) Family {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	f := Family{Name: v.name, Help: v.help, Type: metricType}
+	for _, k := range v.sortedKeys() {
+		f.Samples = append(f.Samples, Sample{Labels: v.labels[k], Value: *v.series[k].(*float64)})
+	}
+
+	return f
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	*vec
+	buckets []float64
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Observe adds a single observation to the histogram for labelValues
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.get(labelValues, func() any {
+		return &histogram{counts: make([]uint64, len(h.buckets))}
+	}).(*histogram)
+
+	for i, upper := range h.buckets {
+		if value <= upper {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+// Collect implements Collector
+func (h *HistogramVec) Collect() []Family {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	f := Family{Name: h.name, Help: h.help, Type: TypeHistogram}
+	for _, k := range h.sortedKeys() {
+		s := h.series[k].(*histogram)
+		labels := h.labels[k]
+
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			f.Samples = append(f.Samples, Sample{
+				Suffix: "_bucket",
+				Labels: withLabel(labels, "le", formatValue(upper)),
+				Value:  float64(cumulative),
+			})
+		}
+
+		f.Samples = append(f.Samples,
+			Sample{Suffix: "_bucket", Labels: withLabel(labels, "le", "+Inf"), Value: float64(s.count)},
+			Sample{Suffix: "_sum", Labels: labels, Value: s.sum},
+			Sample{Suffix: "_count", Labels: labels, Value: float64(s.count)},
+		)
+	}
+
+	return []Family{f}
+}
+
+// withLabel returns a copy of labels with another label appended
+func withLabel(labels []Label, name, value string) []Label {
+	res := make([]Label, len(labels), len(labels)+1)
+	copy(res, labels)
+
+	return append(res, Label{Name: name, Value: value})
+}
+
+// CollectorFunc adapts a function to a Collector
+type CollectorFunc func() []Family
+
+// Collect implements Collector
+func (f CollectorFunc) Collect() []Family {
+	return f()
+}
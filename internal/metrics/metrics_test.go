@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	t.Run("counter", func(t *testing.T) {
+		reg := NewRegistry()
+		c := reg.NewCounterVec("messages_total", "Messages.", "topic", "partition")
+
+		c.Inc("stock-updates", "0")
+		c.Add(2, "stock-updates", "0")
+		c.Inc("stock-updates", "1")
+
+		var b strings.Builder
+		if err := reg.WriteText(&b); err != nil {
+			t.Fatalf("Expected error to be nil, got %s", err)
+		}
+
+		expected := `# HELP messages_total Messages.
+# TYPE messages_total counter
+messages_total{topic="stock-updates",partition="0"} 3
+messages_total{topic="stock-updates",partition="1"} 1
+`
+		if b.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, b.String())
+		}
+	})
+
+	t.Run("histogram", func(t *testing.T) {
+		reg := NewRegistry()
+		h := reg.NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+
+		h.Observe(0.05, "/inventory")
+		h.Observe(0.5, "/inventory")
+		h.Observe(5, "/inventory")
+
+		var b strings.Builder
+		reg.WriteText(&b)
+
+		for _, line := range []string{
+			`latency_seconds_bucket{route="/inventory",le="0.1"} 1`,
+			`latency_seconds_bucket{route="/inventory",le="1"} 2`,
+			`latency_seconds_bucket{route="/inventory",le="+Inf"} 3`,
+			`latency_seconds_sum{route="/inventory"} 5.55`,
+			`latency_seconds_count{route="/inventory"} 3`,
+		} {
+			if !strings.Contains(b.String(), line+"\n") {
+				t.Errorf("Expected output to contain %q, got %q", line, b.String())
+			}
+		}
+	})
+
+	t.Run("escapes label values", func(t *testing.T) {
+		reg := NewRegistry()
+		reg.NewGaugeVec("errors", "Errors.", "err").Set(1, "bad \"value\"\n")
+
+		var b strings.Builder
+		reg.WriteText(&b)
+
+		if !strings.Contains(b.String(), `errors{err="bad \"value\"\n"} 1`) {
+			t.Errorf("Expected label value to be escaped, got %q", b.String())
+		}
+	})
+
+	t.Run("skips metrics without samples", func(t *testing.T) {
+		reg := NewRegistry()
+		reg.NewCounterVec("unused_total", "Unused.")
+
+		var b strings.Builder
+		reg.WriteText(&b)
+
+		if b.String() != "" {
+			t.Errorf("Expected empty output, got %q", b.String())
+		}
+	})
+}
+
+func TestInstrumentHandler(t *testing.T) {
+	reg := NewRegistry()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /products/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	handler := InstrumentHandler(reg, mux)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/products/42", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nowhere", nil))
+
+	var b strings.Builder
+	reg.WriteText(&b)
+
+	for _, line := range []string{
+		`http_request_duration_seconds_count{route="/products/{id}",method="GET",code="404"} 1`,
+		`http_request_duration_seconds_count{route="unmatched",method="GET",code="404"} 1`,
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("Expected output to contain %q, got %q", line, b.String())
+		}
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	name := sanitizeName("consumer-request-latency-in-ms-for-broker-1")
+	expected := "consumer_request_latency_in_ms_for_broker_1"
+
+	if name != expected {
+		t.Errorf("Expected %s, got %s", expected, name)
+	}
+}
@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// NewPoolCollector returns a collector reporting the connection stats of a pgx pool
+func NewPoolCollector(stat func() *pgxpool.Stat) Collector {
+	return CollectorFunc(func() []Family {
+		s := stat()
+
+		return []Family{
+			poolFamily("pgxpool_acquired_conns", "Connections currently acquired from the pool.", TypeGauge, float64(s.AcquiredConns())),
+			poolFamily("pgxpool_idle_conns", "Idle connections in the pool.", TypeGauge, float64(s.IdleConns())),
+			poolFamily("pgxpool_constructing_conns", "Connections being established.", TypeGauge, float64(s.ConstructingConns())),
+			poolFamily("pgxpool_total_conns", "Connections in the pool.", TypeGauge, float64(s.TotalConns())),
+			poolFamily("pgxpool_max_conns", "Maximum size of the pool.", TypeGauge, float64(s.MaxConns())),
+			poolFamily("pgxpool_acquires_total", "Connections acquired from the pool.", TypeCounter, float64(s.AcquireCount())),
+			poolFamily("pgxpool_acquire_duration_seconds_total", "Time spent acquiring connections.", TypeCounter, s.AcquireDuration().Seconds()),
+			poolFamily("pgxpool_empty_acquires_total", "Acquires that had to wait for a connection.", TypeCounter, float64(s.EmptyAcquireCount())),
+			poolFamily("pgxpool_canceled_acquires_total", "Acquires canceled by their context.", TypeCounter, float64(s.CanceledAcquireCount())),
+			poolFamily("pgxpool_new_conns_total", "Connections opened.", TypeCounter, float64(s.NewConnsCount())),
+			poolFamily("pgxpool_max_lifetime_destroys_total", "Connections closed for exceeding their lifetime.", TypeCounter, float64(s.MaxLifetimeDestroyCount())),
+			poolFamily("pgxpool_max_idle_destroys_total", "Connections closed for being idle too long.", TypeCounter, float64(s.MaxIdleDestroyCount())),
+		}
+	})
+}
+
+func poolFamily(name, help, metricType string, value float64) Family {
+	return Family{Name: name, Help: help, Type: metricType, Samples: []Sample{{Value: value}}}
+}
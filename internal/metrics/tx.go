@@ -0,0 +1,21 @@
+package metrics
+
+import "time"
+
+var txDuration = Default.NewHistogramVec(
+	"db_transaction_duration_seconds",
+	"Duration of database transactions by outcome.",
+	DefaultBuckets,
+	"outcome",
+)
+
+// ObserveTx records the duration of a database transaction as committed, or as rolled back when it
+// ended with an error. It is a db.TxObserver
+func ObserveTx(d time.Duration, err error) {
+	outcome := "commit"
+	if err != nil {
+		outcome = "rollback"
+	}
+
+	txDuration.Observe(d.Seconds(), outcome)
+}
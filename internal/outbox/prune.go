@@ -0,0 +1,63 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/achere/heroku-kafka-demo-go/db/sqlc"
+)
+
+// pruneBatchSize is the number of sent messages deleted at a time when pruning
+const pruneBatchSize = 10000
+
+// Pruner deletes outbox messages sent longer than a retention ago
+type Pruner interface {
+	DeleteSentOutboxMessages(ctx context.Context, arg db.DeleteSentOutboxMessagesParams) (int64, error)
+}
+
+// Prune deletes the messages sent longer than retention ago and returns how many were deleted.
+// Pending messages are never deleted
+func Prune(ctx context.Context, p Pruner, retention time.Duration) (int64, error) {
+	var pruned int64
+
+	for {
+		n, err := p.DeleteSentOutboxMessages(ctx, db.DeleteSentOutboxMessagesParams{
+			RetentionSeconds: int64(retention / time.Second),
+			BatchSize:        pruneBatchSize,
+		})
+		if err != nil {
+			return pruned, fmt.Errorf("error pruning sent outbox messages: %w", err)
+		}
+
+		pruned += n
+		if n < pruneBatchSize {
+			return pruned, nil
+		}
+	}
+}
+
+// PruneEvery prunes the messages sent longer than retention ago every interval until ctx is done
+func PruneEvery(ctx context.Context, p Pruner, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pruned, err := Prune(ctx, p, retention)
+		if err != nil {
+			slog.Error("error pruning outbox", "at", "outbox", "err", err)
+			continue
+		}
+
+		if pruned > 0 {
+			slog.Info("sent outbox messages pruned", "at", "outbox", "count", pruned)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/achere/heroku-kafka-demo-go/db/sqlc"
+)
+
+// batchPruner deletes up to a batch from a number of prunable messages
+type batchPruner struct {
+	prunable int64
+	err      error
+}
+
+func (p *batchPruner) DeleteSentOutboxMessages(ctx context.Context, arg db.DeleteSentOutboxMessagesParams) (int64, error) {
+	if p.err != nil {
+		return 0, p.err
+	}
+
+	n := min(p.prunable, int64(arg.BatchSize))
+	p.prunable -= n
+	return n, nil
+}
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("deletes in batches until nothing is left", func(t *testing.T) {
+		p := &batchPruner{prunable: 2*pruneBatchSize + 1}
+
+		pruned, err := Prune(ctx, p, 24*time.Hour)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		if pruned != 2*pruneBatchSize+1 || p.prunable != 0 {
+			t.Errorf("Expected %d messages to be pruned, got %d", 2*pruneBatchSize+1, pruned)
+		}
+	})
+
+	t.Run("reports errors", func(t *testing.T) {
+		boom := errors.New("boom")
+
+		if _, err := Prune(ctx, &batchPruner{err: boom}, time.Hour); !errors.Is(err, boom) {
+			t.Errorf("Expected %v, got %v", boom, err)
+		}
+	})
+}
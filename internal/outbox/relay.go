@@ -0,0 +1,131 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/achere/heroku-kafka-demo-go/db/sqlc"
+	"github.com/achere/heroku-kafka-demo-go/internal/codec"
+	"github.com/achere/heroku-kafka-demo-go/internal/metrics"
+)
+
+// messagesPublished counts outbox messages published per topic, on the alert topic these are the
+// low-stock alerts emitted
+var messagesPublished = metrics.Default.NewCounterVec(
+	"outbox_messages_published_total",
+	"Outbox messages published to Kafka by topic.",
+	"topic",
+)
+
+// Sender publishes a message with headers to Kafka, it is satisfied by transport.KafkaClient
+type Sender interface {
+	SendMessageWithHeaders(topic, key string, message []byte, headers []sarama.RecordHeader) error
+}
+
+// Store is the part of the queries the relay reads and marks pending messages with
+type Store interface {
+	ListPendingOutboxMessages(ctx context.Context, limit int32) ([]db.ListPendingOutboxMessagesRow, error)
+	MarkOutboxMessageSent(ctx context.Context, outboxID int64) error
+}
+
+// Relay publishes messages written to the outbox table and marks them as sent. A message is only
+// marked once Kafka acknowledged it, so delivery is at-least-once. Messages are stored as JSON
+// envelopes and published in the format of the codec, named by their content-type header
+type Relay struct {
+	// execTx runs fn with a Store bound to a transaction, committing it if fn succeeds
+	execTx    func(ctx context.Context, fn func(Store) error) error
+	sender    Sender
+	codec     codec.Codec
+	interval  time.Duration
+	batchSize int32
+}
+
+// NewRelay creates a Relay that polls the outbox every interval for up to batchSize messages
+func NewRelay(conn db.TxBeginner, sender Sender, c codec.Codec, interval time.Duration, batchSize int) *Relay {
+	return &Relay{
+		execTx: func(ctx context.Context, fn func(Store) error) error {
+			return db.ExecTx(ctx, conn, metrics.ObserveTx, func(q *db.Queries) error { return fn(q) })
+		},
+		sender:    sender,
+		codec:     c,
+		interval:  interval,
+		batchSize: int32(batchSize),
+	}
+}
+
+// Run relays pending messages until ctx is done
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		sent, err := r.RelayPending(ctx)
+		if err != nil {
+			slog.Error("error relaying outbox", "at", "outbox", "err", err)
+		}
+
+		// A full batch means there may be more waiting, don't wait for the next tick
+		if err == nil && sent == int(r.batchSize) {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayPending publishes a batch of pending messages and returns how many were sent. Rows are locked
+// while they are published so several relays can run side by side
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	sent := 0
+	var sendErr error
+
+	err := r.execTx(ctx, func(q Store) error {
+		msgs, err := q.ListPendingOutboxMessages(ctx, r.batchSize)
+		if err != nil {
+			return fmt.Errorf("error listing pending outbox messages: %w", err)
+		}
+
+		headers := []sarama.RecordHeader{
+			{Key: []byte(codec.HeaderContentType), Value: []byte(r.codec.ContentType())},
+		}
+
+		for _, msg := range msgs {
+			// A message that can't be encoded stops the relay like a failed send, so it isn't skipped
+			var value []byte
+			if value, sendErr = r.codec.Encode(msg.Payload); sendErr != nil {
+				return nil
+			}
+
+			if sendErr = r.sender.SendMessageWithHeaders(msg.Topic, msg.MessageKey, value, headers); sendErr != nil {
+				// Commit what was sent so far, the rest is retried on the next poll
+				return nil
+			}
+			messagesPublished.Inc(msg.Topic)
+
+			if err = q.MarkOutboxMessageSent(ctx, msg.OutboxID); err != nil {
+				return fmt.Errorf("error marking outbox message %d sent: %w", msg.OutboxID, err)
+			}
+
+			slog.Info("alert sent", "at", "outbox", "topic", msg.Topic, "outbox_id", msg.OutboxID)
+			sent++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if sendErr != nil {
+		return sent, fmt.Errorf("error sending outbox message: %w", sendErr)
+	}
+
+	return sent, nil
+}
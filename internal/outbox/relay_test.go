@@ -0,0 +1,201 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/achere/heroku-kafka-demo-go/db/sqlc"
+	"github.com/achere/heroku-kafka-demo-go/internal/codec"
+)
+
+// fakeOutbox holds outbox rows, the changes of a transaction are undone when it fails
+type fakeOutbox struct {
+	rows    []db.ListPendingOutboxMessagesRow
+	sent    map[int64]bool
+	markErr error
+}
+
+func newFakeOutbox(keys ...string) *fakeOutbox {
+	o := &fakeOutbox{sent: make(map[int64]bool)}
+	for i, key := range keys {
+		o.rows = append(o.rows, db.ListPendingOutboxMessagesRow{
+			OutboxID:   int64(i + 1),
+			Topic:      "low-stock-alerts",
+			MessageKey: key,
+			Payload:    []byte(`{"type":"low_stock_alert","version":1,"id":"` + key + `","occurred_at":"2025-01-02T15:04:05Z","source":"wms","payload":{"product_id":1,"warehouse_id":2,"current_stock":3,"threshold":5}}`),
+		})
+	}
+
+	return o
+}
+
+func (o *fakeOutbox) execTx(ctx context.Context, fn func(Store) error) error {
+	before := make(map[int64]bool, len(o.sent))
+	for id, sent := range o.sent {
+		before[id] = sent
+	}
+
+	if err := fn(o); err != nil {
+		o.sent = before
+		return err
+	}
+
+	return nil
+}
+
+func (o *fakeOutbox) ListPendingOutboxMessages(ctx context.Context, limit int32) ([]db.ListPendingOutboxMessagesRow, error) {
+	var pending []db.ListPendingOutboxMessagesRow
+	for _, row := range o.rows {
+		if !o.sent[row.OutboxID] && len(pending) < int(limit) {
+			pending = append(pending, row)
+		}
+	}
+
+	return pending, nil
+}
+
+func (o *fakeOutbox) MarkOutboxMessageSent(ctx context.Context, outboxID int64) error {
+	if o.markErr != nil {
+		return o.markErr
+	}
+
+	o.sent[outboxID] = true
+	return nil
+}
+
+func (o *fakeOutbox) unsent() []string {
+	var keys []string
+	for _, row := range o.rows {
+		if !o.sent[row.OutboxID] {
+			keys = append(keys, row.MessageKey)
+		}
+	}
+
+	return keys
+}
+
+// fakeSender records published messages, failing the ones with a key in fail
+type fakeSender struct {
+	keys        []string
+	contentType string
+	fail        map[string]bool
+}
+
+func (s *fakeSender) SendMessageWithHeaders(topic, key string, message []byte, headers []sarama.RecordHeader) error {
+	if s.fail[key] {
+		return errors.New("broker unavailable")
+	}
+
+	s.keys = append(s.keys, key)
+	for _, h := range headers {
+		if string(h.Key) == codec.HeaderContentType {
+			s.contentType = string(h.Value)
+		}
+	}
+
+	return nil
+}
+
+func newTestRelay(o *fakeOutbox, s *fakeSender, c codec.Codec, batchSize int32) *Relay {
+	return &Relay{execTx: o.execTx, sender: s, codec: c, batchSize: batchSize}
+}
+
+func TestRelayPending(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("publishes pending messages and marks them sent", func(t *testing.T) {
+		o := newFakeOutbox("1:2", "1:3")
+		s := &fakeSender{}
+		r := newTestRelay(o, s, codec.NewProtobuf(), 10)
+
+		sent, err := r.RelayPending(ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		if sent != 2 || !slices.Equal(s.keys, []string{"1:2", "1:3"}) {
+			t.Errorf("Expected 1:2 and 1:3 to be sent, got %d: %v", sent, s.keys)
+		}
+
+		if s.contentType != "application/x-protobuf" {
+			t.Errorf("Expected the protobuf content type, got %q", s.contentType)
+		}
+
+		if unsent := o.unsent(); len(unsent) != 0 {
+			t.Errorf("Expected every message to be marked sent, got %v", unsent)
+		}
+
+		if sent, _ := r.RelayPending(ctx); sent != 0 {
+			t.Errorf("Expected nothing to be sent again, got %d", sent)
+		}
+	})
+
+	t.Run("sends at most a batch", func(t *testing.T) {
+		o := newFakeOutbox("1:2", "1:3", "1:4")
+		r := newTestRelay(o, &fakeSender{}, codec.JSON{}, 2)
+
+		if sent, err := r.RelayPending(ctx); err != nil || sent != 2 {
+			t.Errorf("Expected 2 messages to be sent, got %d and %v", sent, err)
+		}
+
+		if unsent := o.unsent(); !slices.Equal(unsent, []string{"1:4"}) {
+			t.Errorf("Expected 1:4 to be left, got %v", unsent)
+		}
+	})
+
+	t.Run("leaves messages from a failed send on unsent", func(t *testing.T) {
+		o := newFakeOutbox("1:2", "1:3", "1:4")
+		s := &fakeSender{fail: map[string]bool{"1:3": true}}
+		r := newTestRelay(o, s, codec.JSON{}, 10)
+
+		sent, err := r.RelayPending(ctx)
+		if err == nil {
+			t.Fatal("Expected an error")
+		}
+
+		if sent != 1 || !slices.Equal(s.keys, []string{"1:2"}) {
+			t.Errorf("Expected only 1:2 to be sent, got %d: %v", sent, s.keys)
+		}
+
+		if unsent := o.unsent(); !slices.Equal(unsent, []string{"1:3", "1:4"}) {
+			t.Errorf("Expected 1:3 and 1:4 to be left, got %v", unsent)
+		}
+
+		delete(s.fail, "1:3")
+		if sent, err := r.RelayPending(ctx); err != nil || sent != 2 {
+			t.Errorf("Expected the rest to be sent on the next poll, got %d and %v", sent, err)
+		}
+	})
+
+	t.Run("leaves messages that can't be encoded unsent", func(t *testing.T) {
+		o := newFakeOutbox("1:2")
+		o.rows[0].Payload = []byte(`{"type":"transfer","version":1,"payload":{}}`)
+		r := newTestRelay(o, &fakeSender{}, codec.NewProtobuf(), 10)
+
+		if _, err := r.RelayPending(ctx); err == nil {
+			t.Error("Expected an error")
+		}
+
+		if unsent := o.unsent(); len(unsent) != 1 {
+			t.Errorf("Expected the message to be left, got %v", unsent)
+		}
+	})
+
+	t.Run("rolls back when marking fails", func(t *testing.T) {
+		o := newFakeOutbox("1:2", "1:3")
+		o.markErr = errors.New("connection reset")
+		s := &fakeSender{}
+		r := newTestRelay(o, s, codec.JSON{}, 10)
+
+		if _, err := r.RelayPending(ctx); !errors.Is(err, o.markErr) {
+			t.Errorf("Expected %v, got %v", o.markErr, err)
+		}
+
+		if unsent := o.unsent(); len(unsent) != 2 {
+			t.Errorf("Expected both messages to be relayed again, got %v left", unsent)
+		}
+	})
+}
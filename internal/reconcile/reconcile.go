@@ -0,0 +1,251 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/achere/heroku-kafka-demo-go/db/sqlc"
+	"github.com/achere/heroku-kafka-demo-go/internal/inventory"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// rescanMargin is how far behind the last run's checkpoint stock logs are checked again. Stock log IDs
+// are handed out when a row is inserted rather than when it is committed, so a transaction running
+// during the last run may commit stock logs below the checkpoint. It has to be longer than any
+// transaction writing stock logs
+const rescanMargin = 10 * time.Minute
+
+// Drift is a difference between the stock level of an inventory and the stock derived by replaying
+// its stock log
+type Drift struct {
+	ProductID    int   `json:"product_id"`
+	WarehouseID  int   `json:"warehouse_id"`
+	StockLevel   int   `json:"stock_level"`
+	DerivedStock int   `json:"derived_stock"`
+	Movements    int64 `json:"movements"`
+	Repaired     bool  `json:"repaired"`
+}
+
+// Difference is how much the stock level is above the derived stock
+func (d Drift) Difference() int {
+	return d.StockLevel - d.DerivedStock
+}
+
+// Store is the part of the queries the reconciler lists drift and keeps its checkpoint with
+type Store interface {
+	GetReconcileCheckpoint(ctx context.Context) (db.GetReconcileCheckpointRow, error)
+	GetLastStockLogID(ctx context.Context) (db.GetLastStockLogIDRow, error)
+	ListInventoryDrift(ctx context.Context, arg db.ListInventoryDriftParams) ([]db.ListInventoryDriftRow, error)
+	UpdateReconcileCheckpoint(ctx context.Context, arg db.UpdateReconcileCheckpointParams) error
+}
+
+// RepairStore is the part of the queries a repair locks, derives and corrects an inventory with
+type RepairStore interface {
+	GetInventoryForUpdate(ctx context.Context, arg db.GetInventoryForUpdateParams) (db.GetInventoryForUpdateRow, error)
+	GetDerivedStock(ctx context.Context, arg db.GetDerivedStockParams) (int32, error)
+	UpdateInventory(ctx context.Context, arg db.UpdateInventoryParams) (db.UpdateInventoryRow, error)
+	InsertStockLog(ctx context.Context, arg db.InsertStockLogParams) error
+}
+
+// Reconciler compares inventory with the stock derived from stock_logs. The derived stock is the
+// stock before the first movement plus the sum of all movements except corrections, so repairs don't
+// hide the drift they fixed from the log. Inventory without any stock log can't be checked.
+//
+// Runs start from a checkpoint, the last stock log checked and when, and only check inventory with
+// stock logs written since, or within rescanMargin before it so stock logs committed late are not
+// skipped. Inventory updated directly without a stock log is only checked once it moves again, a full
+// run checks all inventory
+type Reconciler struct {
+	store Store
+	// execTx runs fn with a RepairStore bound to a transaction, committing it if fn succeeds
+	execTx func(ctx context.Context, fn func(RepairStore, inventory.Cache) error) error
+}
+
+func NewReconciler(dbpool *pgxpool.Pool, c inventory.Cache) *Reconciler {
+	return &Reconciler{
+		store: db.New(dbpool),
+		execTx: func(ctx context.Context, fn func(RepairStore, inventory.Cache) error) error {
+			return inventory.ExecTx(ctx, dbpool, c, func(q *db.Queries, c inventory.Cache) error { return fn(q, c) })
+		},
+	}
+}
+
+// Run reports every inventory with stock logs written since the last run whose stock level drifted
+// from its stock log. With repair the stock level is set to the derived stock and a correction is
+// written to the stock log
+func (r *Reconciler) Run(ctx context.Context, repair bool) ([]Drift, error) {
+	checkpoint, err := r.store.GetReconcileCheckpoint(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting reconcile checkpoint: %w", err)
+	}
+
+	var since pgtype.Timestamp
+	if checkpoint.CheckedAt.Valid {
+		since = pgtype.Timestamp{Time: checkpoint.CheckedAt.Time.Add(-rescanMargin), Valid: true}
+	}
+
+	return r.run(ctx, checkpoint.LastLogID, since, repair)
+}
+
+// RunFull is Run over every inventory with a stock log, regardless of the checkpoint
+func (r *Reconciler) RunFull(ctx context.Context, repair bool) ([]Drift, error) {
+	return r.run(ctx, 0, pgtype.Timestamp{}, repair)
+}
+
+// run checks inventory with stock logs after afterLogID or written since, and moves the checkpoint
+// to the last stock log once all of them were checked, and repaired when asked to
+func (r *Reconciler) run(ctx context.Context, afterLogID int32, since pgtype.Timestamp, repair bool) ([]Drift, error) {
+	last, err := r.store.GetLastStockLogID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting last stock log: %w", err)
+	}
+
+	rows, err := r.store.ListInventoryDrift(ctx, db.ListInventoryDriftParams{
+		AfterLogID:   afterLogID,
+		Since:        since,
+		ThroughLogID: last.LastLogID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing inventory drift: %w", err)
+	}
+
+	drifts := make([]Drift, 0, len(rows))
+	for _, row := range rows {
+		d := Drift{
+			ProductID:    int(row.ProductID),
+			WarehouseID:  int(row.WarehouseID),
+			StockLevel:   int(row.StockLevel),
+			DerivedStock: int(row.DerivedStock),
+			Movements:    row.Movements,
+		}
+		slog.Warn(
+			"inventory drift",
+			"at", "reconcile",
+			"product_id", d.ProductID,
+			"warehouse_id", d.WarehouseID,
+			"stock_level", d.StockLevel,
+			"derived_stock", d.DerivedStock,
+		)
+
+		if repair {
+			if d, err = r.repair(ctx, d); err != nil {
+				return drifts, err
+			}
+		}
+
+		drifts = append(drifts, d)
+	}
+
+	err = r.store.UpdateReconcileCheckpoint(ctx, db.UpdateReconcileCheckpointParams{
+		LastLogID: last.LastLogID,
+		CheckedAt: last.CheckedAt,
+	})
+	if err != nil {
+		return drifts, fmt.Errorf("error updating reconcile checkpoint: %w", err)
+	}
+
+	return drifts, nil
+}
+
+// repair sets the stock level to the derived stock. Both are read again under a row lock since
+// messages may have been applied since the drift was listed
+func (r *Reconciler) repair(ctx context.Context, d Drift) (Drift, error) {
+	err := r.execTx(ctx, func(q RepairStore, c inventory.Cache) error {
+		inv, err := q.GetInventoryForUpdate(ctx, db.GetInventoryForUpdateParams{
+			WarehouseID: int32(d.WarehouseID),
+			ProductID:   int32(d.ProductID),
+		})
+		if err != nil {
+			return err
+		}
+
+		derived, err := q.GetDerivedStock(ctx, db.GetDerivedStockParams{
+			ProductID:   int32(d.ProductID),
+			WarehouseID: int32(d.WarehouseID),
+		})
+		if err != nil {
+			return err
+		}
+
+		d.StockLevel, d.DerivedStock = int(inv.StockLevel), int(derived)
+		if d.StockLevel == d.DerivedStock || d.DerivedStock < 0 {
+			return nil
+		}
+
+		upd, err := q.UpdateInventory(ctx, db.UpdateInventoryParams{
+			StockLevel:  derived,
+			WarehouseID: int32(d.WarehouseID),
+			ProductID:   int32(d.ProductID),
+		})
+		if err != nil {
+			return err
+		}
+
+		err = q.InsertStockLog(ctx, db.InsertStockLogParams{
+			ProductID:     int32(d.ProductID),
+			WarehouseID:   int32(d.WarehouseID),
+			PreviousStock: inv.StockLevel,
+			UpdatedStock:  derived,
+			IsCorrection:  true,
+		})
+		if err != nil {
+			return err
+		}
+
+		inventory.CacheInventory(ctx, c, d.ProductID, d.WarehouseID, d.DerivedStock, int(upd.AlertThreshold), upd.Version)
+
+		d.Repaired = true
+		return nil
+	})
+	if err != nil {
+		return d, fmt.Errorf("error repairing product %d in warehouse %d: %w", d.ProductID, d.WarehouseID, err)
+	}
+
+	if !d.Repaired {
+		if d.DerivedStock < 0 {
+			slog.Warn(
+				"derived stock is negative, not repairing",
+				"at", "reconcile",
+				"product_id", d.ProductID,
+				"warehouse_id", d.WarehouseID,
+				"derived_stock", d.DerivedStock,
+			)
+		}
+		return d, nil
+	}
+
+	slog.Info(
+		"inventory repaired",
+		"at", "reconcile",
+		"product_id", d.ProductID,
+		"warehouse_id", d.WarehouseID,
+		"stock_level", d.DerivedStock,
+	)
+
+	return d, nil
+}
+
+// RunEvery reconciles inventory every interval until ctx is done
+func (r *Reconciler) RunEvery(ctx context.Context, interval time.Duration, repair bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		drifts, err := r.Run(ctx, repair)
+		if err != nil {
+			slog.Error("error reconciling inventory", "at", "reconcile", "err", err)
+			continue
+		}
+
+		slog.Info("inventory reconciled", "at", "reconcile", "drifts", len(drifts), "repair", repair)
+	}
+}
@@ -0,0 +1,347 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/achere/heroku-kafka-demo-go/db/sqlc"
+	"github.com/achere/heroku-kafka-demo-go/internal/inventory"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type inventoryKey struct {
+	productID, warehouseID int32
+}
+
+type stockLog struct {
+	logID         int32
+	key           inventoryKey
+	previousStock int32
+	updatedStock  int32
+	isCorrection  bool
+	timestamp     time.Time
+}
+
+// fakeStore holds inventory with its stock logs, the changes of a transaction are undone when it
+// fails. Stock logs are written at now
+type fakeStore struct {
+	stock      map[inventoryKey]int32
+	logs       []stockLog
+	checkpoint int32
+	checkedAt  pgtype.Timestamp
+	now        time.Time
+	insertErr  error
+	cache      fakeCache
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		stock: make(map[inventoryKey]int32),
+		now:   time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		cache: make(fakeCache),
+	}
+}
+
+// move logs a movement of an inventory and sets its stock level to the updated stock
+func (s *fakeStore) move(productID, warehouseID, previousStock, updatedStock int32) {
+	key := inventoryKey{productID, warehouseID}
+	s.logs = append(s.logs, stockLog{
+		logID:         int32(len(s.logs) + 1),
+		key:           key,
+		previousStock: previousStock,
+		updatedStock:  updatedStock,
+		timestamp:     s.now,
+	})
+	s.stock[key] = updatedStock
+}
+
+func (s *fakeStore) execTx(ctx context.Context, fn func(RepairStore, inventory.Cache) error) error {
+	stock := make(map[inventoryKey]int32, len(s.stock))
+	for key, level := range s.stock {
+		stock[key] = level
+	}
+	logs := slices.Clone(s.logs)
+
+	if err := fn(s, s.cache); err != nil {
+		s.stock, s.logs = stock, logs
+		return err
+	}
+
+	return nil
+}
+
+func (s *fakeStore) derivedStock(key inventoryKey) int32 {
+	var derived int32
+	first := true
+	for _, l := range s.logs {
+		if l.key != key || l.isCorrection {
+			continue
+		}
+		if first {
+			derived, first = l.previousStock, false
+		}
+		derived += l.updatedStock - l.previousStock
+	}
+
+	return derived
+}
+
+func (s *fakeStore) GetReconcileCheckpoint(ctx context.Context) (db.GetReconcileCheckpointRow, error) {
+	return db.GetReconcileCheckpointRow{LastLogID: s.checkpoint, CheckedAt: s.checkedAt}, nil
+}
+
+func (s *fakeStore) GetLastStockLogID(ctx context.Context) (db.GetLastStockLogIDRow, error) {
+	return db.GetLastStockLogIDRow{
+		LastLogID: int32(len(s.logs)),
+		CheckedAt: pgtype.Timestamp{Time: s.now, Valid: true},
+	}, nil
+}
+
+func (s *fakeStore) ListInventoryDrift(ctx context.Context, arg db.ListInventoryDriftParams) ([]db.ListInventoryDriftRow, error) {
+	var keys []inventoryKey
+	for _, l := range s.logs {
+		since := arg.Since.Valid && !l.timestamp.Before(arg.Since.Time)
+		if (l.logID > arg.AfterLogID || since) && l.logID <= arg.ThroughLogID && !slices.Contains(keys, l.key) {
+			keys = append(keys, l.key)
+		}
+	}
+
+	var rows []db.ListInventoryDriftRow
+	for _, key := range keys {
+		var movements int64
+		for _, l := range s.logs {
+			if l.key == key {
+				movements++
+			}
+		}
+
+		if derived := s.derivedStock(key); derived != s.stock[key] {
+			rows = append(rows, db.ListInventoryDriftRow{
+				ProductID:    key.productID,
+				WarehouseID:  key.warehouseID,
+				StockLevel:   s.stock[key],
+				DerivedStock: derived,
+				Movements:    movements,
+			})
+		}
+	}
+
+	return rows, nil
+}
+
+func (s *fakeStore) UpdateReconcileCheckpoint(ctx context.Context, arg db.UpdateReconcileCheckpointParams) error {
+	s.checkpoint = max(s.checkpoint, arg.LastLogID)
+	if !s.checkedAt.Valid || arg.CheckedAt.Time.After(s.checkedAt.Time) {
+		s.checkedAt = arg.CheckedAt
+	}
+	return nil
+}
+
+func (s *fakeStore) GetInventoryForUpdate(ctx context.Context, arg db.GetInventoryForUpdateParams) (db.GetInventoryForUpdateRow, error) {
+	return db.GetInventoryForUpdateRow{
+		StockLevel:     s.stock[inventoryKey{arg.ProductID, arg.WarehouseID}],
+		AlertThreshold: 5,
+		Version:        1,
+	}, nil
+}
+
+func (s *fakeStore) GetDerivedStock(ctx context.Context, arg db.GetDerivedStockParams) (int32, error) {
+	return s.derivedStock(inventoryKey{arg.ProductID, arg.WarehouseID}), nil
+}
+
+func (s *fakeStore) UpdateInventory(ctx context.Context, arg db.UpdateInventoryParams) (db.UpdateInventoryRow, error) {
+	s.stock[inventoryKey{arg.ProductID, arg.WarehouseID}] = arg.StockLevel
+	return db.UpdateInventoryRow{AlertThreshold: 5, Version: 2}, nil
+}
+
+func (s *fakeStore) InsertStockLog(ctx context.Context, arg db.InsertStockLogParams) error {
+	if s.insertErr != nil {
+		return s.insertErr
+	}
+
+	s.logs = append(s.logs, stockLog{
+		logID:         int32(len(s.logs) + 1),
+		key:           inventoryKey{arg.ProductID, arg.WarehouseID},
+		previousStock: arg.PreviousStock,
+		updatedStock:  arg.UpdatedStock,
+		isCorrection:  arg.IsCorrection,
+		timestamp:     s.now,
+	})
+	return nil
+}
+
+type fakeCache map[string]string
+
+func (c fakeCache) Get(ctx context.Context, key string) (string, error) {
+	return c[key], nil
+}
+
+func (c fakeCache) Set(ctx context.Context, key, value string, version int64) error {
+	c[key] = value
+	return nil
+}
+
+func (c fakeCache) Delete(ctx context.Context, key string) error {
+	delete(c, key)
+	return nil
+}
+
+func newTestReconciler(s *fakeStore) *Reconciler {
+	return &Reconciler{store: s, execTx: s.execTx}
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("reports drift without repairing it", func(t *testing.T) {
+		s := newFakeStore()
+		s.move(1, 1, 0, 5)
+		s.move(2, 1, 0, 3)
+		s.stock[inventoryKey{1, 1}] = 10
+
+		drifts, err := newTestReconciler(s).Run(ctx, false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		expected := []Drift{{ProductID: 1, WarehouseID: 1, StockLevel: 10, DerivedStock: 5, Movements: 1}}
+		if !slices.Equal(drifts, expected) {
+			t.Errorf("Expected drifts %v, got %v", expected, drifts)
+		}
+		if level := s.stock[inventoryKey{1, 1}]; level != 10 {
+			t.Errorf("Expected stock level 10, got %d", level)
+		}
+		if s.checkpoint != 2 {
+			t.Errorf("Expected checkpoint 2, got %d", s.checkpoint)
+		}
+	})
+
+	t.Run("repairs drift with a correction", func(t *testing.T) {
+		s := newFakeStore()
+		s.move(1, 1, 0, 5)
+		s.stock[inventoryKey{1, 1}] = 10
+
+		r := newTestReconciler(s)
+		drifts, err := r.Run(ctx, true)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if len(drifts) != 1 || !drifts[0].Repaired {
+			t.Fatalf("Expected one repaired drift, got %v", drifts)
+		}
+		if level := s.stock[inventoryKey{1, 1}]; level != 5 {
+			t.Errorf("Expected stock level 5, got %d", level)
+		}
+
+		correction := s.logs[len(s.logs)-1]
+		if !correction.isCorrection || correction.previousStock != 10 || correction.updatedStock != 5 {
+			t.Errorf("Expected a correction from 10 to 5, got %+v", correction)
+		}
+		if len(s.cache) != 1 {
+			t.Errorf("Expected the repaired inventory to be cached, got %v", s.cache)
+		}
+
+		drifts, err = r.Run(ctx, true)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(drifts) != 0 {
+			t.Errorf("Expected no drift after the repair, got %v", drifts)
+		}
+	})
+
+	t.Run("leaves negative derived stock alone", func(t *testing.T) {
+		s := newFakeStore()
+		s.move(1, 1, 2, -3)
+		s.stock[inventoryKey{1, 1}] = 0
+
+		drifts, err := newTestReconciler(s).Run(ctx, true)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if len(drifts) != 1 || drifts[0].Repaired {
+			t.Fatalf("Expected one drift that isn't repaired, got %v", drifts)
+		}
+		if len(s.logs) != 1 {
+			t.Errorf("Expected no correction, got %d stock logs", len(s.logs))
+		}
+	})
+
+	t.Run("only checks inventory with stock logs since the checkpoint", func(t *testing.T) {
+		s := newFakeStore()
+		s.move(1, 1, 0, 5)
+		s.stock[inventoryKey{1, 1}] = 10
+		s.now = s.now.Add(time.Hour)
+		s.checkpoint, s.checkedAt = 1, pgtype.Timestamp{Time: s.now, Valid: true}
+		s.move(2, 1, 0, 3)
+
+		r := newTestReconciler(s)
+		drifts, err := r.Run(ctx, false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(drifts) != 0 {
+			t.Errorf("Expected no drift, got %v", drifts)
+		}
+		if s.checkpoint != 2 {
+			t.Errorf("Expected checkpoint 2, got %d", s.checkpoint)
+		}
+
+		drifts, err = r.RunFull(ctx, false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(drifts) != 1 || drifts[0].ProductID != 1 {
+			t.Errorf("Expected the drift of product 1 in a full run, got %v", drifts)
+		}
+	})
+
+	t.Run("checks stock logs committed below the checkpoint by a late transaction", func(t *testing.T) {
+		s := newFakeStore()
+		s.move(2, 1, 0, 3)
+		s.move(1, 1, 0, 5)
+		s.stock[inventoryKey{1, 1}] = 10
+
+		// the last run saw stock log 2 but not stock log 1, which was committed after it
+		s.checkpoint, s.checkedAt = 2, pgtype.Timestamp{Time: s.now.Add(time.Minute), Valid: true}
+		s.now = s.now.Add(2 * time.Minute)
+
+		drifts, err := newTestReconciler(s).Run(ctx, false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(drifts) != 1 || drifts[0].ProductID != 1 {
+			t.Errorf("Expected the drift of product 1, got %v", drifts)
+		}
+		if !s.checkedAt.Time.Equal(s.now) {
+			t.Errorf("Expected the checkpoint to be checked at %s, got %s", s.now, s.checkedAt.Time)
+		}
+	})
+
+	t.Run("keeps the checkpoint when a repair fails", func(t *testing.T) {
+		s := newFakeStore()
+		s.move(1, 1, 0, 5)
+		s.stock[inventoryKey{1, 1}] = 10
+		s.insertErr = errors.New("connection reset")
+
+		_, err := newTestReconciler(s).Run(ctx, true)
+		if !errors.Is(err, s.insertErr) {
+			t.Fatalf("Expected error %v, got %v", s.insertErr, err)
+		}
+
+		if s.checkpoint != 0 {
+			t.Errorf("Expected checkpoint 0, got %d", s.checkpoint)
+		}
+		if level := s.stock[inventoryKey{1, 1}]; level != 10 {
+			t.Errorf("Expected the stock level to be rolled back to 10, got %d", level)
+		}
+		if len(s.cache) != 0 {
+			t.Errorf("Expected nothing cached, got %v", s.cache)
+		}
+	})
+}
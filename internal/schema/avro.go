@@ -0,0 +1,226 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// avroSchema is a compiled Avro schema used to validate JSON payloads. Union values are plain JSON
+// matching any of the branches rather than wrapped in an object naming the branch. Schemas using a
+// type it doesn't handle, such as fixed, fail to compile. Logical types are validated as their
+// underlying type like the Avro spec allows
+type avroSchema struct {
+	kind     string
+	name     string
+	fields   []avroField
+	symbols  []string
+	items    *avroSchema
+	values   *avroSchema
+	branches []*avroSchema
+}
+
+type avroField struct {
+	name       string
+	schema     *avroSchema
+	hasDefault bool
+}
+
+type avroDocument struct {
+	Type    json.RawMessage `json:"type"`
+	Name    string          `json:"name"`
+	Fields  []avroFieldDoc  `json:"fields"`
+	Symbols []string        `json:"symbols"`
+	Items   json.RawMessage `json:"items"`
+	Values  json.RawMessage `json:"values"`
+}
+
+type avroFieldDoc struct {
+	Name    string          `json:"name"`
+	Type    json.RawMessage `json:"type"`
+	Default json.RawMessage `json:"default"`
+}
+
+var avroPrimitives = []string{"null", "boolean", "int", "long", "float", "double", "bytes", "string"}
+
+func compileAvroSchema(data []byte) (*avroSchema, error) {
+	return (&avroCompiler{named: make(map[string]*avroSchema)}).compile(data)
+}
+
+// avroCompiler keeps track of named types so later parts of a schema can refer to them by name
+type avroCompiler struct {
+	named map[string]*avroSchema
+}
+
+func (c *avroCompiler) compile(data json.RawMessage) (*avroSchema, error) {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		if slices.Contains(avroPrimitives, name) {
+			return &avroSchema{kind: name}, nil
+		}
+		if s, ok := c.named[name]; ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("unknown Avro type %q", name)
+	}
+
+	var union []json.RawMessage
+	if err := json.Unmarshal(data, &union); err == nil {
+		s := &avroSchema{kind: "union"}
+		for _, raw := range union {
+			branch, err := c.compile(raw)
+			if err != nil {
+				return nil, err
+			}
+			s.branches = append(s.branches, branch)
+		}
+		return s, nil
+	}
+
+	var doc avroDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid Avro schema: %v", err)
+	}
+
+	var kind string
+	if err := json.Unmarshal(doc.Type, &kind); err != nil {
+		// A complex type given as the type of an object, such as {"type": {"type": "array", ...}}
+		return c.compile(doc.Type)
+	}
+
+	s := &avroSchema{kind: kind, name: doc.Name}
+
+	switch kind {
+	case "record":
+		c.named[doc.Name] = s
+		for _, f := range doc.Fields {
+			fs, err := c.compile(f.Type)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", f.Name, err)
+			}
+			s.fields = append(s.fields, avroField{name: f.Name, schema: fs, hasDefault: f.Default != nil})
+		}
+	case "enum":
+		c.named[doc.Name] = s
+		s.symbols = doc.Symbols
+	case "array":
+		items, err := c.compile(doc.Items)
+		if err != nil {
+			return nil, fmt.Errorf("items: %w", err)
+		}
+		s.items = items
+	case "map":
+		values, err := c.compile(doc.Values)
+		if err != nil {
+			return nil, fmt.Errorf("values: %w", err)
+		}
+		s.values = values
+	default:
+		if !slices.Contains(avroPrimitives, kind) {
+			return nil, fmt.Errorf("unsupported Avro type %q", kind)
+		}
+		// Primitives with attributes such as a logicalType
+		return c.compile(doc.Type)
+	}
+
+	return s, nil
+}
+
+func (s *avroSchema) validate(v any, path string, errs *[]string) {
+	addErr := func(format string, args ...any) {
+		*errs = append(*errs, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	switch s.kind {
+	case "null":
+		if v != nil {
+			addErr("expected null, got %s", jsonType(v))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			addErr("expected boolean, got %s", jsonType(v))
+		}
+	case "int", "long":
+		n, ok := v.(json.Number)
+		if !ok || !isInteger(n) {
+			addErr("expected %s, got %s", s.kind, jsonType(v))
+			return
+		}
+		if i, err := n.Int64(); s.kind == "int" && (err != nil || i < math.MinInt32 || i > math.MaxInt32) {
+			addErr("%s is out of range for int", n)
+		}
+	case "float", "double":
+		if _, ok := v.(json.Number); !ok {
+			addErr("expected %s, got %s", s.kind, jsonType(v))
+		}
+	case "bytes", "string":
+		if _, ok := v.(string); !ok {
+			addErr("expected %s, got %s", s.kind, jsonType(v))
+		}
+	case "enum":
+		sym, ok := v.(string)
+		if !ok || !slices.Contains(s.symbols, sym) {
+			addErr("must be one of %s", strings.Join(s.symbols, ", "))
+		}
+	case "array":
+		items, ok := v.([]any)
+		if !ok {
+			addErr("expected array, got %s", jsonType(v))
+			return
+		}
+		for i, item := range items {
+			s.items.validate(item, fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case "map":
+		values, ok := v.(map[string]any)
+		if !ok {
+			addErr("expected map, got %s", jsonType(v))
+			return
+		}
+		for key, value := range values {
+			s.values.validate(value, path+"."+key, errs)
+		}
+	case "record":
+		s.validateRecord(v, path, errs)
+	case "union":
+		for _, branch := range s.branches {
+			var branchErrs []string
+			branch.validate(v, path, &branchErrs)
+			if len(branchErrs) == 0 {
+				return
+			}
+		}
+		addErr("does not match any type of the union")
+	}
+}
+
+func (s *avroSchema) validateRecord(v any, path string, errs *[]string) {
+	fields, ok := v.(map[string]any)
+	if !ok {
+		*errs = append(*errs, fmt.Sprintf("%s: expected record %s, got %s", path, s.name, jsonType(v)))
+		return
+	}
+
+	known := make(map[string]bool, len(s.fields))
+	for _, f := range s.fields {
+		known[f.name] = true
+
+		value, ok := fields[f.name]
+		if !ok {
+			if !f.hasDefault {
+				*errs = append(*errs, path+"."+f.name+": is required")
+			}
+			continue
+		}
+
+		f.schema.validate(value, path+"."+f.name, errs)
+	}
+
+	for name := range fields {
+		if !known[name] {
+			*errs = append(*errs, path+"."+name+": is not allowed")
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+)
+
+// The envelope is validated against its own embedded schema before its payload is
+const (
+	EnvelopeSubject = "envelope"
+	EnvelopeVersion = 1
+)
+
+// Envelope wraps the payload of a message with its type and the version of the type's schema the
+// payload follows, which is also the subject and version it is validated against
+type Envelope struct {
+	Type       string          `json:"type"`
+	Version    int             `json:"version"`
+	ID         string          `json:"id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Source     string          `json:"source"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// NewEnvelope wraps payload in an envelope with a new ID, occurring now
+func NewEnvelope(msgType string, version int, source string, payload any) (Envelope, error) {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return Envelope{}, fmt.Errorf("error generating message id: %v", err)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("error marshalling %s payload: %v", msgType, err)
+	}
+
+	return Envelope{
+		Type:       msgType,
+		Version:    version,
+		ID:         id,
+		OccurredAt: time.Now().UTC(),
+		Source:     source,
+		Payload:    data,
+	}, nil
+}
+
+// IsEnvelope reports whether data is an enveloped message rather than a bare payload
+func IsEnvelope(data []byte) bool {
+	var probe struct {
+		Payload json.RawMessage `json:"payload"`
+	}
+
+	return json.Unmarshal(data, &probe) == nil && probe.Payload != nil
+}
+
+// Decode validates an enveloped message against the embedded envelope schema and its payload against
+// the schema of its type in the registry, and returns the envelope
+func (v *Validator) Decode(ctx context.Context, data []byte) (Envelope, error) {
+	if err := validate(v.envelope, EnvelopeSubject, EnvelopeVersion, data); err != nil {
+		return Envelope{}, err
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return Envelope{}, fmt.Errorf("error unmarshalling envelope: %v", err)
+	}
+
+	if err := v.Validate(ctx, env.Type, env.Version, env.Payload); err != nil {
+		return Envelope{}, err
+	}
+
+	return env, nil
+}
+
+// Encode validates the payload of an envelope against the schema of its type and returns the
+// enveloped message
+func (v *Validator) Encode(ctx context.Context, env Envelope) ([]byte, error) {
+	if err := v.Validate(ctx, env.Type, env.Version, env.Payload); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(env)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling envelope: %v", err)
+	}
+
+	return data, nil
+}
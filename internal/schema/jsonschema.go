@@ -0,0 +1,284 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// jsonSchema is a compiled JSON Schema. It supports the keywords message schemas need: type, enum,
+// properties, required, additionalProperties, items, minimum, maximum, minLength, maxLength and the
+// date-time format. Schemas using any other keyword, besides annotations like title, fail to compile
+// rather than have part of them ignored
+type jsonSchema struct {
+	types                []string
+	enum                 []json.RawMessage
+	properties           map[string]*jsonSchema
+	required             []string
+	additionalProperties *jsonSchema
+	noAdditional         bool
+	items                *jsonSchema
+	minimum              *float64
+	maximum              *float64
+	minLength            *int
+	maxLength            *int
+	format               string
+}
+
+type jsonSchemaDocument struct {
+	Type                 json.RawMessage            `json:"type"`
+	Enum                 []json.RawMessage          `json:"enum"`
+	Properties           map[string]json.RawMessage `json:"properties"`
+	Required             []string                   `json:"required"`
+	AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+	Items                json.RawMessage            `json:"items"`
+	Minimum              *float64                   `json:"minimum"`
+	Maximum              *float64                   `json:"maximum"`
+	MinLength            *int                       `json:"minLength"`
+	MaxLength            *int                       `json:"maxLength"`
+	Format               string                     `json:"format"`
+}
+
+// jsonSchemaKeywords are the keywords compileJSONSchema handles, annotations don't affect validation
+var jsonSchemaKeywords = []string{
+	"type", "enum", "properties", "required", "additionalProperties", "items",
+	"minimum", "maximum", "minLength", "maxLength", "format",
+	"$schema", "$id", "$comment", "title", "description", "default", "examples",
+}
+
+// jsonSchemaFormats are the values of format compileJSONSchema handles
+var jsonSchemaFormats = []string{"", "date-time"}
+
+func compileJSONSchema(data []byte) (*jsonSchema, error) {
+	var keywords map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keywords); err != nil {
+		return nil, fmt.Errorf("invalid JSON Schema: %v", err)
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(keywords)) {
+		if !slices.Contains(jsonSchemaKeywords, k) {
+			return nil, fmt.Errorf("unsupported JSON Schema keyword %q", k)
+		}
+	}
+
+	var doc jsonSchemaDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON Schema: %v", err)
+	}
+
+	if !slices.Contains(jsonSchemaFormats, doc.Format) {
+		return nil, fmt.Errorf("unsupported JSON Schema format %q", doc.Format)
+	}
+
+	s := &jsonSchema{
+		enum:      doc.Enum,
+		required:  doc.Required,
+		minimum:   doc.Minimum,
+		maximum:   doc.Maximum,
+		minLength: doc.MinLength,
+		maxLength: doc.MaxLength,
+		format:    doc.Format,
+	}
+
+	if len(doc.Type) > 0 {
+		if err := json.Unmarshal(doc.Type, &s.types); err != nil {
+			var t string
+			if err := json.Unmarshal(doc.Type, &t); err != nil {
+				return nil, fmt.Errorf("invalid JSON Schema type %s", doc.Type)
+			}
+			s.types = []string{t}
+		}
+	}
+
+	if len(doc.Properties) > 0 {
+		s.properties = make(map[string]*jsonSchema, len(doc.Properties))
+		for name, raw := range doc.Properties {
+			prop, err := compileJSONSchema(raw)
+			if err != nil {
+				return nil, fmt.Errorf("property %s: %w", name, err)
+			}
+			s.properties[name] = prop
+		}
+	}
+
+	switch trimmed := bytes.TrimSpace(doc.AdditionalProperties); {
+	case len(trimmed) == 0, string(trimmed) == "true":
+	case string(trimmed) == "false":
+		s.noAdditional = true
+	default:
+		additional, err := compileJSONSchema(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("additionalProperties: %w", err)
+		}
+		s.additionalProperties = additional
+	}
+
+	if len(doc.Items) > 0 {
+		items, err := compileJSONSchema(doc.Items)
+		if err != nil {
+			return nil, fmt.Errorf("items: %w", err)
+		}
+		s.items = items
+	}
+
+	return s, nil
+}
+
+func (s *jsonSchema) validate(v any, path string, errs *[]string) {
+	addErr := func(format string, args ...any) {
+		*errs = append(*errs, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if len(s.types) > 0 && !s.matchesType(v) {
+		addErr("expected %s, got %s", joinTypes(s.types), jsonType(v))
+		return
+	}
+
+	if len(s.enum) > 0 && !s.inEnum(v) {
+		addErr("must be one of %s", joinRaw(s.enum))
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for _, name := range s.required {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, path+"."+name+": is required")
+			}
+		}
+
+		for name, value := range v {
+			prop, ok := s.properties[name]
+			switch {
+			case ok:
+				prop.validate(value, path+"."+name, errs)
+			case s.noAdditional:
+				*errs = append(*errs, path+"."+name+": is not allowed")
+			case s.additionalProperties != nil:
+				s.additionalProperties.validate(value, path+"."+name, errs)
+			}
+		}
+	case []any:
+		if s.items != nil {
+			for i, item := range v {
+				s.items.validate(item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+	case json.Number:
+		f, _ := v.Float64()
+		if s.minimum != nil && f < *s.minimum {
+			addErr("must be at least %s", strconv.FormatFloat(*s.minimum, 'f', -1, 64))
+		}
+		if s.maximum != nil && f > *s.maximum {
+			addErr("must be at most %s", strconv.FormatFloat(*s.maximum, 'f', -1, 64))
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.minLength != nil && n < *s.minLength {
+			addErr("must be at least %d characters", *s.minLength)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			addErr("must be at most %d characters", *s.maxLength)
+		}
+		if s.format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				addErr("must be an RFC 3339 date-time")
+			}
+		}
+	}
+}
+
+func (s *jsonSchema) matchesType(v any) bool {
+	actual := jsonType(v)
+	for _, t := range s.types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *jsonSchema) inEnum(v any) bool {
+	actual, err := json.Marshal(v)
+	if err != nil {
+		return false
+	}
+
+	for _, allowed := range s.enum {
+		var canonical any
+		if err := unmarshalJSON(allowed, &canonical); err != nil {
+			continue
+		}
+
+		if expected, err := json.Marshal(canonical); err == nil && bytes.Equal(expected, actual) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType returns the JSON Schema type of a value decoded with numbers kept as json.Number
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if isInteger(v) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// isInteger reports whether a number has no fractional part, 1.0 is an integer in JSON Schema
+func isInteger(n json.Number) bool {
+	if _, err := n.Int64(); err == nil {
+		return true
+	}
+
+	f, err := n.Float64()
+	return err == nil && f == math.Trunc(f) && !math.IsInf(f, 0)
+}
+
+func joinTypes(types []string) string {
+	if len(types) == 1 {
+		return types[0]
+	}
+
+	var b bytes.Buffer
+	for i, t := range types {
+		if i > 0 {
+			b.WriteString(" or ")
+		}
+		b.WriteString(t)
+	}
+	return b.String()
+}
+
+func joinRaw(values []json.RawMessage) string {
+	var b bytes.Buffer
+	b.WriteByte('[')
+	for i, v := range values {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.Write(bytes.TrimSpace(v))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
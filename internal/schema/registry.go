@@ -0,0 +1,164 @@
+package schema
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Schema types as reported by a Confluent compatible schema registry, which leaves the type out for
+// Avro schemas
+const (
+	TypeAvro = "AVRO"
+	TypeJSON = "JSON"
+)
+
+var (
+	// ErrSchemaNotFound is returned when a registry has no schema for a subject and version
+	ErrSchemaNotFound = errors.New("schema not found")
+	// ErrRegistryUnavailable is returned when a registry fails to serve a schema, the lookup may
+	// succeed on a retry
+	ErrRegistryUnavailable = errors.New("schema registry unavailable")
+)
+
+// Schema is a version of the schema registered for a subject, the subject being the message type
+type Schema struct {
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+	ID      int    `json:"id"`
+	Type    string `json:"schemaType,omitempty"`
+	Schema  string `json:"schema"`
+}
+
+// Registry looks up the schema of a subject by version
+type Registry interface {
+	Schema(ctx context.Context, subject string, version int) (Schema, error)
+}
+
+//go:embed schemas
+var embedded embed.FS
+
+// LocalRegistry is an in-memory Registry, by default holding the JSON Schemas of the messages this
+// service consumes and produces
+type LocalRegistry struct {
+	mu      sync.RWMutex
+	schemas map[string][]Schema
+	nextID  int
+}
+
+// NewLocalRegistry creates a LocalRegistry with the embedded schemas registered, they are read from
+// schemas/<subject>/<version>.json
+func NewLocalRegistry() *LocalRegistry {
+	r := &LocalRegistry{schemas: make(map[string][]Schema)}
+
+	subjects, err := embedded.ReadDir("schemas")
+	if err != nil {
+		panic(err)
+	}
+
+	for _, subject := range subjects {
+		for version := 1; ; version++ {
+			data, err := fs.ReadFile(embedded, path.Join("schemas", subject.Name(), fmt.Sprintf("%d.json", version)))
+			if errors.Is(err, fs.ErrNotExist) {
+				break
+			}
+			if err != nil {
+				panic(err)
+			}
+
+			r.Register(subject.Name(), TypeJSON, string(data))
+		}
+	}
+
+	return r
+}
+
+// Register adds the next version of the schema of subject and returns it
+func (r *LocalRegistry) Register(subject, schemaType, schema string) Schema {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	s := Schema{
+		Subject: subject,
+		Version: len(r.schemas[subject]) + 1,
+		ID:      r.nextID,
+		Type:    schemaType,
+		Schema:  schema,
+	}
+	r.schemas[subject] = append(r.schemas[subject], s)
+
+	return s
+}
+
+func (r *LocalRegistry) Schema(ctx context.Context, subject string, version int) (Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions := r.schemas[subject]
+	if version < 1 || version > len(versions) {
+		return Schema{}, fmt.Errorf("%s version %d: %w", subject, version, ErrSchemaNotFound)
+	}
+
+	return versions[version-1], nil
+}
+
+// RegistryClient looks up schemas in a Confluent compatible schema registry. Credentials can be
+// passed in the URL
+type RegistryClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewRegistryClient creates a RegistryClient for the registry at baseURL
+func NewRegistryClient(baseURL string, client *http.Client) *RegistryClient {
+	return &RegistryClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  client,
+	}
+}
+
+func (c *RegistryClient) Schema(ctx context.Context, subject string, version int) (Schema, error) {
+	u := c.baseURL + "/subjects/" + url.PathEscape(subject) + "/versions/" + strconv.Itoa(version)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return Schema{}, err
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return Schema{}, fmt.Errorf("error fetching schema %s version %d: %w", subject, version, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return Schema{}, fmt.Errorf("%s version %d: %w", subject, version, ErrSchemaNotFound)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return Schema{}, fmt.Errorf("error fetching schema %s version %d, %s: %w", subject, version, resp.Status, ErrRegistryUnavailable)
+	case resp.StatusCode != http.StatusOK:
+		return Schema{}, fmt.Errorf("error fetching schema %s version %d: %s", subject, version, resp.Status)
+	}
+
+	var s Schema
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return Schema{}, fmt.Errorf("error decoding schema %s version %d: %v", subject, version, err)
+	}
+
+	if s.Type == "" {
+		s.Type = TypeAvro
+	}
+
+	return s, nil
+}
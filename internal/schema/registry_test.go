@@ -0,0 +1,51 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistryClient(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/subjects/stock_update/versions/1":
+			w.Write([]byte(`{"subject":"stock_update","version":1,"id":7,"schema":"{\"type\":\"string\"}"}`))
+		case "/subjects/flaky/versions/1":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error_code":40401,"message":"Subject not found."}`))
+		}
+	}))
+	defer srv.Close()
+
+	c := NewRegistryClient(srv.URL+"/", srv.Client())
+
+	t.Run("fetches a schema, defaulting to Avro", func(t *testing.T) {
+		s, err := c.Schema(ctx, "stock_update", 1)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		if s.ID != 7 || s.Type != TypeAvro || s.Schema != `{"type":"string"}` {
+			t.Errorf("Unexpected schema %+v", s)
+		}
+	})
+
+	t.Run("reports missing schemas", func(t *testing.T) {
+		if _, err := c.Schema(ctx, "price_update", 1); !errors.Is(err, ErrSchemaNotFound) {
+			t.Errorf("Expected ErrSchemaNotFound, got %v", err)
+		}
+	})
+
+	t.Run("reports server errors as unavailable", func(t *testing.T) {
+		if _, err := c.Schema(ctx, "flaky", 1); !errors.Is(err, ErrRegistryUnavailable) {
+			t.Errorf("Expected ErrRegistryUnavailable, got %v", err)
+		}
+	})
+}
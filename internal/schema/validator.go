@@ -0,0 +1,136 @@
+package schema
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ValidationError lists the ways a message doesn't match its schema
+type ValidationError struct {
+	Subject string
+	Version int
+	Errors  []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s version %d: %s", e.Subject, e.Version, strings.Join(e.Errors, "; "))
+}
+
+type compiledSchema interface {
+	validate(v any, path string, errs *[]string)
+}
+
+// Validator validates messages against the schemas of a Registry. Schemas are compiled the first time
+// they are used and kept, as a registered version never changes. The envelope is always validated
+// against the embedded envelope schema, it is part of the service rather than of the messages
+type Validator struct {
+	registry Registry
+	envelope compiledSchema
+
+	mu       sync.Mutex
+	compiled map[string]compiledSchema
+}
+
+// NewValidator creates a Validator looking up payload schemas in registry
+func NewValidator(registry Registry) *Validator {
+	data, err := embedded.ReadFile(fmt.Sprintf("schemas/%s/%d.json", EnvelopeSubject, EnvelopeVersion))
+	if err != nil {
+		panic(err)
+	}
+
+	envelope, err := compileJSONSchema(data)
+	if err != nil {
+		panic(err)
+	}
+
+	return &Validator{
+		registry: registry,
+		envelope: envelope,
+		compiled: make(map[string]compiledSchema),
+	}
+}
+
+// Validate checks that data is a JSON document matching version of the schema of subject. It returns
+// a ValidationError if it doesn't
+func (v *Validator) Validate(ctx context.Context, subject string, version int, data []byte) error {
+	s, err := v.schema(ctx, subject, version)
+	if err != nil {
+		return err
+	}
+
+	return validate(s, subject, version, data)
+}
+
+func validate(s compiledSchema, subject string, version int, data []byte) error {
+	var value any
+	if err := unmarshalJSON(data, &value); err != nil {
+		return &ValidationError{Subject: subject, Version: version, Errors: []string{err.Error()}}
+	}
+
+	var errs []string
+	s.validate(value, "$", &errs)
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return &ValidationError{Subject: subject, Version: version, Errors: errs}
+	}
+
+	return nil
+}
+
+func (v *Validator) schema(ctx context.Context, subject string, version int) (compiledSchema, error) {
+	key := fmt.Sprintf("%s/%d", subject, version)
+
+	v.mu.Lock()
+	s, ok := v.compiled[key]
+	v.mu.Unlock()
+	if ok {
+		return s, nil
+	}
+
+	registered, err := v.registry.Schema(ctx, subject, version)
+	if err != nil {
+		return nil, err
+	}
+
+	switch registered.Type {
+	case TypeJSON:
+		s, err = compileJSONSchema([]byte(registered.Schema))
+	case TypeAvro, "":
+		s, err = compileAvroSchema([]byte(registered.Schema))
+	default:
+		err = fmt.Errorf("unsupported schema type %q", registered.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error compiling schema %s version %d: %w", subject, version, err)
+	}
+
+	v.mu.Lock()
+	v.compiled[key] = s
+	v.mu.Unlock()
+
+	return s, nil
+}
+
+// unmarshalJSON decodes a single JSON document keeping numbers as json.Number, so integers can be
+// told apart from other numbers
+func unmarshalJSON(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("invalid JSON: unexpected data after the document")
+	}
+
+	return nil
+}
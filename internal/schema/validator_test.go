@@ -0,0 +1,204 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidator(t *testing.T) {
+	ctx := context.Background()
+	v := NewValidator(NewLocalRegistry())
+
+	t.Run("accepts a valid stock update", func(t *testing.T) {
+		err := v.Validate(ctx, "stock_update", 1, []byte(`{"product_id":1,"warehouse_id":2,"stock_delta":-7}`))
+		if err != nil {
+			t.Errorf("Expected no error, got %s", err)
+		}
+	})
+
+	tests := []struct {
+		name     string
+		data     string
+		expected string
+	}{
+		{"missing field", `{"warehouse_id":2,"stock_delta":-7}`, "$.product_id: is required"},
+		{"unknown field", `{"product_id":1,"warehouse_id":2,"stock_delta":-7,"qty":3}`, "$.qty: is not allowed"},
+		{"wrong type", `{"product_id":"1","warehouse_id":2,"stock_delta":-7}`, "$.product_id: expected integer, got string"},
+		{"fraction", `{"product_id":1,"warehouse_id":2,"stock_delta":1.5}`, "$.stock_delta: expected integer, got number"},
+		{"below minimum", `{"product_id":0,"warehouse_id":2,"stock_delta":-7}`, "$.product_id: must be at least 1"},
+		{"delta above int32", `{"product_id":1,"warehouse_id":2,"stock_delta":4294967295}`, "$.stock_delta: must be at most 2147483647"},
+		{"delta below int32", `{"product_id":1,"warehouse_id":2,"stock_delta":-2147483649}`, "$.stock_delta: must be at least -2147483648"},
+		{"not json", `not json`, "invalid JSON"},
+	}
+	for _, tt := range tests {
+		t.Run("rejects "+tt.name, func(t *testing.T) {
+			err := v.Validate(ctx, "stock_update", 1, []byte(tt.data))
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Expected a ValidationError, got %v", err)
+			}
+
+			if !strings.Contains(verr.Error(), tt.expected) {
+				t.Errorf("Expected %q in %q", tt.expected, verr.Error())
+			}
+		})
+	}
+
+	t.Run("reports unknown subjects", func(t *testing.T) {
+		err := v.Validate(ctx, "price_update", 1, []byte(`{}`))
+		if !errors.Is(err, ErrSchemaNotFound) {
+			t.Errorf("Expected ErrSchemaNotFound, got %v", err)
+		}
+	})
+}
+
+func TestAvroValidation(t *testing.T) {
+	ctx := context.Background()
+
+	registry := NewLocalRegistry()
+	registry.Register("stock_update", TypeAvro, `{
+		"type": "record",
+		"name": "StockUpdate",
+		"fields": [
+			{"name": "product_id", "type": "int"},
+			{"name": "warehouse_id", "type": "int"},
+			{"name": "stock_delta", "type": "int"},
+			{"name": "reason", "type": ["null", {"type": "enum", "name": "Reason", "symbols": ["SALE", "RETURN"]}], "default": null}
+		]
+	}`)
+	v := NewValidator(registry)
+
+	tests := []struct {
+		name     string
+		data     string
+		expected string
+	}{
+		{"valid", `{"product_id":1,"warehouse_id":2,"stock_delta":-7,"reason":"SALE"}`, ""},
+		{"default", `{"product_id":1,"warehouse_id":2,"stock_delta":-7}`, ""},
+		{"missing field", `{"product_id":1,"stock_delta":-7}`, "$.warehouse_id: is required"},
+		{"unknown field", `{"product_id":1,"warehouse_id":2,"stock_delta":-7,"qty":3}`, "$.qty: is not allowed"},
+		{"out of range", `{"product_id":1,"warehouse_id":2,"stock_delta":3000000000}`, "out of range for int"},
+		{"union", `{"product_id":1,"warehouse_id":2,"stock_delta":-7,"reason":"THEFT"}`, "$.reason: does not match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Validate(ctx, "stock_update", 2, []byte(tt.data))
+
+			if tt.expected == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %s", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected an error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+// payloadRegistry is a registry like a remote one, holding payload schemas but no envelope schema
+type payloadRegistry struct {
+	Registry
+}
+
+func (r payloadRegistry) Schema(ctx context.Context, subject string, version int) (Schema, error) {
+	if subject == EnvelopeSubject {
+		return Schema{}, ErrSchemaNotFound
+	}
+
+	return r.Registry.Schema(ctx, subject, version)
+}
+
+func TestUnsupportedSchemas(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name, schemaType, schema, expected string
+	}{
+		{"pattern", TypeJSON, `{"type":"string","pattern":"^po-"}`, `unsupported JSON Schema keyword "pattern"`},
+		{"oneOf", TypeJSON, `{"oneOf":[{"type":"string"},{"type":"integer"}]}`, `unsupported JSON Schema keyword "oneOf"`},
+		{"nested keyword", TypeJSON, `{"type":"object","properties":{"id":{"type":"string","const":"a"}}}`, `property id: unsupported JSON Schema keyword "const"`},
+		{"format", TypeJSON, `{"type":"string","format":"email"}`, `unsupported JSON Schema format "email"`},
+		{"fixed", TypeAvro, `{"type":"fixed","name":"MD5","size":16}`, `unsupported Avro type "fixed"`},
+	}
+	for _, tt := range tests {
+		t.Run("fails to compile "+tt.name, func(t *testing.T) {
+			registry := NewLocalRegistry()
+			s := registry.Register("unsupported", tt.schemaType, tt.schema)
+
+			err := NewValidator(registry).Validate(ctx, s.Subject, s.Version, []byte(`"po-1"`))
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected an error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	ctx := context.Background()
+	v := NewValidator(NewLocalRegistry())
+
+	alert := map[string]int{"product_id": 1, "warehouse_id": 2, "current_stock": 3, "threshold": 5}
+
+	t.Run("round trips a valid payload", func(t *testing.T) {
+		env, err := NewEnvelope("low_stock_alert", 1, "wms", alert)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		data, err := v.Encode(ctx, env)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		if !IsEnvelope(data) {
+			t.Fatalf("Expected %s to be an envelope", data)
+		}
+
+		decoded, err := v.Decode(ctx, data)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		if decoded.ID != env.ID || decoded.Type != "low_stock_alert" || decoded.Source != "wms" {
+			t.Errorf("Expected %+v, got %+v", env, decoded)
+		}
+	})
+
+	t.Run("rejects an invalid payload", func(t *testing.T) {
+		env, _ := NewEnvelope("low_stock_alert", 1, "wms", map[string]int{"product_id": 1})
+
+		if _, err := v.Encode(ctx, env); err == nil {
+			t.Error("Expected an error")
+		}
+	})
+
+	t.Run("rejects an incomplete envelope", func(t *testing.T) {
+		_, err := v.Decode(ctx, []byte(`{"type":"stock_update","payload":{"product_id":1,"warehouse_id":2,"stock_delta":1}}`))
+		if err == nil || !strings.Contains(err.Error(), "$.id: is required") {
+			t.Errorf("Expected the missing id to be reported, got %v", err)
+		}
+	})
+
+	t.Run("validates the envelope without the registry", func(t *testing.T) {
+		v := NewValidator(payloadRegistry{NewLocalRegistry()})
+
+		env, _ := NewEnvelope("stock_update", 1, "wms", map[string]int{"product_id": 1, "warehouse_id": 2, "stock_delta": 3})
+		data, _ := v.Encode(ctx, env)
+
+		if _, err := v.Decode(ctx, data); err != nil {
+			t.Errorf("Expected no error, got %s", err)
+		}
+	})
+
+	t.Run("bare messages are not envelopes", func(t *testing.T) {
+		if IsEnvelope([]byte(`{"product_id":1,"warehouse_id":2,"stock_delta":1}`)) {
+			t.Error("Expected a bare message not to be an envelope")
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package transport
+
+import (
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// MessageBatchHandlerFunc handles a batch of messages as a whole, it must either apply all of them or
+// none so the batch can be retried message by message
+type MessageBatchHandlerFunc func(msgs []*sarama.ConsumerMessage) error
+
+// WithBatching makes the handler collect up to size messages of a claim, or as many as arrive within
+// wait of the first one, and hand them to handler at once. All messages of a batch are marked once it
+// is handled, when it fails they are processed one by one instead so only the failing message is
+// retried or dead-lettered. Batches of fewer than 2 messages disable batching, which takes precedence
+// over workers
+func WithBatching(handler MessageBatchHandlerFunc, size int, wait time.Duration) MessageHandlerOption {
+	return func(c *MessageHandler) {
+		c.handleBatch = handler
+		c.batchSize = size
+		c.batchWait = wait
+	}
+}
+
+// consumeBatches collects the messages of a claim into batches until the claim ends. A batch that is
+// still being collected when the session is over is dropped, it is redelivered to whoever gets the
+// partition next
+func (c *MessageHandler) consumeBatches(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	batch := make([]*sarama.ConsumerMessage, 0, c.batchSize)
+
+	timer := time.NewTimer(c.batchWait)
+	timer.Stop()
+	defer timer.Stop()
+
+	flush := func() {
+		timer.Stop()
+		c.processBatch(session, batch)
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				slog.Error("message channel was closed")
+				return nil
+			}
+
+			batch = append(batch, msg)
+			if len(batch) == 1 {
+				timer.Reset(c.batchWait)
+			}
+
+			if len(batch) >= c.batchSize {
+				flush()
+			}
+		case <-timer.C:
+			flush()
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// processBatch handles a batch and marks all of its messages, falling back to processing the messages
+// one at a time when the batch fails
+func (c *MessageHandler) processBatch(session sarama.ConsumerGroupSession, batch []*sarama.ConsumerMessage) {
+	if len(batch) == 0 {
+		return
+	}
+
+	first, last := batch[0], batch[len(batch)-1]
+	start := time.Now()
+	err := c.handleBatch(batch)
+	handlerDuration.Observe(time.Since(start).Seconds(), first.Topic)
+
+	if err == nil {
+		batchesProcessed.Inc(first.Topic, "commit")
+
+		for _, msg := range batch {
+			c.saveMessage(msg)
+			c.buffer.SetOutcome(msg.Topic, msg.Partition, msg.Offset, nil)
+			messagesConsumed.Inc(msg.Topic, strconv.Itoa(int(msg.Partition)))
+		}
+
+		session.MarkMessage(last, "")
+		return
+	}
+
+	batchesProcessed.Inc(first.Topic, "fallback")
+
+	slog.Warn("error processing batch, processing msgs one by one",
+		"err", err,
+		"partition", first.Partition,
+		"first_offset", first.Offset,
+		"last_offset", last.Offset,
+	)
+
+	for _, msg := range batch {
+		if session.Context().Err() != nil {
+			return
+		}
+
+		c.processMessage(session, msg)
+	}
+}
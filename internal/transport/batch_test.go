@@ -0,0 +1,106 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+func TestConsumeBatches(t *testing.T) {
+	messages := func(n int) *fakeClaim {
+		claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, n)}
+		for i := 0; i < n; i++ {
+			claim.messages <- &sarama.ConsumerMessage{Offset: int64(i)}
+		}
+		return claim
+	}
+	ok := func(*sarama.ConsumerMessage) error { return nil }
+
+	t.Run("handles full batches and marks their last message", func(t *testing.T) {
+		var sizes []int
+		handler := NewMessageHandler(&MessageBuffer{MaxSize: 10}, ok, WithBatching(func(msgs []*sarama.ConsumerMessage) error {
+			sizes = append(sizes, len(msgs))
+			return nil
+		}, 2, time.Hour))
+
+		claim := messages(4)
+		close(claim.messages)
+
+		session := &fakeSession{}
+		if err := handler.ConsumeClaim(session, claim); err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		if len(sizes) != 2 || sizes[0] != 2 || sizes[1] != 2 {
+			t.Errorf("Expected 2 batches of 2, got %v", sizes)
+		}
+
+		if len(session.marked) != 2 || session.marked[0] != 1 || session.marked[1] != 3 {
+			t.Errorf("Expected offsets 1 and 3 to be marked, got %v", session.marked)
+		}
+
+		for _, msg := range handler.buffer.Messages() {
+			if msg.Status != MessageStatusSuccess {
+				t.Errorf("Expected message %d to be successful, got %s", msg.Offset, msg.Status)
+			}
+		}
+	})
+
+	t.Run("handles a partial batch once the wait is over", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		handled := make(chan int, 1)
+		handler := NewMessageHandler(&MessageBuffer{MaxSize: 10}, ok, WithBatching(func(msgs []*sarama.ConsumerMessage) error {
+			handled <- len(msgs)
+			return nil
+		}, 10, 10*time.Millisecond))
+
+		session := &fakeSession{ctx: ctx}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			handler.ConsumeClaim(session, messages(3))
+		}()
+
+		select {
+		case n := <-handled:
+			if n != 3 {
+				t.Errorf("Expected a batch of 3, got %d", n)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected the batch to be handled")
+		}
+
+		cancel()
+		<-done
+
+		if len(session.marked) != 1 || session.marked[0] != 2 {
+			t.Errorf("Expected offset 2 to be marked, got %v", session.marked)
+		}
+	})
+
+	t.Run("falls back to one message at a time when the batch fails", func(t *testing.T) {
+		handler := NewMessageHandler(&MessageBuffer{MaxSize: 10}, func(msg *sarama.ConsumerMessage) error {
+			if msg.Offset == 1 {
+				return errors.New("invalid message")
+			}
+			return nil
+		}, WithBatching(func([]*sarama.ConsumerMessage) error {
+			return errors.New("invalid message")
+		}, 3, time.Hour))
+
+		claim := messages(3)
+		close(claim.messages)
+
+		session := &fakeSession{}
+		handler.ConsumeClaim(session, claim)
+
+		if len(session.marked) != 2 || session.marked[0] != 0 || session.marked[1] != 2 {
+			t.Errorf("Expected offsets 0 and 2 to be marked, got %v", session.marked)
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package transport
+
+import (
+	"github.com/IBM/sarama"
+)
+
+// PartitionLag is how far a consumer group is behind the end of a partition. CommittedOffset is -1
+// when the group has not committed an offset for the partition yet, its lag is reported as 0 then
+// since the group starts from the newest offset
+type PartitionLag struct {
+	Topic           string `json:"topic"`
+	Partition       int32  `json:"partition"`
+	CommittedOffset int64  `json:"committed_offset"`
+	HighWatermark   int64  `json:"high_watermark"`
+	Lag             int64  `json:"lag"`
+}
+
+// Ping checks that the Kafka cluster is reachable by describing it
+func (kc *KafkaClient) Ping() error {
+	_, _, err := kc.Admin.DescribeCluster()
+
+	return err
+}
+
+// ConsumerLag returns the lag of a consumer group on every partition of topics
+func (kc *KafkaClient) ConsumerLag(group string, topics []string) ([]PartitionLag, error) {
+	topicPartitions := make(map[string][]int32, len(topics))
+	for _, topic := range topics {
+		partitions, err := kc.Client.Partitions(topic)
+		if err != nil {
+			return nil, err
+		}
+		topicPartitions[topic] = partitions
+	}
+
+	committed, err := kc.Admin.ListConsumerGroupOffsets(group, topicPartitions)
+	if err != nil {
+		return nil, err
+	}
+
+	var lags []PartitionLag
+	for _, topic := range topics {
+		for _, partition := range topicPartitions[topic] {
+			hwm, err := kc.Client.GetOffset(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				return nil, err
+			}
+
+			offset := int64(-1)
+			if block := committed.GetBlock(topic, partition); block != nil {
+				if block.Err != sarama.ErrNoError {
+					return nil, block.Err
+				}
+				offset = block.Offset
+			}
+
+			lags = append(lags, newPartitionLag(topic, partition, offset, hwm))
+		}
+	}
+
+	return lags, nil
+}
+
+func newPartitionLag(topic string, partition int32, committed, hwm int64) PartitionLag {
+	lag := PartitionLag{
+		Topic:           topic,
+		Partition:       partition,
+		CommittedOffset: committed,
+		HighWatermark:   hwm,
+	}
+
+	if committed >= 0 && hwm > committed {
+		lag.Lag = hwm - committed
+	}
+
+	return lag
+}
@@ -0,0 +1,34 @@
+package transport
+
+import (
+	"github.com/achere/heroku-kafka-demo-go/internal/metrics"
+	gometrics "github.com/rcrowley/go-metrics"
+)
+
+// MetricRegistry collects the metrics Sarama records for every client KafkaClient creates, each under
+// its own prefix
+var MetricRegistry = gometrics.NewRegistry()
+
+var (
+	messagesConsumed = metrics.Default.NewCounterVec(
+		"kafka_messages_consumed_total",
+		"Messages consumed by topic and partition.",
+		"topic", "partition",
+	)
+	messagesFailed = metrics.Default.NewCounterVec(
+		"kafka_messages_failed_total",
+		"Messages that could not be processed after all attempts by topic and partition.",
+		"topic", "partition",
+	)
+	batchesProcessed = metrics.Default.NewCounterVec(
+		"kafka_batches_processed_total",
+		"Message batches by topic and outcome, commit or fallback to one message at a time.",
+		"topic", "outcome",
+	)
+	handlerDuration = metrics.Default.NewHistogramVec(
+		"kafka_message_handler_duration_seconds",
+		"Latency of a single message or batch handler attempt by topic.",
+		metrics.DefaultBuckets,
+		"topic",
+	)
+)
@@ -0,0 +1,236 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/achere/heroku-kafka-demo-go/internal/config"
+)
+
+// Offset reset strategies
+const (
+	ResetEarliest  = "earliest"
+	ResetLatest    = "latest"
+	ResetTimestamp = "timestamp"
+	ResetOffset    = "offset"
+)
+
+// ErrGroupActive is returned when resetting the offsets of a consumer group that still has members
+var ErrGroupActive = errors.New("consumer group has active members")
+
+// OffsetReset describes where to move the offsets of a consumer group. Timestamp is used by the
+// timestamp strategy and Offsets by the offset strategy, partitions missing from Offsets are left as
+// they are
+type OffsetReset struct {
+	Strategy  string
+	Timestamp time.Time
+	Offsets   map[int32]int64
+}
+
+// PartitionOffsetPlan is the committed offset of a partition and the offset it is reset to.
+// CurrentOffset is -1 when the group has not committed an offset for the partition yet
+type PartitionOffsetPlan struct {
+	Partition     int32
+	CurrentOffset int64
+	TargetOffset  int64
+	OldestOffset  int64
+	HighWatermark int64
+}
+
+// CurrentLag is the number of messages the group is currently behind on the partition
+func (p PartitionOffsetPlan) CurrentLag() int64 {
+	return newPartitionLag("", p.Partition, p.CurrentOffset, p.HighWatermark).Lag
+}
+
+// TargetLag is the number of messages the group will consume from the partition after the reset
+func (p PartitionOffsetPlan) TargetLag() int64 {
+	return p.HighWatermark - p.TargetOffset
+}
+
+// NewKafkaAdminClient creates a KafkaClient that only holds a ClusterAdmin and its Client, for tools
+// that inspect or change the cluster without producing or consuming
+func NewKafkaAdminClient(ac *config.AppConfig) (*KafkaClient, error) {
+	admin, client, err := CreateKafkaClusterAdmin(ac)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KafkaClient{Admin: admin, Client: client}, nil
+}
+
+// PlanOffsetReset resolves the offsets reset moves the group's offsets on every partition of topic to
+func (kc *KafkaClient) PlanOffsetReset(group, topic string, reset OffsetReset) ([]PartitionOffsetPlan, error) {
+	partitions, err := kc.Client.Partitions(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	for p := range reset.Offsets {
+		if !slices.Contains(partitions, p) {
+			return nil, fmt.Errorf("topic %s has no partition %d", topic, p)
+		}
+	}
+
+	committed, err := kc.Admin.ListConsumerGroupOffsets(group, map[string][]int32{topic: partitions})
+	if err != nil {
+		return nil, err
+	}
+
+	plans := make([]PartitionOffsetPlan, 0, len(partitions))
+	for _, partition := range partitions {
+		plan := PartitionOffsetPlan{Partition: partition, CurrentOffset: -1}
+
+		if block := committed.GetBlock(topic, partition); block != nil {
+			if block.Err != sarama.ErrNoError {
+				return nil, block.Err
+			}
+			plan.CurrentOffset = block.Offset
+		}
+
+		if plan.OldestOffset, err = kc.Client.GetOffset(topic, partition, sarama.OffsetOldest); err != nil {
+			return nil, err
+		}
+
+		if plan.HighWatermark, err = kc.Client.GetOffset(topic, partition, sarama.OffsetNewest); err != nil {
+			return nil, err
+		}
+
+		switch reset.Strategy {
+		case ResetEarliest:
+			plan.TargetOffset = plan.OldestOffset
+		case ResetLatest:
+			plan.TargetOffset = plan.HighWatermark
+		case ResetTimestamp:
+			offset, err := kc.Client.GetOffset(topic, partition, reset.Timestamp.UnixMilli())
+			if err != nil {
+				return nil, err
+			}
+
+			// No message at or after the timestamp, there is nothing to replay
+			if offset < 0 {
+				offset = plan.HighWatermark
+			}
+			plan.TargetOffset = offset
+		case ResetOffset:
+			offset, ok := reset.Offsets[partition]
+			if !ok {
+				continue
+			}
+
+			if offset < plan.OldestOffset || offset > plan.HighWatermark {
+				return nil, fmt.Errorf(
+					"offset %d of partition %d is outside of [%d, %d]",
+					offset, partition, plan.OldestOffset, plan.HighWatermark,
+				)
+			}
+			plan.TargetOffset = offset
+		default:
+			return nil, fmt.Errorf("unknown offset reset strategy %q", reset.Strategy)
+		}
+
+		plans = append(plans, plan)
+	}
+
+	return plans, nil
+}
+
+// ResetOffsets commits the target offsets of plans for the group and reads them back, it only returns
+// without error once every target offset is committed. The group must not have active members, they
+// would overwrite the offsets with their own on the next commit.
+//
+// The offsets are committed with a request of their own rather than an offset manager, which only
+// moves an offset forward with MarkOffset or back with ResetOffset and commits nothing otherwise
+func (kc *KafkaClient) ResetOffsets(group, topic string, plans []PartitionOffsetPlan) error {
+	groups, err := kc.Admin.DescribeConsumerGroups([]string{group})
+	if err != nil {
+		return err
+	}
+
+	for _, g := range groups {
+		if g.State != "Empty" && g.State != "Dead" {
+			return fmt.Errorf("consumer group %s is %s: %w", group, g.State, ErrGroupActive)
+		}
+	}
+
+	coordinator, err := kc.Client.Coordinator(group)
+	if err != nil {
+		return err
+	}
+
+	// Version 2 is supported from Kafka 0.9 on and leaves the retention of the offsets to the broker.
+	// An undefined generation commits for a group without members
+	req := &sarama.OffsetCommitRequest{
+		Version:                 2,
+		ConsumerGroup:           group,
+		ConsumerGroupGeneration: sarama.GroupGenerationUndefined,
+		RetentionTime:           -1,
+	}
+	for _, plan := range plans {
+		req.AddBlock(topic, plan.Partition, plan.TargetOffset, 0, "")
+	}
+
+	resp, err := coordinator.CommitOffset(req)
+	if err != nil {
+		return err
+	}
+
+	for _, plan := range plans {
+		if kerr := resp.Errors[topic][plan.Partition]; kerr != sarama.ErrNoError {
+			return fmt.Errorf("error committing offset of partition %d: %w", plan.Partition, kerr)
+		}
+	}
+
+	committed, err := kc.Admin.ListConsumerGroupOffsets(group, map[string][]int32{topic: partitionsOf(plans)})
+	if err != nil {
+		return err
+	}
+
+	for _, plan := range plans {
+		block := committed.GetBlock(topic, plan.Partition)
+		if block == nil || block.Offset != plan.TargetOffset {
+			return fmt.Errorf("offset of partition %d was not committed", plan.Partition)
+		}
+	}
+
+	return nil
+}
+
+func partitionsOf(plans []PartitionOffsetPlan) []int32 {
+	partitions := make([]int32, len(plans))
+	for i, plan := range plans {
+		partitions[i] = plan.Partition
+	}
+
+	return partitions
+}
+
+// ParsePartitionOffsets parses offsets per partition in the form "0=42,1=17"
+func ParsePartitionOffsets(s string) (map[int32]int64, error) {
+	offsets := make(map[int32]int64)
+
+	for _, pair := range strings.Split(s, ",") {
+		partition, offset, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid partition offset %q, expected partition=offset", pair)
+		}
+
+		p, err := strconv.ParseInt(partition, 10, 32)
+		if err != nil || p < 0 {
+			return nil, fmt.Errorf("invalid partition %q", partition)
+		}
+
+		o, err := strconv.ParseInt(offset, 10, 64)
+		if err != nil || o < 0 {
+			return nil, fmt.Errorf("invalid offset %q", offset)
+		}
+
+		offsets[int32(p)] = o
+	}
+
+	return offsets, nil
+}
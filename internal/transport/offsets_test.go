@@ -0,0 +1,173 @@
+package transport
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	resetTestGroup = "test-group"
+	resetTestTopic = "stock-updates"
+)
+
+// newResetTestClient creates a KafkaClient against a mock broker that holds committed as the group's
+// offsets on partitions 0 and 1 of the topic, and readback as the offsets read after committing.
+// Partitions missing from committed have no offset committed. The group is in state, or doesn't exist
+// when state is empty
+func newResetTestClient(t *testing.T, state string, committed, readback map[int32]int64) (*KafkaClient, *sarama.MockBroker) {
+	broker := sarama.NewMockBroker(t, 1)
+
+	groups := sarama.NewMockDescribeGroupsResponse(t)
+	if state != "" {
+		groups.AddGroupDescription(resetTestGroup, &sarama.GroupDescription{GroupId: resetTestGroup, State: state})
+	}
+
+	before := sarama.NewMockOffsetFetchResponse(t)
+	for p, offset := range committed {
+		before.SetOffset(resetTestGroup, resetTestTopic, p, offset, "", sarama.ErrNoError)
+	}
+
+	after := sarama.NewMockOffsetFetchResponse(t)
+	for p, offset := range readback {
+		after.SetOffset(resetTestGroup, resetTestTopic, p, offset, "", sarama.ErrNoError)
+	}
+
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetController(broker.BrokerID()).
+			SetLeader(resetTestTopic, 0, broker.BrokerID()).
+			SetLeader(resetTestTopic, 1, broker.BrokerID()),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, resetTestGroup, broker),
+		"DescribeGroupsRequest": groups,
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset(resetTestTopic, 0, sarama.OffsetOldest, 0).
+			SetOffset(resetTestTopic, 0, sarama.OffsetNewest, 100).
+			SetOffset(resetTestTopic, 1, sarama.OffsetOldest, 0).
+			SetOffset(resetTestTopic, 1, sarama.OffsetNewest, 100),
+		"OffsetFetchRequest":  sarama.NewMockSequence(before, after),
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t),
+	})
+
+	cfg := sarama.NewConfig()
+	cfg.Metadata.Retry.Max = 0
+
+	client, err := sarama.NewClient([]string{broker.Addr()}, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error creating the client, got %s", err)
+	}
+
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		t.Fatalf("Expected no error creating the admin, got %s", err)
+	}
+
+	kc := &KafkaClient{Admin: admin, Client: client}
+	t.Cleanup(func() {
+		kc.Close()
+		broker.Close()
+	})
+
+	return kc, broker
+}
+
+// committedOffsets returns the offsets of the commit requests the broker received
+func committedOffsets(broker *sarama.MockBroker) map[int32]int64 {
+	offsets := make(map[int32]int64)
+
+	for _, rr := range broker.History() {
+		req, ok := rr.Request.(*sarama.OffsetCommitRequest)
+		if !ok {
+			continue
+		}
+
+		for _, p := range []int32{0, 1} {
+			if offset, _, err := req.Offset(resetTestTopic, p); err == nil {
+				offsets[p] = offset
+			}
+		}
+	}
+
+	return offsets
+}
+
+func TestResetOffsets(t *testing.T) {
+	tests := map[string]struct {
+		committed map[int32]int64
+		reset     OffsetReset
+		expected  map[int32]int64
+	}{
+		"forward": {
+			committed: map[int32]int64{0: 10, 1: 20},
+			reset:     OffsetReset{Strategy: ResetLatest},
+			expected:  map[int32]int64{0: 100, 1: 100},
+		},
+		"backward": {
+			committed: map[int32]int64{0: 50, 1: 60},
+			reset:     OffsetReset{Strategy: ResetOffset, Offsets: map[int32]int64{0: 20, 1: 30}},
+			expected:  map[int32]int64{0: 20, 1: 30},
+		},
+		"never committed": {
+			committed: map[int32]int64{},
+			reset:     OffsetReset{Strategy: ResetEarliest},
+			expected:  map[int32]int64{0: 0, 1: 0},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			kc, broker := newResetTestClient(t, "Empty", tt.committed, tt.expected)
+
+			plans, err := kc.PlanOffsetReset(resetTestGroup, resetTestTopic, tt.reset)
+			if err != nil {
+				t.Fatalf("Expected no error planning the reset, got %s", err)
+			}
+
+			for _, plan := range plans {
+				current, ok := tt.committed[plan.Partition]
+				if !ok {
+					current = -1
+				}
+
+				if plan.CurrentOffset != current || plan.TargetOffset != tt.expected[plan.Partition] {
+					t.Errorf("Expected partition %d to move from %d to %d, got %+v",
+						plan.Partition, current, tt.expected[plan.Partition], plan)
+				}
+			}
+
+			if err := kc.ResetOffsets(resetTestGroup, resetTestTopic, plans); err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+
+			offsets := committedOffsets(broker)
+			if len(offsets) != 2 || offsets[0] != tt.expected[0] || offsets[1] != tt.expected[1] {
+				t.Errorf("Expected %v to be committed, got %v", tt.expected, offsets)
+			}
+		})
+	}
+
+	t.Run("fails when the offsets read back differ", func(t *testing.T) {
+		kc, _ := newResetTestClient(t, "Empty", map[int32]int64{0: 10, 1: 20}, map[int32]int64{0: 10, 1: 20})
+
+		plans := []PartitionOffsetPlan{{Partition: 0, CurrentOffset: 10, TargetOffset: 100}}
+		if err := kc.ResetOffsets(resetTestGroup, resetTestTopic, plans); err == nil {
+			t.Error("Expected an error")
+		}
+	})
+
+	t.Run("refuses groups with active members", func(t *testing.T) {
+		kc, broker := newResetTestClient(t, "Stable", map[int32]int64{0: 10}, map[int32]int64{0: 100})
+
+		plans := []PartitionOffsetPlan{{Partition: 0, CurrentOffset: 10, TargetOffset: 100}}
+		if err := kc.ResetOffsets(resetTestGroup, resetTestTopic, plans); !errors.Is(err, ErrGroupActive) {
+			t.Errorf("Expected ErrGroupActive, got %v", err)
+		}
+
+		if offsets := committedOffsets(broker); len(offsets) != 0 {
+			t.Errorf("Expected nothing to be committed, got %v", offsets)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package transport
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/achere/heroku-kafka-demo-go/internal/config"
+)
+
+// RetryPolicy decides whether a message that failed processing is handled again and how long to
+// wait before doing so. The zero value never retries
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// IsTransient reports whether an error may go away on its own, only those errors are retried
+	IsTransient func(error) bool
+
+	random func() float64
+}
+
+// NewRetryPolicy creates a RetryPolicy from config, retrying errors isTransient accepts
+func NewRetryPolicy(rc config.RetryConfig, isTransient func(error) bool) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    rc.MaxAttempts,
+		InitialBackoff: rc.InitialBackoff,
+		MaxBackoff:     rc.MaxBackoff,
+		IsTransient:    isTransient,
+	}
+}
+
+// ShouldRetry reports whether a message that failed with err on the given attempt, counting from 1,
+// should be attempted again
+func (rp RetryPolicy) ShouldRetry(err error, attempt int) bool {
+	return attempt < rp.MaxAttempts && rp.IsTransient != nil && rp.IsTransient(err)
+}
+
+// Backoff returns how long to wait after the given failed attempt, counting from 1. The delay
+// doubles with every attempt up to MaxBackoff, with up to half of it randomised
+func (rp RetryPolicy) Backoff(attempt int) time.Duration {
+	d := rp.InitialBackoff
+	for i := 1; i < attempt && d < rp.MaxBackoff; i++ {
+		d *= 2
+	}
+
+	if rp.MaxBackoff > 0 && d > rp.MaxBackoff {
+		d = rp.MaxBackoff
+	}
+
+	random := rp.random
+	if random == nil {
+		random = rand.Float64
+	}
+
+	half := d / 2
+	return half + time.Duration(random()*float64(d-half))
+}
+
+// WithRetryPolicy makes the handler retry transient failures according to policy before giving up
+// on a message
+func WithRetryPolicy(policy RetryPolicy) MessageHandlerOption {
+	return func(c *MessageHandler) {
+		c.retryPolicy = policy
+	}
+}
+
+// handleWithRetry handles a message, retrying transient failures until the retry policy gives up or
+// ctx is done. It returns the last error along with the number of attempts made
+func (c *MessageHandler) handleWithRetry(ctx context.Context, msg *sarama.ConsumerMessage) (int, error) {
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		err := c.handleMessage(msg)
+		handlerDuration.Observe(time.Since(start).Seconds(), msg.Topic)
+
+		if err == nil || !c.retryPolicy.ShouldRetry(err, attempt) {
+			return attempt, err
+		}
+
+		backoff := c.retryPolicy.Backoff(attempt)
+		slog.Warn("transient error processing msg, retrying",
+			"err", err,
+			"partition", msg.Partition,
+			"offset", msg.Offset,
+			"attempt", attempt,
+			"backoff_ms", backoff.Milliseconds(),
+		)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return attempt, err
+		}
+	}
+}
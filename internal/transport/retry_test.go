@@ -0,0 +1,149 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+var errTransient = errors.New("connection reset")
+
+func isTestTransient(err error) bool {
+	return errors.Is(err, errTransient)
+}
+
+func TestRetryPolicy(t *testing.T) {
+	t.Run("ShouldRetry", func(t *testing.T) {
+		rp := RetryPolicy{MaxAttempts: 3, IsTransient: isTestTransient}
+
+		if !rp.ShouldRetry(errTransient, 1) {
+			t.Errorf("Expected transient error to be retried on attempt 1")
+		}
+
+		if rp.ShouldRetry(errTransient, 3) {
+			t.Errorf("Expected transient error not to be retried after max attempts")
+		}
+
+		if rp.ShouldRetry(errors.New("invalid json"), 1) {
+			t.Errorf("Expected permanent error not to be retried")
+		}
+	})
+
+	t.Run("zero value never retries", func(t *testing.T) {
+		rp := RetryPolicy{}
+
+		if rp.ShouldRetry(errTransient, 1) {
+			t.Errorf("Expected zero value policy not to retry")
+		}
+	})
+
+	t.Run("Backoff", func(t *testing.T) {
+		rp := RetryPolicy{
+			InitialBackoff: 100 * time.Millisecond,
+			MaxBackoff:     time.Second,
+			random:         func() float64 { return 1 },
+		}
+
+		expected := []time.Duration{
+			100 * time.Millisecond,
+			200 * time.Millisecond,
+			400 * time.Millisecond,
+			800 * time.Millisecond,
+			time.Second,
+			time.Second,
+		}
+		for i, want := range expected {
+			if got := rp.Backoff(i + 1); got != want {
+				t.Errorf("Expected backoff for attempt %d to be %s, got %s", i+1, want, got)
+			}
+		}
+	})
+
+	t.Run("Backoff jitter", func(t *testing.T) {
+		rp := RetryPolicy{
+			InitialBackoff: 100 * time.Millisecond,
+			MaxBackoff:     time.Second,
+			random:         func() float64 { return 0 },
+		}
+
+		if got := rp.Backoff(2); got != 100*time.Millisecond {
+			t.Errorf("Expected backoff to be at least half the delay, got %s", got)
+		}
+	})
+}
+
+func TestHandleWithRetry(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		IsTransient:    isTestTransient,
+	}
+	msg := &sarama.ConsumerMessage{Topic: "stock-updates"}
+
+	t.Run("retries transient errors until success", func(t *testing.T) {
+		calls := 0
+		handler := NewMessageHandler(&MessageBuffer{}, func(*sarama.ConsumerMessage) error {
+			calls++
+			if calls < 2 {
+				return errTransient
+			}
+			return nil
+		}, WithRetryPolicy(policy))
+
+		attempts, err := handler.handleWithRetry(context.Background(), msg)
+		if err != nil {
+			t.Errorf("Expected error to be nil, got %s", err)
+		}
+
+		if attempts != 2 {
+			t.Errorf("Expected 2 attempts, got %d", attempts)
+		}
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		handler := NewMessageHandler(&MessageBuffer{}, func(*sarama.ConsumerMessage) error {
+			return errTransient
+		}, WithRetryPolicy(policy))
+
+		attempts, err := handler.handleWithRetry(context.Background(), msg)
+		if !errors.Is(err, errTransient) {
+			t.Errorf("Expected transient error, got %v", err)
+		}
+
+		if attempts != 3 {
+			t.Errorf("Expected 3 attempts, got %d", attempts)
+		}
+	})
+
+	t.Run("does not retry permanent errors", func(t *testing.T) {
+		handler := NewMessageHandler(&MessageBuffer{}, func(*sarama.ConsumerMessage) error {
+			return errors.New("invalid json")
+		}, WithRetryPolicy(policy))
+
+		attempts, _ := handler.handleWithRetry(context.Background(), msg)
+		if attempts != 1 {
+			t.Errorf("Expected 1 attempt, got %d", attempts)
+		}
+	})
+
+	t.Run("stops retrying when context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		slow := policy
+		slow.InitialBackoff = time.Hour
+		slow.MaxBackoff = time.Hour
+		handler := NewMessageHandler(&MessageBuffer{}, func(*sarama.ConsumerMessage) error {
+			return errTransient
+		}, WithRetryPolicy(slow))
+
+		attempts, _ := handler.handleWithRetry(ctx, msg)
+		if attempts != 1 {
+			t.Errorf("Expected 1 attempt, got %d", attempts)
+		}
+	})
+}
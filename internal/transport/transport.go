@@ -6,19 +6,32 @@ import (
 	"crypto/x509"
 	"errors"
 	"log/slog"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/IBM/sarama"
 	"github.com/achere/heroku-kafka-demo-go/internal/config"
+	gometrics "github.com/rcrowley/go-metrics"
+)
+
+// Processing outcomes of a buffered message
+const (
+	MessageStatusProcessing = "processing"
+	MessageStatusSuccess    = "success"
+	MessageStatusError      = "error"
 )
 
 // Message represents a Kafka message
 type Message struct {
 	Metadata  MessageMetadata `json:"metadata"`
 	Value     string          `json:"value"`
+	Topic     string          `json:"topic"`
 	Partition int32           `json:"partition"`
 	Offset    int64           `json:"offset"`
+	Status    string          `json:"status"`
+	Error     string          `json:"error,omitempty"`
 }
 
 // MessageMetadata represents metadata about a Kafka message
@@ -40,6 +53,10 @@ func (mb *MessageBuffer) SaveMessage(msg Message) {
 	mb.ml.Lock()
 	defer mb.ml.Unlock()
 
+	if mb.MaxSize <= 0 {
+		return
+	}
+
 	if len(mb.receivedMessages) >= mb.MaxSize {
 		// Remove the oldest message
 		mb.receivedMessages = mb.receivedMessages[1:]
@@ -48,17 +65,84 @@ func (mb *MessageBuffer) SaveMessage(msg Message) {
 	mb.receivedMessages = append(mb.receivedMessages, msg)
 }
 
+// SetOutcome records the processing outcome of a buffered message, a nil err means it succeeded.
+// Messages that were already evicted from the buffer are ignored
+func (mb *MessageBuffer) SetOutcome(topic string, partition int32, offset int64, err error) {
+	mb.ml.Lock()
+	defer mb.ml.Unlock()
+
+	for i := len(mb.receivedMessages) - 1; i >= 0; i-- {
+		msg := &mb.receivedMessages[i]
+		if msg.Topic != topic || msg.Partition != partition || msg.Offset != offset {
+			continue
+		}
+
+		if err != nil {
+			msg.Status = MessageStatusError
+			msg.Error = err.Error()
+		} else {
+			msg.Status = MessageStatusSuccess
+			msg.Error = ""
+		}
+		return
+	}
+}
+
+// Messages returns a copy of the buffered messages, oldest first
+func (mb *MessageBuffer) Messages() []Message {
+	mb.ml.RLock()
+	defer mb.ml.RUnlock()
+
+	return append([]Message(nil), mb.receivedMessages...)
+}
+
 type MessageHandlerFunc func(*sarama.ConsumerMessage) error
 
+// Headers added to messages republished to the dead-letter topic
+const (
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+	HeaderError             = "x-error"
+	HeaderAttempts          = "x-attempts"
+)
+
+// MessageSender publishes messages with headers, it is satisfied by KafkaClient
+type MessageSender interface {
+	SendMessageWithHeaders(topic, key string, message []byte, headers []sarama.RecordHeader) error
+}
+
 // MessageHandler is a Sarama consumer group handler
 type MessageHandler struct {
 	Ready         chan bool
 	buffer        *MessageBuffer
 	handleMessage MessageHandlerFunc
+	dlqTopic      string
+	dlqSender     MessageSender
+	retryPolicy   RetryPolicy
+	workers       int
+	handleBatch   MessageBatchHandlerFunc
+	batchSize     int
+	batchWait     time.Duration
+
+	ready atomic.Bool
+}
+
+// MessageHandlerOption configures optional behaviour of a MessageHandler
+type MessageHandlerOption func(*MessageHandler)
+
+// WithDeadLetterTopic makes the handler republish messages it fails to process to topic and mark
+// them, so they stop blocking the partition. An empty topic disables dead-lettering
+func WithDeadLetterTopic(topic string, sender MessageSender) MessageHandlerOption {
+	return func(c *MessageHandler) {
+		c.dlqTopic = topic
+		c.dlqSender = sender
+	}
 }
 
 // Setup is run at the beginning of a new session, before ConsumeClaim
 func (c *MessageHandler) Setup(sarama.ConsumerGroupSession) error {
+	c.ready.Store(true)
 	close(c.Ready)
 
 	return nil
@@ -66,15 +150,25 @@ func (c *MessageHandler) Setup(sarama.ConsumerGroupSession) error {
 
 // Cleanup is run at the end of a session, once all ConsumeClaim goroutines have exited
 func (c *MessageHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	c.ready.Store(false)
+
 	return nil
 }
 
+// IsReady reports whether the handler is in a consumer group session, it is false until the first
+// session is set up and while the group rebalances
+func (c *MessageHandler) IsReady() bool {
+	return c.ready.Load()
+}
+
 // saveMessage saves a consumer message to the buffer
 func (c *MessageHandler) saveMessage(msg *sarama.ConsumerMessage) {
 	c.buffer.SaveMessage(Message{
+		Topic:     msg.Topic,
 		Partition: msg.Partition,
 		Offset:    msg.Offset,
 		Value:     string(msg.Value),
+		Status:    MessageStatusProcessing,
 		Metadata: MessageMetadata{
 			ReceivedAt: time.Now(),
 		},
@@ -83,6 +177,14 @@ func (c *MessageHandler) saveMessage(msg *sarama.ConsumerMessage) {
 
 // ConsumeClaim must start a consumer loop of ConsumerGroupClaim's Messages().
 func (c *MessageHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	if c.handleBatch != nil && c.batchSize > 1 {
+		return c.consumeBatches(session, claim)
+	}
+
+	if c.workers > 1 {
+		return c.consumeConcurrently(session, claim)
+	}
+
 	for {
 		select {
 		case msg, ok := <-claim.Messages():
@@ -91,30 +193,103 @@ func (c *MessageHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim
 				return nil
 			}
 
-			c.saveMessage(msg)
-			err := c.handleMessage(msg)
-			if err != nil {
-				slog.Error("error processing msg",
-					"err", err,
-					"timestamp", msg.Timestamp,
-					"val", sarama.StringEncoder(msg.Value),
-				)
-			} else {
-				session.MarkMessage(msg, "")
-			}
+			c.processMessage(session, msg)
 		case <-session.Context().Done():
 			return nil
 		}
 	}
 }
 
+// processMessage handles a single message and marks it once it is either processed or dead-lettered
+func (c *MessageHandler) processMessage(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) {
+	if c.handle(session, msg) {
+		session.MarkMessage(msg, "")
+	}
+}
+
+// handle processes a message, dead-lettering it if processing fails, and reports whether it is done
+// with the message and it can be marked
+func (c *MessageHandler) handle(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) bool {
+	c.saveMessage(msg)
+
+	partition := strconv.Itoa(int(msg.Partition))
+	messagesConsumed.Inc(msg.Topic, partition)
+
+	attempts, err := c.handleWithRetry(session.Context(), msg)
+	c.buffer.SetOutcome(msg.Topic, msg.Partition, msg.Offset, err)
+	if err == nil {
+		return true
+	}
+
+	messagesFailed.Inc(msg.Topic, partition)
+
+	slog.Error("error processing msg",
+		"err", err,
+		"timestamp", msg.Timestamp,
+		"val", sarama.StringEncoder(msg.Value),
+		"attempts", attempts,
+	)
+
+	// The claim is being revoked so the message will be redelivered, don't give up on it yet
+	if session.Context().Err() != nil {
+		return false
+	}
+
+	if c.dlqTopic == "" {
+		return false
+	}
+
+	if dlqErr := c.deadLetter(msg, err, attempts); dlqErr != nil {
+		slog.Error("error sending msg to dead-letter topic",
+			"err", dlqErr,
+			"topic", c.dlqTopic,
+			"partition", msg.Partition,
+			"offset", msg.Offset,
+		)
+		return false
+	}
+
+	slog.Info("msg sent to dead-letter topic",
+		"topic", c.dlqTopic,
+		"partition", msg.Partition,
+		"offset", msg.Offset,
+	)
+	return true
+}
+
+// deadLetter republishes a message to the dead-letter topic with headers describing the failure
+func (c *MessageHandler) deadLetter(msg *sarama.ConsumerMessage, cause error, attempts int) error {
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers)+5)
+	for _, h := range msg.Headers {
+		if h != nil {
+			headers = append(headers, *h)
+		}
+	}
+
+	headers = append(headers,
+		sarama.RecordHeader{Key: []byte(HeaderOriginalTopic), Value: []byte(msg.Topic)},
+		sarama.RecordHeader{Key: []byte(HeaderOriginalPartition), Value: []byte(strconv.Itoa(int(msg.Partition)))},
+		sarama.RecordHeader{Key: []byte(HeaderOriginalOffset), Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		sarama.RecordHeader{Key: []byte(HeaderError), Value: []byte(cause.Error())},
+		sarama.RecordHeader{Key: []byte(HeaderAttempts), Value: []byte(strconv.Itoa(attempts))},
+	)
+
+	return c.dlqSender.SendMessageWithHeaders(c.dlqTopic, string(msg.Key), msg.Value, headers)
+}
+
 // NewMessageHandler creates a new MessageHandler
-func NewMessageHandler(buffer *MessageBuffer, handler MessageHandlerFunc) *MessageHandler {
-	return &MessageHandler{
+func NewMessageHandler(buffer *MessageBuffer, handler MessageHandlerFunc, opts ...MessageHandlerOption) *MessageHandler {
+	c := &MessageHandler{
 		Ready:         make(chan bool),
 		buffer:        buffer,
 		handleMessage: handler,
 	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
 }
 
 // CreateKafkaAsyncProducer creates a new Sarama AsyncProducer
@@ -127,6 +302,7 @@ func CreateKafkaAsyncProducer(ac *config.AppConfig) (sarama.AsyncProducer, error
 	kafkaConfig.Producer.Compression = sarama.CompressionZSTD
 	kafkaConfig.Producer.Flush.Frequency = flushFrequency
 	kafkaConfig.ClientID = "heroku-kafka-demo-go/asyncproducer"
+	kafkaConfig.MetricRegistry = gometrics.NewPrefixedChildRegistry(MetricRegistry, "asyncproducer-")
 
 	if !ac.Kafka.SkipTLS {
 		tlsConfig := ac.CreateTLSConfig()
@@ -155,6 +331,7 @@ func CreateKafkaProducer(ac *config.AppConfig) (sarama.SyncProducer, error) {
 	kafkaConfig.Producer.Return.Successes = true
 	kafkaConfig.Producer.Compression = sarama.CompressionZSTD
 	kafkaConfig.ClientID = "heroku-kafka-demo-go/producer"
+	kafkaConfig.MetricRegistry = gometrics.NewPrefixedChildRegistry(MetricRegistry, "producer-")
 
 	if !ac.Kafka.SkipTLS {
 		tlsConfig := ac.CreateTLSConfig()
@@ -187,6 +364,7 @@ func CreateKafkaConsumer(ac *config.AppConfig) (sarama.ConsumerGroup, error) {
 
 	kafkaConfig.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategyRoundRobin()}
 	kafkaConfig.ClientID = "heroku-kafka-demo-go/consumer"
+	kafkaConfig.MetricRegistry = gometrics.NewPrefixedChildRegistry(MetricRegistry, "consumer-")
 	kafkaConfig.Consumer.Offsets.AutoCommit.Enable = true
 	kafkaConfig.Consumer.Offsets.AutoCommit.Interval = 1 * time.Second
 
@@ -203,11 +381,44 @@ func CreateKafkaConsumer(ac *config.AppConfig) (sarama.ConsumerGroup, error) {
 	return consumer, nil
 }
 
-// KafkaClient is a wrapper around a Sarama SyncProducer, AsyncProducer and ConsumerGroup
+// CreateKafkaClusterAdmin creates a new Sarama ClusterAdmin along with the Client it uses
+func CreateKafkaClusterAdmin(ac *config.AppConfig) (sarama.ClusterAdmin, sarama.Client, error) {
+	kafkaConfig := sarama.NewConfig()
+	kafkaConfig.ClientID = "heroku-kafka-demo-go/admin"
+	kafkaConfig.MetricRegistry = gometrics.NewPrefixedChildRegistry(MetricRegistry, "admin-")
+
+	if !ac.Kafka.SkipTLS {
+		tlsConfig := ac.CreateTLSConfig()
+		kafkaConfig.Net.TLS.Enable = true
+		kafkaConfig.Net.TLS.Config = tlsConfig
+	}
+
+	err := kafkaConfig.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := sarama.NewClient(ac.BrokerAddresses(), kafkaConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+
+	return admin, client, nil
+}
+
+// KafkaClient is a wrapper around a Sarama SyncProducer, AsyncProducer, ConsumerGroup and ClusterAdmin
 type KafkaClient struct {
 	Producer      sarama.SyncProducer
 	AsyncProducer sarama.AsyncProducer
 	Consumer      sarama.ConsumerGroup
+	Admin         sarama.ClusterAdmin
+	Client        sarama.Client
 }
 
 // NewKafkaClient creates a new KafkaClient
@@ -240,18 +451,31 @@ func NewKafkaClient(ac *config.AppConfig) (*KafkaClient, error) {
 		return nil, err
 	}
 
+	admin, client, err := CreateKafkaClusterAdmin(ac)
+	if err != nil {
+		return nil, err
+	}
+
 	return &KafkaClient{
 		AsyncProducer: asyncProducer,
 		Producer:      producer,
 		Consumer:      consumer,
+		Admin:         admin,
+		Client:        client,
 	}, nil
 }
 
 // Close closes the KafkaClient
 func (kc *KafkaClient) Close() {
-	kc.Producer.Close()
-	kc.AsyncProducer.Close()
-	kc.Consumer.Close()
+	// Admin clients only hold the admin
+	if kc.Producer != nil {
+		kc.Producer.Close()
+		kc.AsyncProducer.Close()
+		kc.Consumer.Close()
+	}
+
+	// Closing the admin closes its client as well
+	kc.Admin.Close()
 }
 
 // SendAsyncMessage sends a message to Kafka asynchronously
@@ -276,6 +500,18 @@ func (kc *KafkaClient) SendMessage(topic, key string, message []byte) error {
 	return err
 }
 
+// SendMessageWithHeaders sends a message with record headers to Kafka
+func (kc *KafkaClient) SendMessageWithHeaders(topic, key string, message []byte, headers []sarama.RecordHeader) error {
+	_, _, err := kc.Producer.SendMessage(&sarama.ProducerMessage{
+		Topic:   topic,
+		Key:     sarama.ByteEncoder(key),
+		Value:   sarama.ByteEncoder(message),
+		Headers: headers,
+	})
+
+	return err
+}
+
 // ConsumeMessages consumes messages from Kafka
 func (kc *KafkaClient) ConsumeMessages(ctx context.Context, topics []string, handler *MessageHandler) {
 	for {
@@ -1,10 +1,60 @@
 package transport
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
+
+	"github.com/IBM/sarama"
 )
 
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+	ctx    context.Context
+	marked []int64
+}
+
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.marked = append(s.marked, msg.Offset)
+}
+
+func (s *fakeSession) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+type sentMessage struct {
+	topic   string
+	key     string
+	value   []byte
+	headers []sarama.RecordHeader
+}
+
+type fakeSender struct {
+	sent []sentMessage
+	err  error
+}
+
+func (f *fakeSender) SendMessageWithHeaders(topic, key string, message []byte, headers []sarama.RecordHeader) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.sent = append(f.sent, sentMessage{topic: topic, key: key, value: message, headers: headers})
+	return nil
+}
+
+func headerValue(headers []sarama.RecordHeader, key string) string {
+	for _, h := range headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
 func TestMessageBuffer(t *testing.T) {
 	t.Run("SaveMessage", func(t *testing.T) {
 		mb := MessageBuffer{
@@ -57,6 +107,38 @@ func TestMessageBuffer(t *testing.T) {
 			t.Errorf("Expected message value to be 'test', got %s", mb.receivedMessages[0].Value)
 		}
 	})
+
+	t.Run("SetOutcome", func(t *testing.T) {
+		mb := MessageBuffer{
+			MaxSize: 10,
+		}
+
+		mb.SaveMessage(Message{Topic: "stock-updates", Partition: 0, Offset: 1, Status: MessageStatusProcessing})
+		mb.SaveMessage(Message{Topic: "stock-updates", Partition: 1, Offset: 1, Status: MessageStatusProcessing})
+
+		mb.SetOutcome("stock-updates", 0, 1, nil)
+		mb.SetOutcome("stock-updates", 1, 1, errors.New("invalid message"))
+
+		messages := mb.Messages()
+
+		if messages[0].Status != MessageStatusSuccess {
+			t.Errorf("Expected status %s, got %s", MessageStatusSuccess, messages[0].Status)
+		}
+
+		if messages[1].Status != MessageStatusError || messages[1].Error != "invalid message" {
+			t.Errorf("Expected status %s with error, got %s %q", MessageStatusError, messages[1].Status, messages[1].Error)
+		}
+	})
+
+	t.Run("SaveMessage with zero MaxSize", func(t *testing.T) {
+		mb := MessageBuffer{}
+
+		mb.SaveMessage(Message{Value: "test"})
+
+		if len(mb.Messages()) != 0 {
+			t.Errorf("Expected no messages, got %d", len(mb.Messages()))
+		}
+	})
 }
 
 func TestMessageHandler(t *testing.T) {
@@ -72,6 +154,10 @@ func TestMessageHandler(t *testing.T) {
 		}
 
 		<-handler.Ready
+
+		if !handler.IsReady() {
+			t.Errorf("Expected handler to be ready")
+		}
 	})
 
 	t.Run("Cleanup", func(t *testing.T) {
@@ -84,5 +170,162 @@ func TestMessageHandler(t *testing.T) {
 		if err != nil {
 			t.Errorf("Expected error to be nil, got %s", err)
 		}
+
+		if handler.IsReady() {
+			t.Errorf("Expected handler not to be ready after cleanup")
+		}
+	})
+}
+
+func TestProcessMessage(t *testing.T) {
+	msg := &sarama.ConsumerMessage{
+		Topic:     "stock-updates",
+		Partition: 3,
+		Offset:    42,
+		Key:       []byte("1:1"),
+		Value:     []byte("not json"),
+	}
+	failing := func(*sarama.ConsumerMessage) error { return errors.New("boom") }
+
+	t.Run("marks processed message", func(t *testing.T) {
+		session := &fakeSession{}
+		handler := NewMessageHandler(&MessageBuffer{MaxSize: 1}, func(*sarama.ConsumerMessage) error { return nil })
+
+		handler.processMessage(session, msg)
+
+		if len(session.marked) != 1 {
+			t.Errorf("Expected message to be marked, got %d marks", len(session.marked))
+		}
 	})
+
+	t.Run("does not mark failed message without dead-letter topic", func(t *testing.T) {
+		session := &fakeSession{}
+		handler := NewMessageHandler(&MessageBuffer{MaxSize: 1}, failing)
+
+		handler.processMessage(session, msg)
+
+		if len(session.marked) != 0 {
+			t.Errorf("Expected message not to be marked, got %d marks", len(session.marked))
+		}
+	})
+
+	t.Run("dead-letters and marks failed message", func(t *testing.T) {
+		session := &fakeSession{}
+		sender := &fakeSender{}
+		handler := NewMessageHandler(&MessageBuffer{MaxSize: 1}, failing, WithDeadLetterTopic("dlq", sender))
+
+		handler.processMessage(session, msg)
+
+		if len(session.marked) != 1 {
+			t.Errorf("Expected message to be marked, got %d marks", len(session.marked))
+		}
+
+		if len(sender.sent) != 1 {
+			t.Fatalf("Expected 1 dead-lettered message, got %d", len(sender.sent))
+		}
+
+		sent := sender.sent[0]
+		if sent.topic != "dlq" || sent.key != "1:1" || string(sent.value) != "not json" {
+			t.Errorf("Unexpected dead-lettered message %+v", sent)
+		}
+
+		expected := map[string]string{
+			HeaderOriginalTopic:     "stock-updates",
+			HeaderOriginalPartition: "3",
+			HeaderOriginalOffset:    "42",
+			HeaderError:             "boom",
+			HeaderAttempts:          "1",
+		}
+		for k, v := range expected {
+			if got := headerValue(sent.headers, k); got != v {
+				t.Errorf("Expected header %s to be %s, got %s", k, v, got)
+			}
+		}
+	})
+
+	t.Run("does not mark message when dead-lettering fails", func(t *testing.T) {
+		session := &fakeSession{}
+		sender := &fakeSender{err: errors.New("broker down")}
+		handler := NewMessageHandler(&MessageBuffer{MaxSize: 1}, failing, WithDeadLetterTopic("dlq", sender))
+
+		handler.processMessage(session, msg)
+
+		if len(session.marked) != 0 {
+			t.Errorf("Expected message not to be marked, got %d marks", len(session.marked))
+		}
+	})
+}
+
+func TestConsumeClaim(t *testing.T) {
+	t.Run("finishes and marks the message being handled when consuming stops", func(t *testing.T) {
+		// the session context is cancelled by stopConsuming, the handler keeps its own context
+		ctx, stopConsuming := context.WithCancel(context.Background())
+		started, finish := make(chan struct{}), make(chan struct{})
+
+		handler := NewMessageHandler(&MessageBuffer{MaxSize: 1}, func(*sarama.ConsumerMessage) error {
+			close(started)
+			<-finish
+			return nil
+		})
+
+		claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 1)}
+		claim.messages <- &sarama.ConsumerMessage{Topic: "stock-updates", Offset: 42}
+
+		session := &fakeSession{ctx: ctx}
+		done := make(chan error)
+		go func() {
+			done <- handler.ConsumeClaim(session, claim)
+		}()
+
+		<-started
+		stopConsuming()
+		close(finish)
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected ConsumeClaim to return once the message was handled")
+		}
+
+		if len(session.marked) != 1 || session.marked[0] != 42 {
+			t.Errorf("Expected offset 42 to be marked, got %v", session.marked)
+		}
+	})
+}
+
+func TestParsePartitionOffsets(t *testing.T) {
+	offsets, err := ParsePartitionOffsets("0=42, 1=17")
+	if err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if len(offsets) != 2 || offsets[0] != 42 || offsets[1] != 17 {
+		t.Errorf("Expected map[0:42 1:17], got %v", offsets)
+	}
+
+	for _, s := range []string{"", "0", "a=1", "0=-1", "-1=3"} {
+		if _, err := ParsePartitionOffsets(s); err == nil {
+			t.Errorf("Expected error parsing %q", s)
+		}
+	}
+}
+
+func TestPartitionOffsetPlanLag(t *testing.T) {
+	plan := PartitionOffsetPlan{Partition: 0, CurrentOffset: 90, TargetOffset: 40, HighWatermark: 100}
+
+	if plan.CurrentLag() != 10 {
+		t.Errorf("Expected current lag 10, got %d", plan.CurrentLag())
+	}
+
+	if plan.TargetLag() != 60 {
+		t.Errorf("Expected target lag 60, got %d", plan.TargetLag())
+	}
+
+	plan.CurrentOffset = -1
+	if plan.CurrentLag() != 0 {
+		t.Errorf("Expected current lag 0 without a committed offset, got %d", plan.CurrentLag())
+	}
 }
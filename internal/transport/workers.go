@@ -0,0 +1,139 @@
+package transport
+
+import (
+	"hash/fnv"
+	"log/slog"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// workerQueueSize is the number of messages queued per worker before the claim stops dispatching
+const workerQueueSize = 16
+
+// WithWorkers makes the handler process the messages of a claim with n workers. Messages with the
+// same key always go to the same worker so their order is kept, messages with different keys are
+// processed concurrently. Messages without a key are all handled by one worker in offset order, so
+// only keyed messages benefit from more workers. Fewer than 2 workers process messages one at a time
+func WithWorkers(n int) MessageHandlerOption {
+	return func(c *MessageHandler) {
+		c.workers = n
+	}
+}
+
+// consumeConcurrently dispatches the messages of a claim to workers by key until the claim ends, then
+// waits for the workers to finish the message they are handling. Messages still queued once the
+// session is over are dropped, they are redelivered to whoever gets the partition next
+func (c *MessageHandler) consumeConcurrently(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	tracker := newOffsetTracker(session)
+
+	queues := make([]chan *sarama.ConsumerMessage, c.workers)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan *sarama.ConsumerMessage, workerQueueSize)
+
+		wg.Add(1)
+		go func(queue <-chan *sarama.ConsumerMessage) {
+			defer wg.Done()
+
+			for msg := range queue {
+				if session.Context().Err() != nil {
+					continue
+				}
+
+				// A message given up on because the claim is being revoked holds back the messages after
+				// it so it is redelivered, the ones before it are still marked
+				if c.handle(session, msg) || session.Context().Err() == nil {
+					tracker.done(msg)
+				}
+			}
+		}(queues[i])
+	}
+
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+		wg.Wait()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				slog.Error("message channel was closed")
+				return nil
+			}
+
+			tracker.add(msg)
+
+			select {
+			case queues[workerFor(msg.Key, len(queues))] <- msg:
+			case <-session.Context().Done():
+				return nil
+			}
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// workerFor picks the worker for a message key. Messages without a key all go to the first one rather
+// than being spread, since producers that don't key their messages may still rely on their order
+func workerFor(key []byte, workers int) int {
+	if len(key) == 0 {
+		return 0
+	}
+
+	h := fnv.New32a()
+	h.Write(key)
+
+	return int(h.Sum32() % uint32(workers))
+}
+
+// offsetTracker marks messages of a partition that are processed out of order, only ever marking a
+// message once all messages before it are done as well
+type offsetTracker struct {
+	session sarama.ConsumerGroupSession
+
+	mu       sync.Mutex
+	pending  []*sarama.ConsumerMessage
+	finished map[int64]bool
+}
+
+func newOffsetTracker(session sarama.ConsumerGroupSession) *offsetTracker {
+	return &offsetTracker{
+		session:  session,
+		finished: make(map[int64]bool),
+	}
+}
+
+// add records a message that is about to be processed, messages must be added in offset order
+func (t *offsetTracker) add(msg *sarama.ConsumerMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pending = append(t.pending, msg)
+}
+
+// done records that a message was processed and marks the last message of the processed prefix of
+// the partition. Marking goes on after the session is over, until the claim is released, so messages
+// finished while the partition is revoked are committed. Like with a single worker, messages that
+// failed without being dead-lettered don't hold back the messages after them
+func (t *offsetTracker) done(msg *sarama.ConsumerMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.finished[msg.Offset] = true
+
+	var last *sarama.ConsumerMessage
+	for len(t.pending) > 0 && t.finished[t.pending[0].Offset] {
+		last = t.pending[0]
+		delete(t.finished, last.Offset)
+		t.pending = t.pending[1:]
+	}
+
+	if last != nil {
+		t.session.MarkMessage(last, "")
+	}
+}
@@ -0,0 +1,163 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+type fakeClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
+
+func TestWorkerFor(t *testing.T) {
+	t.Run("same key goes to the same worker", func(t *testing.T) {
+		first := workerFor([]byte("1:1"), 4)
+		for i := 0; i < 10; i++ {
+			if got := workerFor([]byte("1:1"), 4); got != first {
+				t.Errorf("Expected worker %d, got %d", first, got)
+			}
+		}
+	})
+
+	t.Run("messages without a key go to the first worker", func(t *testing.T) {
+		if got := workerFor(nil, 4); got != 0 {
+			t.Errorf("Expected worker 0, got %d", got)
+		}
+	})
+
+	t.Run("keys are spread over the workers", func(t *testing.T) {
+		used := make(map[int]bool)
+		for wh := 1; wh <= 20; wh++ {
+			used[workerFor([]byte(fmt.Sprintf("%d:1", wh)), 4)] = true
+		}
+
+		if len(used) != 4 {
+			t.Errorf("Expected all 4 workers to be used, got %d", len(used))
+		}
+	})
+}
+
+func TestOffsetTracker(t *testing.T) {
+	msgs := make([]*sarama.ConsumerMessage, 4)
+	for i := range msgs {
+		msgs[i] = &sarama.ConsumerMessage{Offset: int64(10 + i)}
+	}
+
+	t.Run("only marks once earlier messages are done", func(t *testing.T) {
+		session := &fakeSession{}
+		tracker := newOffsetTracker(session)
+		for _, msg := range msgs {
+			tracker.add(msg)
+		}
+
+		tracker.done(msgs[1])
+		tracker.done(msgs[3])
+
+		if len(session.marked) != 0 {
+			t.Fatalf("Expected nothing to be marked, got %v", session.marked)
+		}
+
+		tracker.done(msgs[0])
+
+		if len(session.marked) != 1 || session.marked[0] != 11 {
+			t.Fatalf("Expected offset 11 to be marked, got %v", session.marked)
+		}
+
+		tracker.done(msgs[2])
+
+		if len(session.marked) != 2 || session.marked[1] != 13 {
+			t.Errorf("Expected offset 13 to be marked, got %v", session.marked)
+		}
+	})
+	t.Run("keeps marking once the session is over", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		session := &fakeSession{ctx: ctx}
+		tracker := newOffsetTracker(session)
+		tracker.add(msgs[0])
+		tracker.done(msgs[0])
+
+		if len(session.marked) != 1 || session.marked[0] != 10 {
+			t.Errorf("Expected offset 10 to be marked, got %v", session.marked)
+		}
+	})
+}
+
+func TestConsumeConcurrently(t *testing.T) {
+	t.Run("keeps the order of messages with the same key and marks them all", func(t *testing.T) {
+		var mu sync.Mutex
+		seen := make(map[string][]int64)
+		handler := NewMessageHandler(&MessageBuffer{MaxSize: 1}, func(msg *sarama.ConsumerMessage) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			seen[string(msg.Key)] = append(seen[string(msg.Key)], msg.Offset)
+			return nil
+		}, WithWorkers(4))
+
+		claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 100)}
+		for i := 0; i < 100; i++ {
+			claim.messages <- &sarama.ConsumerMessage{
+				Offset: int64(i),
+				Key:    []byte(fmt.Sprintf("%d:1", i%7)),
+			}
+		}
+		close(claim.messages)
+
+		session := &fakeSession{}
+		if err := handler.ConsumeClaim(session, claim); err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		for key, offsets := range seen {
+			for i := 1; i < len(offsets); i++ {
+				if offsets[i] < offsets[i-1] {
+					t.Errorf("Expected messages of %s in order, got %v", key, offsets)
+					break
+				}
+			}
+		}
+
+		if n := len(session.marked); n == 0 || session.marked[n-1] != 99 {
+			t.Errorf("Expected offset 99 to be marked last, got %v", session.marked)
+		}
+	})
+
+	t.Run("marks messages finished after the session is over", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		started := make(chan struct{})
+
+		handler := NewMessageHandler(&MessageBuffer{MaxSize: 1}, func(msg *sarama.ConsumerMessage) error {
+			close(started)
+			<-ctx.Done()
+			return nil
+		}, WithWorkers(2))
+
+		claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 1)}
+		claim.messages <- &sarama.ConsumerMessage{Offset: 0, Key: []byte("1:1")}
+
+		session := &fakeSession{ctx: ctx}
+		go func() {
+			<-started
+			cancel()
+		}()
+
+		if err := handler.ConsumeClaim(session, claim); err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		if len(session.marked) != 1 || session.marked[0] != 0 {
+			t.Errorf("Expected offset 0 to be marked, got %v", session.marked)
+		}
+	})
+}
@@ -3,35 +3,79 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/IBM/sarama"
 	sqlc "github.com/achere/heroku-kafka-demo-go/db/sqlc"
 	"github.com/achere/heroku-kafka-demo-go/internal/api"
+	"github.com/achere/heroku-kafka-demo-go/internal/codec"
 	"github.com/achere/heroku-kafka-demo-go/internal/config"
+	"github.com/achere/heroku-kafka-demo-go/internal/health"
 	"github.com/achere/heroku-kafka-demo-go/internal/inventory"
+	"github.com/achere/heroku-kafka-demo-go/internal/ledger"
+	"github.com/achere/heroku-kafka-demo-go/internal/metrics"
+	"github.com/achere/heroku-kafka-demo-go/internal/outbox"
+	"github.com/achere/heroku-kafka-demo-go/internal/reconcile"
+	"github.com/achere/heroku-kafka-demo-go/internal/schema"
 	"github.com/achere/heroku-kafka-demo-go/internal/transport"
+	"github.com/hashicorp/go-uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 )
 
-const (
-	// MaxBufferSize is the maximum number of messages to keep in the buffer
-	MaxBufferSize = 10
-)
+// commands are the subcommands run instead of the service when given as the first argument
+var commands = map[string]func(args []string) error{
+	"reset-offsets": runResetOffsets,
+	"reconcile":     runReconcile,
+}
+
+// cacheInvalidationChannel is the Redis pub/sub channel instances tell each other to drop local cache
+// entries on
+const cacheInvalidationChannel = "inventory-cache-invalidations"
+
+// schemaRegistryTimeout bounds a schema lookup, schemas are only fetched the first time they are used
+const schemaRegistryTimeout = 5 * time.Second
+
+// invalidatingCache is an inventory cache that can be invalidated by product or warehouse
+type invalidatingCache interface {
+	inventory.Cache
+	Invalidate(ctx context.Context, productID, warehouseID int) (int, error)
+}
 
 func main() {
 	if os.Getenv("KAFKA_DEBUG") != "" {
 		sarama.Logger = log.New(os.Stdout, "[sarama] ", log.LstdFlags)
 	}
 
+	if len(os.Args) > 1 {
+		run, ok := commands[os.Args[1]]
+		if !ok {
+			log.Fatalf("unknown command %q", os.Args[1])
+		}
+
+		if err := run(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// ctx outlives the consumer so messages being handled when a signal arrives can finish their
+	// transactions, it is only cancelled once the consumer is drained or the shutdown deadline passes
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	appconfig, err := config.NewAppConfig()
 	if err != nil {
@@ -40,6 +84,7 @@ func main() {
 			"at", "main",
 			"err", err,
 		)
+		os.Exit(1)
 	}
 
 	port := appconfig.Web.Port
@@ -60,21 +105,12 @@ func main() {
 	} else {
 		slog.Info("db connected")
 	}
-	defer db.Close()
 
-	redisUrl := appconfig.RedisURL
-	opts, err := redis.ParseURL(redisUrl)
-	if strings.HasPrefix(redisUrl, "rediss") {
-		opts.TLSConfig = &tls.Config{
-			InsecureSkipVerify: true,
-		}
-	}
+	rdb, err := newRedisClient(appconfig.RedisURL)
 	if err != nil {
 		slog.Error("error parsing Redis URL", "at", "main", "err", err)
 	}
 
-	rdb := redis.NewClient(opts)
-
 	_, err = rdb.Ping(ctx).Result()
 	if err != nil {
 		slog.Error("could not connect to Redis", "err", err)
@@ -87,53 +123,303 @@ func main() {
 		log.Fatal(err)
 	}
 
+	redisCache := inventory.NewRedisCache(rdb, appconfig.Cache.TTL)
+
+	var cache invalidatingCache = redisCache
+	var localCache *inventory.LRUCache
+	var bus *inventory.RedisInvalidationBus
+	if appconfig.Cache.LocalSize > 0 {
+		instanceID, err := uuid.GenerateUUID()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		bus = inventory.NewRedisInvalidationBus(rdb, cacheInvalidationChannel, instanceID)
+		localCache = inventory.NewLRUCache(redisCache, bus, appconfig.Cache.LocalSize, appconfig.Cache.LocalTTL)
+		cache = localCache
+	}
+
+	schemas := schema.NewValidator(newSchemaRegistry(appconfig.Schema.RegistryURL))
+	codecs, err := codec.NewRegistry(appconfig.Schema.MessageFormat, codec.JSON{}, codec.NewProtobuf())
+	if err != nil {
+		log.Fatal(err)
+	}
+	alertCodec, err := codecs.Lookup(appconfig.Schema.AlertFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+	alerts := inventory.NewAlertProducer(appconfig.ProducerTopic(), appconfig.Schema.Source, schemas)
+
 	topic := appconfig.Topic()
 	buffer := transport.MessageBuffer{
-		MaxSize: MaxBufferSize,
+		MaxSize: appconfig.Admin.MessageBufferSize,
 	}
-	consumerHandler := transport.NewMessageHandler(&buffer, newStockUpdateHandler(
-		ctx,
-		appconfig,
-		client,
-		db,
-		inventory.NewRedisCache(rdb),
-	))
+	consumerHandler := transport.NewMessageHandler(
+		&buffer,
+		newStockUpdateHandler(
+			ctx,
+			appconfig,
+			db,
+			cache,
+			schemas,
+			codecs,
+			alerts,
+		),
+		transport.WithDeadLetterTopic(appconfig.DLQTopic(), client),
+		transport.WithRetryPolicy(transport.NewRetryPolicy(appconfig.Retry, isTransientError)),
+		transport.WithWorkers(appconfig.Kafka.Workers),
+		transport.WithBatching(
+			newStockUpdateBatchHandler(ctx, appconfig, db, cache, schemas, codecs, alerts),
+			appconfig.Kafka.BatchSize,
+			appconfig.Kafka.BatchWait,
+		),
+	)
 
-	go client.ConsumeMessages(ctx, []string{topic}, consumerHandler)
+	// The handler replaces Ready when it rejoins the group, keep the first one for the startup log
+	consumerReady := consumerHandler.Ready
 
-	slog.Info(
-		"waiting for consumer to be ready",
-		"at", "main",
-		"topic", topic,
-	)
+	consumeCtx, stopConsuming := context.WithCancel(ctx)
+	consumerDone := make(chan struct{})
+	go func() {
+		defer close(consumerDone)
+		client.ConsumeMessages(consumeCtx, []string{topic}, consumerHandler)
+	}()
 
-	start := time.Now()
+	var workers sync.WaitGroup
 
-	<-consumerHandler.Ready
+	relay := outbox.NewRelay(db, client, alertCodec, appconfig.Outbox.PollInterval, appconfig.Outbox.BatchSize)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		relay.Run(ctx)
+	}()
 
-	slog.Info(
-		"consumer is ready",
-		"at", "main",
-		"topic", topic,
-		"duration_ms", time.Since(start).Milliseconds(),
+	if appconfig.Outbox.Retention > 0 {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			outbox.PruneEvery(ctx, sqlc.New(db), appconfig.Outbox.Retention, appconfig.Outbox.PruneInterval)
+		}()
+	}
+
+	if appconfig.Ledger.Retention > 0 {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			ledger.PruneEvery(ctx, sqlc.New(db), appconfig.Ledger.Retention, appconfig.Ledger.PruneInterval)
+		}()
+	}
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		inventory.SweepExpiredReservations(ctx, sqlc.New(db), appconfig.Reservation.SweepInterval)
+	}()
+
+	if appconfig.Reconcile.Interval > 0 {
+		reconciler := reconcile.NewReconciler(db, cache)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			reconciler.RunEvery(ctx, appconfig.Reconcile.Interval, appconfig.Reconcile.Repair)
+		}()
+	}
+
+	if localCache != nil {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			bus.Subscribe(ctx, localCache.Evict)
+		}()
+	}
+
+	warmer := inventory.NewCacheWarmer(
+		sqlc.New(db), redisCache, appconfig.Cache.WarmupBatchSize, appconfig.Cache.WarmupConcurrency,
 	)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		warmer.Serve(ctx)
+	}()
 
-	inventoryHandler := api.NewInventoryHandler(sqlc.New(db), rdb)
+	if appconfig.Cache.WarmupOnStart {
+		warmer.Trigger()
+	}
+
+	checker := health.NewChecker(
+		appconfig.Web.HealthCheckTimeout,
+		health.Ping("postgres", db.Ping),
+		health.Ping("redis", func(ctx context.Context) error {
+			return rdb.Ping(ctx).Err()
+		}),
+		health.Ping("kafka", func(context.Context) error {
+			return client.Ping()
+		}),
+		health.Ping("consumer", func(context.Context) error {
+			if !consumerHandler.IsReady() {
+				return errors.New("consumer group session is not set up")
+			}
+			return nil
+		}),
+		health.Check{
+			Name:     "cache_warmup",
+			Required: appconfig.Cache.WarmupOnStart && appconfig.Cache.WarmupHoldReadiness,
+			Run: func(context.Context) (any, error) {
+				return warmer.Status(), warmer.Ready()
+			},
+		},
+		health.Check{
+			Name: "consumer_lag",
+			Run: func(context.Context) (any, error) {
+				return client.ConsumerLag(appconfig.Group(), []string{topic})
+			},
+		},
+	)
+	metrics.Default.Register(metrics.NewPoolCollector(db.Stat))
+	metrics.Default.Register(metrics.NewGoMetricsCollector("sarama", transport.MetricRegistry))
+	http.Handle("GET /metrics", metrics.Default)
+
+	http.HandleFunc("GET /healthz", checker.HandleHealthz)
+	http.HandleFunc("GET /readyz", checker.HandleReadyz)
+
+	inventoryHandler := api.NewInventoryHandler(db, cache, alerts)
 	http.HandleFunc("GET /inventory", inventoryHandler.HandleGetInventory)
+	http.HandleFunc("GET /inventory/history", inventoryHandler.HandleGetHistory)
+	http.HandleFunc("POST /inventory", inventoryHandler.HandlePostInventory)
+	http.HandleFunc("POST /inventory/adjustments", inventoryHandler.HandlePostAdjustments)
+	http.HandleFunc("PUT /inventory/threshold", inventoryHandler.HandlePutThreshold)
+
+	reservationHandler := api.NewReservationHandler(
+		db,
+		cache,
+		alerts,
+		appconfig.Reservation.DefaultTTL,
+		appconfig.Reservation.MaxTTL,
+	)
+	http.HandleFunc("GET /inventory/available", reservationHandler.HandleGetAvailability)
+	http.HandleFunc("POST /reservations", reservationHandler.HandlePostReservation)
+	http.HandleFunc("POST /reservations/{id}/confirm", reservationHandler.HandleConfirmReservation)
+	http.HandleFunc("POST /reservations/{id}/release", reservationHandler.HandleReleaseReservation)
+
+	transferHandler := api.NewTransferHandler(db, cache, alerts)
+	http.HandleFunc("POST /transfers", transferHandler.HandlePostTransfer)
+	http.HandleFunc("GET /transfers/{id}", transferHandler.HandleGetTransfer)
+	http.HandleFunc("POST /transfers/{id}/receive", transferHandler.HandleReceiveTransfer)
+
+	if appconfig.Admin.Token == "" {
+		slog.Warn("ADMIN_TOKEN is not set, the admin endpoints are disabled", "at", "main")
+	}
+
+	adminHandler := api.NewAdminHandler(&buffer, cache, warmer)
+	http.HandleFunc("GET /admin/messages", api.RequireToken(appconfig.Admin.Token, adminHandler.HandleGetMessages))
+	http.HandleFunc("DELETE /admin/cache", api.RequireToken(appconfig.Admin.Token, adminHandler.HandleDeleteCache))
+	http.HandleFunc("POST /admin/cache/warmup", api.RequireToken(appconfig.Admin.Token, adminHandler.HandlePostCacheWarmup))
+	http.HandleFunc("GET /admin/cache/warmup", api.RequireToken(appconfig.Admin.Token, adminHandler.HandleGetCacheWarmup))
+
+	catalogHandler := api.NewCatalogHandler(sqlc.New(db))
+	http.HandleFunc("GET /products", catalogHandler.HandleGetProducts)
+	http.HandleFunc("POST /products", catalogHandler.HandlePostProduct)
+	http.HandleFunc("PUT /products/{id}", catalogHandler.HandlePutProduct)
+	http.HandleFunc("DELETE /products/{id}", catalogHandler.HandleDeleteProduct)
+	http.HandleFunc("GET /warehouses", catalogHandler.HandleGetWarehouses)
+	http.HandleFunc("POST /warehouses", catalogHandler.HandlePostWarehouse)
+	http.HandleFunc("PUT /warehouses/{id}", catalogHandler.HandlePutWarehouse)
+	http.HandleFunc("DELETE /warehouses/{id}", catalogHandler.HandleDeleteWarehouse)
 
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%s", port),
-		Handler:      nil,
+		Handler:      metrics.InstrumentHandler(metrics.Default, http.DefaultServeMux),
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  15 * time.Second,
 	}
 
-	slog.Info("starting server", "at", "main", "port", port)
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatal(err)
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("starting server", "at", "main", "port", port)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	go func() {
+		slog.Info(
+			"waiting for consumer to be ready",
+			"at", "main",
+			"topic", topic,
+		)
+
+		start := time.Now()
+
+		select {
+		case <-consumerReady:
+			slog.Info(
+				"consumer is ready",
+				"at", "main",
+				"topic", topic,
+				"duration_ms", time.Since(start).Milliseconds(),
+			)
+		case <-sigCtx.Done():
+		}
+	}()
+
+	select {
+	case err := <-serverErr:
+		slog.Error("server stopped", "at", "main", "err", err)
+	case <-sigCtx.Done():
+		slog.Info("shutdown signal received", "at", "main")
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), appconfig.Web.ShutdownTimeout)
+	defer cancelShutdown()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("error shutting down server", "at", "main", "err", err)
+	}
+
+	// Stop fetching new messages and wait for the message being handled to finish, the session flushes
+	// marked offsets when it is released
+	stopConsuming()
+	select {
+	case <-consumerDone:
+		slog.Info("consumer drained", "at", "main")
+	case <-shutdownCtx.Done():
+		slog.Error("timed out draining consumer", "at", "main", "timeout", appconfig.Web.ShutdownTimeout)
 	}
 
-	client.Close()
 	cancel()
+	workers.Wait()
+
+	client.Close()
+	db.Close()
+	if err := rdb.Close(); err != nil {
+		slog.Error("error closing Redis client", "at", "main", "err", err)
+	}
+
+	slog.Info("shutdown complete", "at", "main")
+}
+
+// newSchemaRegistry returns a client for the schema registry at registryURL, or a registry of the
+// embedded schemas when no URL is set
+func newSchemaRegistry(registryURL string) schema.Registry {
+	if registryURL == "" {
+		return schema.NewLocalRegistry()
+	}
+
+	return schema.NewRegistryClient(registryURL, &http.Client{Timeout: schemaRegistryTimeout})
+}
+
+// newRedisClient creates a Redis client for redisURL, skipping certificate verification for TLS
+// connections since Heroku Redis uses self-signed certificates
+func newRedisClient(redisURL string) (*redis.Client, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(redisURL, "rediss") {
+		opts.TLSConfig = &tls.Config{
+			InsecureSkipVerify: true,
+		}
+	}
+
+	return redis.NewClient(opts), nil
 }
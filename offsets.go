@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	sqlc "github.com/achere/heroku-kafka-demo-go/db/sqlc"
+	"github.com/achere/heroku-kafka-demo-go/internal/config"
+	"github.com/achere/heroku-kafka-demo-go/internal/ledger"
+	"github.com/achere/heroku-kafka-demo-go/internal/transport"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// runResetOffsets moves the offsets of the consumer group on the stock-updates topic so messages are
+// replayed or skipped. The consumers have to be stopped first. Replayed messages are skipped by the
+// processed message ledger unless their entries are forgotten with -forget-processed
+func runResetOffsets(args []string) error {
+	fs := flag.NewFlagSet("reset-offsets", flag.ContinueOnError)
+	to := fs.String("to", "", "where to reset the offsets: earliest, latest, timestamp or offset")
+	at := fs.String("timestamp", "", "RFC 3339 timestamp to reset to with -to timestamp")
+	offsets := fs.String("offsets", "", "offsets per partition to reset to with -to offset, e.g. 0=42,1=17")
+	dryRun := fs.Bool("dry-run", false, "print the current and target offsets without committing them")
+	forget := fs.Bool("forget-processed", false, "remove the processed message entries at or after the target offsets so replayed messages are applied again")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	reset := transport.OffsetReset{Strategy: *to}
+
+	switch *to {
+	case transport.ResetEarliest, transport.ResetLatest:
+	case transport.ResetTimestamp:
+		ts, err := time.Parse(time.RFC3339, *at)
+		if err != nil {
+			return fmt.Errorf("invalid -timestamp: %w", err)
+		}
+		reset.Timestamp = ts
+	case transport.ResetOffset:
+		parsed, err := transport.ParsePartitionOffsets(*offsets)
+		if err != nil {
+			return fmt.Errorf("invalid -offsets: %w", err)
+		}
+		reset.Offsets = parsed
+	default:
+		fs.Usage()
+		return errors.New("-to must be one of earliest, latest, timestamp or offset")
+	}
+
+	appconfig, err := config.NewAppConfig()
+	if err != nil {
+		return err
+	}
+
+	client, err := transport.NewKafkaAdminClient(appconfig)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	group, topic := appconfig.Group(), appconfig.Topic()
+
+	plans, err := client.PlanOffsetReset(group, topic, reset)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("consumer group %s, topic %s\n", group, topic)
+	printOffsetPlans(os.Stdout, plans)
+
+	if *dryRun {
+		fmt.Println("dry run, no offsets were committed")
+		return nil
+	}
+
+	// ResetOffsets only succeeds once the target offsets were read back, so processed messages are
+	// never forgotten for offsets that weren't moved
+	if err := client.ResetOffsets(group, topic, plans); err != nil {
+		return err
+	}
+
+	fmt.Println("offsets committed")
+
+	if !*forget {
+		return nil
+	}
+
+	targets := make(map[int32]int64, len(plans))
+	for _, p := range plans {
+		targets[p.Partition] = p.TargetOffset
+	}
+
+	ctx := context.Background()
+
+	dbpool, err := pgxpool.New(ctx, appconfig.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	defer dbpool.Close()
+
+	forgotten, err := ledger.Forget(ctx, sqlc.New(dbpool), topic, targets)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d processed messages forgotten\n", forgotten)
+
+	return nil
+}
+
+func printOffsetPlans(w io.Writer, plans []transport.PartitionOffsetPlan) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PARTITION\tCURRENT\tCURRENT LAG\tTARGET\tTARGET LAG\tHIGH WATERMARK")
+
+	for _, p := range plans {
+		current := "-"
+		if p.CurrentOffset >= 0 {
+			current = fmt.Sprint(p.CurrentOffset)
+		}
+
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t%d\t%d\n",
+			p.Partition, current, p.CurrentLag(), p.TargetOffset, p.TargetLag(), p.HighWatermark,
+		)
+	}
+
+	tw.Flush()
+}
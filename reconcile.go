@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/achere/heroku-kafka-demo-go/internal/config"
+	"github.com/achere/heroku-kafka-demo-go/internal/inventory"
+	"github.com/achere/heroku-kafka-demo-go/internal/reconcile"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// runReconcile compares inventory with the stock derived from stock logs once and reports the drift,
+// repairing it when asked to
+func runReconcile(args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	repair := fs.Bool("repair", false, "set drifted stock levels to the derived stock and log a correction")
+	full := fs.Bool("full", false, "check all inventory rather than inventory with stock logs since the last run")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	appconfig, err := config.NewAppConfig()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	db, err := pgxpool.New(ctx, appconfig.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rdb, err := newRedisClient(appconfig.RedisURL)
+	if err != nil {
+		return err
+	}
+	defer rdb.Close()
+
+	reconciler := reconcile.NewReconciler(db, inventory.NewRedisCache(rdb, appconfig.Cache.TTL))
+
+	run := reconciler.Run
+	if *full {
+		run = reconciler.RunFull
+	}
+
+	drifts, err := run(ctx, *repair)
+	printDrifts(os.Stdout, drifts)
+	if err != nil {
+		return err
+	}
+
+	if len(drifts) == 0 {
+		fmt.Println("no drift found")
+	}
+
+	return nil
+}
+
+func printDrifts(w io.Writer, drifts []reconcile.Drift) {
+	if len(drifts) == 0 {
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PRODUCT\tWAREHOUSE\tSTOCK LEVEL\tDERIVED STOCK\tDIFFERENCE\tMOVEMENTS\tREPAIRED")
+
+	for _, d := range drifts {
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%+d\t%d\t%t\n",
+			d.ProductID, d.WarehouseID, d.StockLevel, d.DerivedStock, d.Difference(), d.Movements, d.Repaired,
+		)
+	}
+
+	tw.Flush()
+}